@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	cupllang "github.com/pborges/cupl/internal/cupl"
+)
+
+// cmdBench prints the product terms each output uses after minimization.
+// With --max-pt it fails if any output uses more, so a design that grows
+// past what a tighter part can fit breaks CI instead of the next port.
+func cmdBench(args []string) error {
+	maxPT := -1
+	var inputs []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		value, hasValue := "", false
+		switch {
+		case arg == "--max-pt" || arg == "-max-pt":
+			if i+1 >= len(args) {
+				return errors.New("missing value for --max-pt")
+			}
+			value, hasValue = args[i+1], true
+			i++
+		case strings.HasPrefix(arg, "--max-pt="):
+			value, hasValue = strings.TrimPrefix(arg, "--max-pt="), true
+		default:
+			inputs = append(inputs, arg)
+		}
+		if hasValue {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid --max-pt %q", value)
+			}
+			maxPT = n
+		}
+	}
+	if len(inputs) != 1 {
+		return errors.New("bench requires a single .pld input")
+	}
+	content, err := cupllang.ParseFile(inputs[0])
+	if err != nil {
+		return err
+	}
+	res, err := cupllang.CompileDetailed(content)
+	if err != nil {
+		return err
+	}
+	printWarnings(inputs[0], res.Warnings)
+	if over := writeTermCounts(os.Stdout, inputs[0], res, maxPT); over > 0 {
+		return fmt.Errorf("%d outputs use more than %d product terms", over, maxPT)
+	}
+	return nil
+}
+
+// writeTermCounts lists each output's product terms against its OLMC's
+// rows, by pin, and returns how many outputs use more than maxPT. A
+// negative maxPT sets no limit.
+func writeTermCounts(w io.Writer, name string, res *cupllang.CompileResult, maxPT int) int {
+	outs := append([]cupllang.OutputTerms(nil), res.Outputs...)
+	sort.SliceStable(outs, func(i, j int) bool { return outs[i].Pin < outs[j].Pin })
+	fmt.Fprintf(w, "%s: %s\n", name, res.Blueprint.Chip.Name())
+	over := 0
+	for _, out := range outs {
+		signal := out.Name
+		if out.Extension != "" {
+			signal += "." + out.Extension
+		}
+		fmt.Fprintf(w, "  pin %-3d %-12s %2d/%d product terms", out.Pin, signal, len(out.Minimized), out.MaxTerms)
+		if maxPT >= 0 && len(out.Minimized) > maxPT {
+			fmt.Fprintf(w, "  over --max-pt %d", maxPT)
+			over++
+		}
+		fmt.Fprintln(w)
+	}
+	return over
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pborges/cupl/internal/gal"
+	"github.com/pborges/cupl/internal/jed"
+)
+
+func cmdDisasm(args []string) error {
+	if len(args) != 1 {
+		return errors.New("disasm requires a single .jed input")
+	}
+	inPath := args[0]
+	data, err := ioutil.ReadFile(inPath)
+	if err != nil {
+		return err
+	}
+	j, err := jed.Parse(data)
+	if err != nil {
+		return err
+	}
+	chip, err := gal.ChipForFuseCount(j.QF)
+	if err != nil {
+		return err
+	}
+	bp, err := gal.DisassembleGAL(chip, j.Fuses)
+	if err != nil {
+		return err
+	}
+	name := strings.TrimSuffix(filepath.Base(inPath), filepath.Ext(inPath))
+	writeDisasm(os.Stdout, name, bp)
+	return nil
+}
+
+// writeDisasm prints a blueprint as CUPL source. Pins without a name in the
+// blueprint are called pinN.
+func writeDisasm(w io.Writer, name string, bp *gal.Blueprint) {
+	pinName := func(pin int) string {
+		if n := bp.Pins[pin-1].Name; n != "" {
+			return n
+		}
+		return fmt.Sprintf("pin%d", pin)
+	}
+
+	used := make(map[int]bool)
+	markTerm := func(t *gal.Term) {
+		if t == nil {
+			return
+		}
+		for _, row := range t.Pins {
+			for _, p := range row {
+				used[p.Pin] = true
+			}
+		}
+	}
+	for i, olmc := range bp.OLMC {
+		if olmc.Output != nil {
+			used[bp.Chip.MinOLMCPin()+i] = true
+		}
+		markTerm(olmc.Output)
+		markTerm(olmc.OETerm)
+	}
+	markTerm(bp.AR)
+	markTerm(bp.SP)
+
+	fmt.Fprintf(w, "Name     %s;\n", name)
+	if len(bp.Sig) > 0 {
+		fmt.Fprintf(w, "Partno   %s;\n", bp.Sig)
+	}
+	fmt.Fprintf(w, "Device   %s;\n", disasmDeviceName(bp))
+	fmt.Fprintln(w)
+
+	pins := make([]int, 0, len(used))
+	for p := range used {
+		pins = append(pins, p)
+	}
+	sort.Ints(pins)
+	for _, p := range pins {
+		fmt.Fprintf(w, "Pin %-2d = %s;\n", p, pinName(p))
+	}
+
+	for i, olmc := range bp.OLMC {
+		if olmc.Output == nil {
+			continue
+		}
+		pin := bp.Chip.MinOLMCPin() + i
+		lhs := pinName(pin)
+		kind := "combinatorial"
+		if olmc.Registered {
+			kind = "registered"
+		}
+		fmt.Fprintf(w, "\n/* OLMC %d (pin %d): %s */\n", i, pin, kind)
+		prefix := ""
+		if olmc.Active == gal.ActiveLow {
+			prefix = "!"
+		}
+		ext := ""
+		if olmc.Registered {
+			ext = ".D"
+		}
+		fmt.Fprintf(w, "%s%s%s = %s;\n", prefix, lhs, ext, formatTerm(bp, olmc.Output, pinName))
+		if olmc.OETerm != nil {
+			fmt.Fprintf(w, "%s.OE = %s;\n", lhs, formatTerm(bp, olmc.OETerm, pinName))
+		}
+	}
+	if bp.AR != nil {
+		fmt.Fprintf(w, "\nAR = %s;\n", formatTerm(bp, bp.AR, pinName))
+	}
+	if bp.SP != nil {
+		fmt.Fprintf(w, "SP = %s;\n", formatTerm(bp, bp.SP, pinName))
+	}
+}
+
+// formatTerm renders a term as a CUPL sum of products, undoing the feedback
+// inversion of registered GAL22V10 outputs so the result can be recompiled.
+func formatTerm(bp *gal.Blueprint, t *gal.Term, pinName func(int) string) string {
+	if len(t.Pins) == 0 {
+		return "'b'0"
+	}
+	rows := make([]string, 0, len(t.Pins))
+	for _, row := range t.Pins {
+		if len(row) == 0 {
+			return "'b'1"
+		}
+		lits := make([]string, 0, len(row))
+		for _, p := range row {
+			if p.Neg != bp.NeedsFeedbackFlip(p.Pin) {
+				lits = append(lits, "!"+pinName(p.Pin))
+			} else {
+				lits = append(lits, pinName(p.Pin))
+			}
+		}
+		rows = append(rows, strings.Join(lits, " & "))
+	}
+	return strings.Join(rows, "\n    # ")
+}
+
+func disasmDeviceName(bp *gal.Blueprint) string {
+	name := "g" + bp.Chip.ShortName()
+	if bp.Atmel {
+		name = "atf" + bp.Chip.ShortName()
+	}
+	if bp.Chip.HasModes() {
+		switch bp.ModeHint {
+		case gal.ModeSimple:
+			name += "as"
+		case gal.ModeComplex:
+			name += "ma"
+		case gal.ModeRegistered:
+			name += "ms"
+		}
+	}
+	if bp.PowerDown {
+		name += "pd"
+	}
+	return name
+}
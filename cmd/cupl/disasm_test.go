@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pborges/cupl/examples"
+	"github.com/pborges/cupl/internal/gal"
+	"github.com/pborges/cupl/internal/jed"
+)
+
+// TestWriteDisasm checks the disassembly of WinCUPL fuse maps against their
+// sources: c_16v8_complex_in.pld and r_22v10_invertedreg.pld with the pins
+// renamed.
+func TestWriteDisasm(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		want string
+	}{
+		{"c_16v8_complex_in", `Name     c_16v8_complex_in;
+Partno   Complex;
+Device   g16v8ma;
+
+Pin 2  = pin2;
+Pin 3  = pin3;
+Pin 4  = pin4;
+Pin 5  = pin5;
+Pin 6  = pin6;
+Pin 7  = pin7;
+Pin 12 = pin12;
+Pin 13 = pin13;
+Pin 14 = pin14;
+Pin 15 = pin15;
+Pin 16 = pin16;
+
+/* OLMC 0 (pin 12): combinatorial */
+pin12 = pin15
+    # pin2 & pin3;
+
+/* OLMC 1 (pin 13): combinatorial */
+pin13 = pin4
+    # pin5;
+
+/* OLMC 2 (pin 14): combinatorial */
+pin14 = !pin6 & pin7
+    # pin6 & !pin7;
+
+/* OLMC 4 (pin 16): combinatorial */
+!pin16 = pin2
+    # pin3
+    # pin4
+    # pin5
+    # pin6
+    # pin7;
+`},
+		// Registered active-high outputs read back with their feedback
+		// inversion undone, so !Q5.D = !Q6 reads back as !pin18.D = !pin19.
+		{"r_22v10_invertedreg", `Name     r_22v10_invertedreg;
+Partno   InvReg;
+Device   g22v10;
+
+Pin 2  = pin2;
+Pin 3  = pin3;
+Pin 14 = pin14;
+Pin 15 = pin15;
+Pin 16 = pin16;
+Pin 17 = pin17;
+Pin 18 = pin18;
+Pin 19 = pin19;
+Pin 20 = pin20;
+Pin 21 = pin21;
+
+/* OLMC 0 (pin 14): registered */
+!pin14.D = !pin15;
+
+/* OLMC 1 (pin 15): registered */
+!pin15.D = pin2 & pin3;
+
+/* OLMC 2 (pin 16): registered */
+!pin16.D = pin17;
+
+/* OLMC 3 (pin 17): registered */
+!pin17.D = pin2 & pin3;
+
+/* OLMC 4 (pin 18): registered */
+!pin18.D = !pin19;
+
+/* OLMC 5 (pin 19): registered */
+pin19.D = pin2 & pin3;
+
+/* OLMC 6 (pin 20): registered */
+!pin20.D = pin21;
+
+/* OLMC 7 (pin 21): registered */
+pin21.D = pin2 & pin3;
+`},
+	} {
+		data, err := examples.FS.ReadFile(tc.name + ".jed")
+		if err != nil {
+			t.Fatal(err)
+		}
+		j, err := jed.Parse(data)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		chip, err := gal.ChipForFuseCount(j.QF)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		bp, err := gal.DisassembleGAL(chip, j.Fuses)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		var b strings.Builder
+		writeDisasm(&b, tc.name, bp)
+		if got := b.String(); got != tc.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	cupllang "github.com/pborges/cupl/internal/cupl"
+	"github.com/pborges/cupl/internal/gal"
+)
+
+func cmdDoc(args []string) error {
+	if len(args) != 1 {
+		return errors.New("doc requires a single .pld input")
+	}
+	content, err := cupllang.ParseFile(args[0])
+	if err != nil {
+		return err
+	}
+	res, err := cupllang.CompileDetailed(content)
+	if err != nil {
+		return err
+	}
+	printWarnings(args[0], res.Warnings)
+	writeDoc(os.Stdout, content, res)
+	return nil
+}
+
+// writeDoc prints a WinCUPL-style design summary: the device, the pins and
+// fields, and each output's minimized sum of products.
+func writeDoc(w io.Writer, content cupllang.Content, res *cupllang.CompileResult) {
+	bp := res.Blueprint
+	chip := bp.Chip
+	names := make(map[int]string)
+	for pin, def := range content.Pins {
+		names[pin] = def.Name
+	}
+	for node, def := range content.Nodes {
+		if olmc, ok := chip.NodeToOLMC(node); ok {
+			names[chip.MinOLMCPin()+olmc] = def.Name
+		}
+	}
+	pinName := func(pin int) string {
+		if n, ok := names[pin]; ok {
+			return n
+		}
+		return fmt.Sprintf("pin%d", pin)
+	}
+
+	fmt.Fprintf(w, "Device: %s", chip.Name())
+	if res.Mode != gal.ModeAuto {
+		fmt.Fprintf(w, " (%s mode)", res.Mode)
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintf(w, "\nPins\n")
+	pins := make([]int, 0, len(names))
+	for pin := range names {
+		pins = append(pins, pin)
+	}
+	sort.Ints(pins)
+	for _, pin := range pins {
+		direction := "input"
+		if olmc, ok := chip.PinToOLMC(pin); ok && bp.OLMC[olmc].Output != nil {
+			direction = "output"
+			switch o := bp.OLMC[olmc]; {
+			case o.Registered:
+				direction = "registered output"
+			case o.Tristate || o.OETerm != nil:
+				direction = "tristate output"
+			}
+		}
+		polarity := "active high"
+		if content.Pins[pin].ActiveLow {
+			polarity = "active low"
+		}
+		where := fmt.Sprintf("pin %d", pin)
+		if _, ok := content.Pins[pin]; !ok {
+			where = fmt.Sprintf("node (pin %d)", pin)
+		}
+		fmt.Fprintf(w, "  %-14s %-10s %-18s %s\n", where, pinName(pin), direction, polarity)
+	}
+
+	if len(content.Fields) > 0 {
+		fmt.Fprintf(w, "\nFields\n")
+		fields := make([]string, 0, len(content.Fields))
+		for name := range content.Fields {
+			fields = append(fields, name)
+		}
+		sort.Strings(fields)
+		for _, name := range fields {
+			bits := make([]string, len(content.Fields[name].Bits))
+			for i, b := range content.Fields[name].Bits {
+				bits[i] = b.Name
+				if b.Neg {
+					bits[i] = "!" + b.Name
+				}
+			}
+			fmt.Fprintf(w, "  %s = [%s]\n", name, strings.Join(bits, ", "))
+		}
+	}
+
+	fmt.Fprintf(w, "\nOutputs\n")
+	maxTerms := make(map[int]int)
+	for _, out := range res.Outputs {
+		maxTerms[out.Pin] = out.MaxTerms
+	}
+	writeDocTerm := func(lhs string, t *gal.Term, max int) {
+		n := len(t.Pins)
+		if max > 0 {
+			fmt.Fprintf(w, "  %s (%d/%d product terms)\n", lhs, n, max)
+		} else {
+			fmt.Fprintf(w, "  %s (%d product term%s)\n", lhs, n, plural(n))
+		}
+		fmt.Fprintf(w, "      %s\n", strings.ReplaceAll(formatTerm(bp, t, pinName), "\n    ", "\n      "))
+	}
+	for i, olmc := range bp.OLMC {
+		if olmc.Output == nil {
+			continue
+		}
+		pin := chip.MinOLMCPin() + i
+		lhs := pinName(pin)
+		if olmc.Active == gal.ActiveLow {
+			lhs = "!" + lhs
+		}
+		if olmc.Registered {
+			lhs += ".D"
+		}
+		writeDocTerm(lhs, olmc.Output, maxTerms[pin])
+		if olmc.OETerm != nil {
+			writeDocTerm(pinName(pin)+".OE", olmc.OETerm, 0)
+		}
+	}
+	if bp.AR != nil {
+		writeDocTerm("AR", bp.AR, 0)
+	}
+	if bp.SP != nil {
+		writeDocTerm("SP", bp.SP, 0)
+	}
+
+	fmt.Fprintf(w, "\nProduct term rows used: %d of %d\n", usedRows(res.GAL), chip.NumRows())
+}
+
+// writeOLMCSummary prints how each OLMC was configured: the selected mode,
+// and per OLMC whether it is registered, its polarity, its output enable,
+// whether the AND array reads its feedback, and its product term use.
+func writeOLMCSummary(w io.Writer, name string, res *cupllang.CompileResult) {
+	bp := res.Blueprint
+	chip := bp.Chip
+	fmt.Fprintf(w, "%s: %s", name, chip.Name())
+	if chip.HasModes() {
+		fmt.Fprintf(w, " in %s mode", res.Mode)
+	}
+	fmt.Fprintln(w)
+
+	names := make(map[int]string)
+	for n, sym := range res.Symbols {
+		if n != "VCC" && n != "GND" {
+			names[sym.Pin] = n
+		}
+	}
+	maxTerms := make(map[int]int)
+	for _, out := range res.Outputs {
+		maxTerms[out.Pin] = out.MaxTerms
+	}
+	feedback := make(map[int]bool)
+	for _, t := range []*gal.Term{bp.AR, bp.SP} {
+		markPins(feedback, t)
+	}
+	for _, o := range bp.OLMC {
+		markPins(feedback, o.Output)
+		markPins(feedback, o.OETerm)
+		markPins(feedback, o.LETerm)
+	}
+
+	for i, o := range bp.OLMC {
+		pin := chip.MinOLMCPin() + i
+		signal := names[pin]
+		if signal == "" {
+			signal = "-"
+		}
+		if o.Output == nil {
+			kind := "unused"
+			if names[pin] != "" {
+				kind = "input"
+			}
+			fmt.Fprintf(w, "  pin %-3d %-10s %s\n", pin, signal, kind)
+			continue
+		}
+		kind := "combinatorial"
+		if o.Registered {
+			kind = "registered"
+		}
+		polarity := "active high"
+		if o.Active == gal.ActiveLow {
+			polarity = "active low"
+		}
+		enable := "always enabled"
+		switch {
+		case o.OETerm != nil:
+			enable = "OE term"
+		case o.Tristate:
+			enable = "tristate"
+		}
+		fb := "no feedback"
+		if feedback[pin] {
+			fb = "feedback"
+		}
+		fmt.Fprintf(w, "  pin %-3d %-10s %-13s %-11s %-14s %-11s %d/%d product terms\n",
+			pin, signal, kind, polarity, enable, fb, len(o.Output.Pins), maxTerms[pin])
+	}
+}
+
+// markPins records every pin a term reads.
+func markPins(used map[int]bool, t *gal.Term) {
+	if t == nil {
+		return
+	}
+	for _, row := range t.Pins {
+		for _, p := range row {
+			used[p.Pin] = true
+		}
+	}
+}
+
+// usedRows counts the AND array rows with at least one blown fuse. Unused
+// rows are left fully intact (always false).
+func usedRows(g *gal.GAL) int {
+	cols := g.Chip.NumCols()
+	used := 0
+	for row := 0; row < g.Chip.NumRows(); row++ {
+		for _, f := range g.Fuses[row*cols : (row+1)*cols] {
+			if f {
+				used++
+				break
+			}
+		}
+	}
+	return used
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
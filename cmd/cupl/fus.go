@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pborges/cupl/internal/gal"
+)
+
+// writeFus renders fuses as a .fus ASCII fuse map: the design header, then
+// the AND array one row per line with one character per fuse (x intact,
+// - blown), grouped under a header per section, then the architecture
+// fuses as JEDEC 0/1 values. Every line starts with the index of its first
+// fuse, so two maps diff line by line.
+func writeFus(w io.Writer, header []string, chip gal.Chip, fuses []bool) {
+	for _, line := range header {
+		fmt.Fprintf(w, "%s\n", line)
+	}
+	cols := chip.NumCols()
+	fmt.Fprintf(w, "Fuses           %d (%d rows of %d)\n", len(fuses), chip.NumRows(), cols)
+	fmt.Fprintf(w, "Legend          x = intact, - = blown\n")
+
+	group := ""
+	for row := 0; row < chip.NumRows(); row++ {
+		idx := row * cols
+		section, _, _ := strings.Cut(chip.FuseSectionName(idx), " row")
+		if section != group {
+			fmt.Fprintf(w, "\n[%s]\n", section)
+			group = section
+		}
+		fmt.Fprintf(w, "%05d ", idx)
+		for _, blown := range fuses[idx : idx+cols] {
+			if blown {
+				io.WriteString(w, "-")
+			} else {
+				io.WriteString(w, "x")
+			}
+		}
+		io.WriteString(w, "\n")
+	}
+
+	fmt.Fprintf(w, "\n[Architecture]\n")
+	for _, s := range architectureFuses(chip, fuses) {
+		fmt.Fprintf(w, "%05d %-4s %s\n", s.start, s.name, formatFuseBits(s.bits))
+	}
+}
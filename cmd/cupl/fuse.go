@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	cupllang "github.com/pborges/cupl/internal/cupl"
+	"github.com/pborges/cupl/internal/gal"
+	"github.com/pborges/cupl/internal/jed"
+)
+
+func cmdFuse(args []string) error {
+	if len(args) != 1 {
+		return errors.New("fuse requires a single .jed or .pld input")
+	}
+	j, err := loadFuses(args[0])
+	if err != nil {
+		return err
+	}
+	chip, err := gal.ChipForFuseCount(j.QF)
+	if err != nil {
+		return err
+	}
+	writeFuseMap(os.Stdout, chip, j.Fuses)
+	return nil
+}
+
+// loadFuses reads a .jed, or compiles a .pld, into JEDEC-ordered fuses.
+func loadFuses(inPath string) (jed.File, error) {
+	data, err := ioutil.ReadFile(inPath)
+	if err != nil {
+		return jed.File{}, err
+	}
+	switch strings.ToLower(filepath.Ext(inPath)) {
+	case ".jed":
+		return jed.Parse(data)
+	case ".pld":
+		content, err := cupllang.ParseFile(inPath)
+		if err != nil {
+			return jed.File{}, err
+		}
+		g, err := cupllang.Compile(content)
+		if err != nil {
+			return jed.File{}, err
+		}
+		return jed.Parse([]byte(jed.MakeJEDEC(jed.Config{}, g)))
+	default:
+		return jed.File{}, errors.New("fuse requires a .jed or .pld input")
+	}
+}
+
+// writeFuseMap prints the AND array one row per line, grouped by the section
+// (OLMC, AR or SP) each row belongs to, followed by the architecture fuses.
+// A 0 fuse is intact and connects its input to the row; a 1 fuse is blown.
+func writeFuseMap(w io.Writer, chip gal.Chip, fuses []bool) {
+	fmt.Fprintf(w, "%s fuse map (x = intact, - = blown)\n", chip.Name())
+
+	cols := chip.NumCols()
+	group := ""
+	for row := 0; row < chip.NumRows(); row++ {
+		idx := row * cols
+		section, rowName, _ := strings.Cut(chip.FuseSectionName(idx), " row")
+		if section != group {
+			fmt.Fprintf(w, "\n%s\n", section)
+			group = section
+		}
+		rowName, _, _ = strings.Cut(rowName, " ")
+		fmt.Fprintf(w, "  row%-6s L%05d  %s\n", rowName, idx, formatFuseRow(fuses[idx:idx+cols]))
+	}
+
+	fmt.Fprintf(w, "\nArchitecture\n")
+	for _, s := range architectureFuses(chip, fuses) {
+		fmt.Fprintf(w, "  %-5s %s\n", s.name, formatFuseBits(s.bits))
+	}
+}
+
+// archSection is one named group of architecture fuses (XOR, AC1, SIG, ...).
+type archSection struct {
+	name  string
+	start int // index of the first fuse
+	bits  []bool
+}
+
+// architectureFuses groups the fuses after the AND array by section, in
+// index order within each. The GAL22V10 interleaves XOR and S1, so a
+// section's fuses need not be contiguous.
+func architectureFuses(chip gal.Chip, fuses []bool) []archSection {
+	var sections []archSection
+	at := make(map[string]int)
+	for idx := chip.NumRows() * chip.NumCols(); idx < len(fuses); idx++ {
+		name, _, _ := strings.Cut(chip.FuseSectionName(idx), "[")
+		i, ok := at[name]
+		if !ok {
+			i = len(sections)
+			at[name] = i
+			sections = append(sections, archSection{name: name, start: idx})
+		}
+		sections[i].bits = append(sections[i].bits, fuses[idx])
+	}
+	return sections
+}
+
+// formatFuseBits renders fuses as their JEDEC 0/1 values.
+func formatFuseBits(bits []bool) string {
+	var b strings.Builder
+	for _, v := range bits {
+		b.WriteByte(byte('0' + boolToInt(v)))
+	}
+	return b.String()
+}
+
+// formatFuseRow renders one AND-array row, four columns (two inputs) per group.
+func formatFuseRow(row []bool) string {
+	var b strings.Builder
+	for i, blown := range row {
+		if i > 0 && i%4 == 0 {
+			b.WriteByte(' ')
+		}
+		if blown {
+			b.WriteByte('-')
+		} else {
+			b.WriteByte('x')
+		}
+	}
+	return b.String()
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	cupllang "github.com/pborges/cupl/internal/cupl"
+)
+
+// cmdLint reports likely mistakes in a design that still compiles: unused
+// declarations and active-low strobes driven active-high. It fails if it
+// finds any, so it can gate a build.
+func cmdLint(args []string) error {
+	polarity, unused := true, true
+	var inputs []string
+	for _, arg := range args {
+		switch arg {
+		case "--no-polarity":
+			polarity = false
+		case "--no-unused":
+			unused = false
+		default:
+			inputs = append(inputs, arg)
+		}
+	}
+	if len(inputs) != 1 {
+		return errors.New("lint requires a single .pld input")
+	}
+	content, err := cupllang.ParseFile(inputs[0])
+	if err != nil {
+		return err
+	}
+	res, err := cupllang.CompileDetailed(content)
+	if err != nil {
+		return err
+	}
+	var warnings, lint []string
+	for _, w := range res.Warnings {
+		switch {
+		case !cupllang.IsUnusedWarning(w):
+			warnings = append(warnings, w)
+		case unused:
+			lint = append(lint, w)
+		}
+	}
+	printWarnings(inputs[0], warnings)
+	if polarity {
+		lint = append(lint, cupllang.LintPolarity(res)...)
+	}
+	printWarnings(inputs[0], lint)
+	if len(lint) > 0 {
+		return fmt.Errorf("%d lint warnings", len(lint))
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	cuplroot "github.com/pborges/cupl"
+	cupllang "github.com/pborges/cupl/internal/cupl"
+	"github.com/pborges/cupl/internal/gal"
+)
+
+// diagLine matches the "line N: " prefix of compiler errors and warnings.
+var diagLine = regexp.MustCompile(`line (\d+): `)
+
+// listingNote is a diagnostic attached to a listing line.
+type listingNote struct {
+	kind string // "error" or "warning"
+	msg  string
+	col  int // 1-based caret column, 0 for none
+}
+
+// writeListingFile writes the listing of a build to path. res is nil when
+// the build failed with buildErr.
+func writeListingFile(path, inPath string, src []byte, res *cupllang.CompileResult, buildErr error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	writeListing(f, inPath, src, res, buildErr)
+	return f.Close()
+}
+
+// writeListing prints a WinCUPL-style listing: every source line numbered,
+// errors and warnings under the line they refer to, then a summary of pin
+// and product term usage. Diagnostics without a line go in the summary.
+func writeListing(w io.Writer, inPath string, src []byte, res *cupllang.CompileResult, buildErr error) {
+	if inPath == "-" {
+		inPath = "stdin"
+	}
+	lines := strings.Split(strings.TrimSuffix(strings.ReplaceAll(string(src), "\r\n", "\n"), "\n"), "\n")
+	notes := make(map[int][]listingNote)
+	var unplaced []listingNote
+	attach := func(kind, msg string) {
+		note := listingNote{kind: kind, msg: msg}
+		var pe *cupllang.ParseError
+		if kind == "error" && errors.As(buildErr, &pe) && pe.Line >= 1 && pe.Line <= len(lines) {
+			note.msg = pe.Msg
+			if pe.Source == lines[pe.Line-1] {
+				note.col = pe.Column
+			}
+			notes[pe.Line] = append(notes[pe.Line], note)
+			return
+		}
+		if m := diagLine.FindStringSubmatchIndex(msg); m != nil {
+			n, _ := strconv.Atoi(msg[m[2]:m[3]])
+			if n >= 1 && n <= len(lines) {
+				note.msg = msg[:m[0]] + msg[m[1]:]
+				notes[n] = append(notes[n], note)
+				return
+			}
+		}
+		unplaced = append(unplaced, note)
+	}
+	if buildErr != nil {
+		attach("error", buildErr.Error())
+	}
+	if res != nil {
+		for _, warn := range res.Warnings {
+			attach("warning", warn)
+		}
+	}
+
+	fmt.Fprintf(w, "cupl %s listing of %s\n", cuplroot.Version(), inPath)
+	if res != nil {
+		fmt.Fprintf(w, "Device: %s", res.Blueprint.Chip.Name())
+		if res.Mode != gal.ModeAuto {
+			fmt.Fprintf(w, " (%s mode)", res.Mode)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintln(w)
+	for i, line := range lines {
+		fmt.Fprintf(w, "%5d  %s\n", i+1, line)
+		for _, note := range notes[i+1] {
+			if note.col > 0 {
+				// Copy tabs so the caret lines up with the echoed source.
+				pad := []byte(line[:note.col-1])
+				for j, c := range pad {
+					if c != '\t' {
+						pad[j] = ' '
+					}
+				}
+				fmt.Fprintf(w, "       %s^\n", pad)
+			}
+			fmt.Fprintf(w, "       >>> %s: %s\n", note.kind, note.msg)
+		}
+	}
+
+	fmt.Fprintln(w)
+	for _, note := range unplaced {
+		fmt.Fprintf(w, "%s: %s\n", note.kind, note.msg)
+	}
+	if res == nil {
+		fmt.Fprintln(w, "Build failed.")
+		return
+	}
+	chip := res.Blueprint.Chip
+	used := 0
+	for _, p := range res.Blueprint.Pins {
+		if p.Name != "" {
+			used++
+		}
+	}
+	fmt.Fprintf(w, "Pins used: %d of %d\n", used, chip.NumPins())
+	if len(res.Outputs) > 0 {
+		fmt.Fprintln(w, "Product terms:")
+		for _, out := range res.Outputs {
+			fmt.Fprintf(w, "  %-12s pin %-3d %d/%d\n", out.Name, out.Pin, len(out.Minimized), out.MaxTerms)
+		}
+	}
+	fmt.Fprintf(w, "Product term rows used: %d of %d\n", usedRows(res.GAL), chip.NumRows())
+}
@@ -4,10 +4,11 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	cuplroot "github.com/pborges/cupl"
@@ -27,17 +28,65 @@ func main() {
 		fmt.Println(cuplroot.Version())
 	case "build":
 		if err := cmdBuild(os.Args[2:]); err != nil {
-			fmt.Fprintln(os.Stderr, "error:", err)
+			printError(err)
 			os.Exit(1)
 		}
 	case "devices":
 		fmt.Println("g16v8as")
+		fmt.Println("g20v8")
 		fmt.Println("g22v10")
+		fmt.Println("atf16v8")
+		fmt.Println("atf22v10c")
 	case "version":
 		fmt.Println(cuplroot.Version())
 	case "burn":
 		if err := cmdBurn(os.Args[2:]); err != nil {
-			fmt.Fprintln(os.Stderr, "error:", err)
+			printError(err)
+			os.Exit(1)
+		}
+	case "disasm":
+		if err := cmdDisasm(os.Args[2:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+	case "fuse":
+		if err := cmdFuse(os.Args[2:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+	case "doc":
+		if err := cmdDoc(os.Args[2:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+	case "parse":
+		if err := cmdParse(os.Args[2:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+	case "verify":
+		if err := cmdVerify(os.Args[2:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+	case "diff":
+		if err := cmdDiff(os.Args[2:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+	case "simulate":
+		if err := cmdSimulate(os.Args[2:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+	case "lint":
+		if err := cmdLint(os.Args[2:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+	case "bench":
+		if err := cmdBench(os.Args[2:]); err != nil {
+			printError(err)
 			os.Exit(1)
 		}
 	case "help", "-h", "--help":
@@ -49,85 +98,336 @@ func main() {
 	}
 }
 
+// printError reports err on stderr. Parse errors also show the offending
+// source line with a caret under the error column.
+func printError(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	var pe *cupllang.ParseError
+	if errors.As(err, &pe) && pe.Column > 0 {
+		fmt.Fprintf(os.Stderr, "  %s\n", strings.ReplaceAll(pe.Source, "\t", " "))
+		fmt.Fprintf(os.Stderr, "  %s^\n", strings.Repeat(" ", pe.Column-1))
+	}
+}
+
+// printWarnings reports compile warnings on stderr; they do not fail a build.
+func printWarnings(inPath string, warnings []string) {
+	if inPath == "-" {
+		inPath = "stdin"
+	}
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s: %s\n", inPath, w)
+	}
+}
+
 func usage() {
 	fmt.Println("cupl - WinCUPL-compatible compiler")
 	fmt.Println()
 	fmt.Println("Usage:")
-	fmt.Println("  cupl build <file.pld> -o <file.jed>")
-	fmt.Println("  cupl burn <file.jed|file.pld>")
+	fmt.Println("  cupl build <file.pld>... (each to its sibling .jed, or .fus with -f fus)")
+	fmt.Println("  cupl build <file.pld|-> -o <file.jed|-> [-f jed|fus] [--stdout] [--pin-notes] [--device-fields] [--all-fuses] [--crlf] [--fuse-width <n>] [-l <file.lst>] [-v|--verbose] [-s|--security] [-m <level>|--no-minimize] [--dont-care] [-d <device>] [-D name=value]...")
+	fmt.Println("  cupl burn <file.jed|file.pld> [-p <device>] [--programmer <name|template>] [--verify] [-r|--read-back] [--dry-run] [--keep]")
+	fmt.Println("  cupl disasm <file.jed>")
+	fmt.Println("  cupl fuse <file.jed|file.pld>")
+	fmt.Println("  cupl verify <file.jed> <reference.jed>")
+	fmt.Println("  cupl diff <a.jed> <b.jed>")
+	fmt.Println("  cupl doc <file.pld>")
+	fmt.Println("  cupl simulate <file.pld> [name=0|1]...")
+	fmt.Println("  cupl lint <file.pld> [--no-polarity] [--no-unused]")
+	fmt.Println("  cupl bench <file.pld> [--max-pt <n>]")
+	fmt.Println("  cupl parse --json <file.pld|->")
 	fmt.Println("  cupl devices")
 	fmt.Println("  cupl version")
 	fmt.Println("  cupl -v")
 }
 
 func cmdBuild(args []string) error {
-	outPath, rest, err := parseBuildArgs(args)
+	opts, rest, err := parseBuildArgs(args)
 	if err != nil {
 		return err
 	}
-	if len(rest) != 1 {
-		return errors.New("build requires a single .pld input")
+	if len(rest) == 0 {
+		return errors.New("build requires a .pld input")
 	}
-	inPath := rest[0]
-	data, err := ioutil.ReadFile(inPath)
-	if err != nil {
-		return err
+	if len(rest) == 1 {
+		return buildFile(rest[0], opts)
+	}
+
+	// Several inputs each build to their sibling .jed. A failed file is
+	// reported and the rest still build.
+	if opts.outPath != "" {
+		return errors.New("-o and --stdout require a single .pld input")
+	}
+	if opts.listPath != "" {
+		return errors.New("-l requires a single .pld input")
+	}
+	failed := 0
+	for _, inPath := range rest {
+		if inPath == "-" {
+			return errors.New("stdin input (-) cannot be combined with other inputs")
+		}
+	}
+	for _, inPath := range rest {
+		if err := buildFile(inPath, opts); err != nil {
+			printError(fmt.Errorf("%s: %w", inPath, err))
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d builds failed", failed, len(rest))
+	}
+	return nil
+}
+
+// buildFile compiles one .pld (or stdin for "-") and writes its JEDEC, or
+// its .fus fuse map with -f fus. An empty opts.outPath writes next to the
+// input with the format's extension.
+func buildFile(inPath string, opts buildOptions) error {
+	if inPath == "-" && opts.outPath == "" {
+		return errors.New("reading from stdin requires an explicit -o (use -o - for stdout)")
+	}
+	var data []byte
+	var err error
+	if inPath == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(inPath)
 	}
-	content, err := cupllang.Parse(data)
 	if err != nil {
 		return err
 	}
-	g, err := cupllang.Compile(content)
+	// Stdin's $INCLUDEs resolve against the working directory.
+	fsys, file := cupllang.IncludeFS(inPath)
+	if inPath == "-" {
+		fsys, file = cupllang.IncludeFS("stdin")
+	}
+	content, err := cupllang.ParseWithOptions(data, cupllang.ParseOptions{Defines: opts.defines, FS: fsys, File: file})
+	var res *cupllang.CompileResult
+	if err == nil && opts.device != "" {
+		if content.Device != "" && !strings.EqualFold(content.Device, opts.device) {
+			printWarnings(inPath, []string{fmt.Sprintf("-d %s overrides DEVICE %s", opts.device, content.Device)})
+		}
+		content.Device = opts.device
+	}
+	if err == nil {
+		if opts.minLevel >= 0 {
+			content.MinLevel = opts.minLevel
+		}
+		res, err = cupllang.CompileDetailedWithOptions(content, cupllang.CompileOptions{DontCares: opts.dontCares, NoMinimize: opts.noMin})
+	}
+	// The listing is written for failed builds too; it shows where the
+	// errors are.
+	if opts.listPath != "" {
+		if lerr := writeListingFile(opts.listPath, inPath, data, res, err); lerr != nil && err == nil {
+			return lerr
+		}
+	}
 	if err != nil {
 		return err
 	}
-	if outPath == "" {
+	var warnings []string
+	for _, w := range res.Warnings {
+		if opts.verbose || !cupllang.IsUnusedWarning(w) {
+			warnings = append(warnings, w)
+		}
+	}
+	printWarnings(inPath, warnings)
+	if opts.verbose {
+		writeOLMCSummary(os.Stderr, inPath, res)
+	}
+	g := res.GAL
+	if opts.outPath == "" {
 		base := strings.TrimSuffix(inPath, filepath.Ext(inPath))
-		outPath = base + ".jed"
+		opts.outPath = base + "." + opts.format
 	}
-	return buildJedFromContent(content, g, outPath)
+	return buildJedFromContent(content, g, opts)
 }
 
-func parseBuildArgs(args []string) (string, []string, error) {
+type buildOptions struct {
+	outPath   string
+	listPath  string
+	format    string // "jed" or "fus"
+	pinNotes  bool
+	devFields bool
+	allFuses  bool
+	crlf      bool // end lines with CRLF
+	fuseWidth int  // fuses per *L line; 0 writes one line per row
+	security  bool
+	stdout    bool
+	verbose   bool   // print unused declarations, the mode and OLMC configuration to stderr
+	minLevel  int    // -1 keeps the MIN level from the source
+	noMin     bool   // --no-minimize: level 0, terms as written
+	dontCares bool   // --dont-care: unlisted TABLE/CONDITION inputs are don't-cares
+	device    string // -d: compile for this device instead of the source's DEVICE
+	defines   defineFlags
+}
+
+// defineFlags collects repeated -D name=value flags. A bare -D name defines
+// name with an empty value, like a $DEFINE without one.
+type defineFlags map[string]string
+
+func (d defineFlags) String() string { return "" }
+
+func (d defineFlags) Set(s string) error {
+	name, value, _ := strings.Cut(s, "=")
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("-D %q: missing name", s)
+	}
+	d[name] = value
+	return nil
+}
+
+func parseBuildArgs(args []string) (buildOptions, []string, error) {
+	opts := buildOptions{defines: make(defineFlags)}
 	fs := flag.NewFlagSet("build", flag.ContinueOnError)
-	outPath := fs.String("o", "", "output JED file")
+	fs.StringVar(&opts.outPath, "o", "", "output JED file")
+	fs.StringVar(&opts.format, "f", "jed", "output format: jed or fus")
+	fs.StringVar(&opts.format, "format", "jed", "output format: jed or fus")
+	fs.StringVar(&opts.device, "d", "", "compile for this device, overriding DEVICE in the source")
+	fs.StringVar(&opts.device, "device", "", "compile for this device, overriding DEVICE in the source")
+	fs.StringVar(&opts.listPath, "l", "", "write a listing file")
+	fs.StringVar(&opts.listPath, "list", "", "write a listing file")
+	fs.IntVar(&opts.minLevel, "m", -1, "minimization level 0-4 (overrides MIN)")
+	fs.BoolVar(&opts.noMin, "no-minimize", false, "keep product terms as written (same as -m 0)")
+	fs.BoolVar(&opts.dontCares, "dont-care", false, "minimize with unlisted TABLE and CONDITION inputs as don't-cares instead of 0")
+	fs.BoolVar(&opts.pinNotes, "pin-notes", false, "emit *N pin assignment notes")
+	fs.BoolVar(&opts.devFields, "device-fields", false, "emit the *D device and *QP pin count fields")
+	fs.BoolVar(&opts.allFuses, "all-fuses", false, "emit *L lines for fully intact rows too")
+	fs.BoolVar(&opts.crlf, "crlf", false, "end lines with CRLF for Windows programmers")
+	fs.IntVar(&opts.fuseWidth, "fuse-width", 0, "fuses per *L line, e.g. 32 (default one line per row)")
+	fs.BoolVar(&opts.security, "s", false, "set the security fuse (*G1)")
+	fs.BoolVar(&opts.security, "security", false, "set the security fuse (*G1)")
+	fs.BoolVar(&opts.stdout, "stdout", false, "write the JEDEC to stdout")
+	fs.BoolVar(&opts.verbose, "v", false, "print unused declarations, the mode and OLMC configuration to stderr")
+	fs.BoolVar(&opts.verbose, "verbose", false, "print unused declarations, the mode and OLMC configuration to stderr")
+	fs.Var(opts.defines, "D", "define name=value for the preprocessor (repeatable)")
 	rest := make([]string, 0, len(args))
 	for i := 0; i < len(args); i++ {
 		arg := args[i]
 		if arg == "-o" || arg == "--o" {
 			if i+1 >= len(args) {
-				return "", nil, errors.New("missing value for -o")
+				return opts, nil, errors.New("missing value for -o")
+			}
+			if next := args[i+1]; next != "-" && strings.HasPrefix(next, "-") {
+				return opts, nil, fmt.Errorf("-o requires an output file, got flag %s", next)
 			}
 			if err := fs.Set("o", args[i+1]); err != nil {
-				return "", nil, err
+				return opts, nil, err
 			}
 			i++
 			continue
 		}
 		if strings.HasPrefix(arg, "-o=") {
 			if err := fs.Set("o", strings.TrimPrefix(arg, "-o=")); err != nil {
-				return "", nil, err
+				return opts, nil, err
 			}
 			continue
 		}
-		if strings.HasPrefix(arg, "-") {
+		if arg == "-l" || arg == "--l" || arg == "--list" {
+			if i+1 >= len(args) || strings.HasPrefix(args[i+1], "-") {
+				return opts, nil, errors.New("-l requires a listing file")
+			}
+			opts.listPath = args[i+1]
+			i++
+			continue
+		}
+		if arg == "-m" || arg == "--m" {
+			if i+1 >= len(args) {
+				return opts, nil, errors.New("missing value for -m")
+			}
+			if err := fs.Set("m", args[i+1]); err != nil {
+				return opts, nil, fmt.Errorf("invalid -m level %q", args[i+1])
+			}
+			i++
+			continue
+		}
+		if arg == "-fuse-width" || arg == "--fuse-width" {
+			if i+1 >= len(args) {
+				return opts, nil, errors.New("missing value for --fuse-width")
+			}
+			if err := fs.Set("fuse-width", args[i+1]); err != nil {
+				return opts, nil, fmt.Errorf("invalid --fuse-width %q", args[i+1])
+			}
+			i++
+			continue
+		}
+		if arg == "-f" || arg == "--f" || arg == "--format" {
+			if i+1 >= len(args) {
+				return opts, nil, errors.New("missing value for -f")
+			}
+			opts.format = args[i+1]
+			i++
+			continue
+		}
+		if arg == "-d" || arg == "--d" || arg == "--device" {
+			if i+1 >= len(args) {
+				return opts, nil, errors.New("missing value for -d")
+			}
+			opts.device = args[i+1]
+			i++
+			continue
+		}
+		if arg == "-D" || arg == "--D" {
+			if i+1 >= len(args) {
+				return opts, nil, errors.New("missing value for -D")
+			}
+			if err := fs.Set("D", args[i+1]); err != nil {
+				return opts, nil, err
+			}
+			i++
+			continue
+		}
+		if strings.HasPrefix(arg, "-D") && !strings.HasPrefix(arg, "-D=") {
+			if err := fs.Set("D", strings.TrimPrefix(arg, "-D")); err != nil {
+				return opts, nil, err
+			}
+			continue
+		}
+		if arg != "-" && strings.HasPrefix(arg, "-") {
 			// Let FlagSet handle known flags to preserve error messages.
 			if err := fs.Parse([]string{arg}); err != nil {
-				return "", nil, err
+				return opts, nil, err
 			}
 			continue
 		}
 		rest = append(rest, arg)
 	}
-	return *outPath, rest, nil
+	// Combinations are checked once every flag is in, so their order on the
+	// command line does not matter.
+	if opts.format != "jed" && opts.format != "fus" {
+		return opts, nil, fmt.Errorf("unknown format %q, want jed or fus", opts.format)
+	}
+	if opts.security && opts.format == "fus" {
+		return opts, nil, errors.New("--security needs -f jed; a .fus map has no security fuse")
+	}
+	if opts.stdout {
+		if opts.outPath != "" && opts.outPath != "-" {
+			return opts, nil, errors.New("--stdout cannot be combined with -o " + opts.outPath)
+		}
+		opts.outPath = "-"
+	}
+	if opts.device != "" {
+		if _, err := gal.ParseChip(opts.device); err != nil {
+			return opts, nil, fmt.Errorf("-d: %w", err)
+		}
+	}
+	if opts.fuseWidth < 0 {
+		return opts, nil, fmt.Errorf("invalid --fuse-width %d", opts.fuseWidth)
+	}
+	if opts.minLevel > cupllang.MaxMinLevel {
+		return opts, nil, fmt.Errorf("-m level must be 0-%d", cupllang.MaxMinLevel)
+	}
+	if opts.noMin {
+		if opts.minLevel > 0 {
+			return opts, nil, fmt.Errorf("--no-minimize conflicts with -m %d", opts.minLevel)
+		}
+		opts.minLevel = 0
+	}
+	return opts, rest, nil
 }
 
 func buildJed(inPath, outPath string) error {
-	data, err := ioutil.ReadFile(inPath)
-	if err != nil {
-		return err
-	}
-	content, err := cupllang.Parse(data)
+	content, err := cupllang.ParseFile(inPath)
 	if err != nil {
 		return err
 	}
@@ -135,19 +435,43 @@ func buildJed(inPath, outPath string) error {
 	if err != nil {
 		return err
 	}
-	return buildJedFromContent(content, g, outPath)
+	return buildJedFromContent(content, g, buildOptions{outPath: outPath})
 }
 
-func buildJedFromContent(content cupllang.Content, g *gal.GAL, outPath string) error {
+func buildJedFromContent(content cupllang.Content, g *gal.GAL, opts buildOptions) error {
+	eol := "\n"
+	if opts.crlf {
+		eol = "\r\n"
+	}
 	jedText := jed.MakeJEDEC(jed.Config{
-		SecurityBit: false,
-		Header:      headerLines(content, g.Chip),
+		SecurityBit:      opts.security,
+		Header:           headerLines(content, g.Chip),
+		EmitPinNotes:     opts.pinNotes,
+		EmitDeviceFields: opts.devFields,
+		EmitAllFuses:     opts.allFuses,
+		UserSignature:    content.UserSignature(),
+		LineEnding:       eol,
+		FuseLineWidth:    opts.fuseWidth,
 	}, g)
-	return ioutil.WriteFile(outPath, []byte(jedText), 0644)
+	if opts.format == "fus" {
+		// Render from the JEDEC so the map has its fuse order and options.
+		j, err := jed.Parse([]byte(jedText))
+		if err != nil {
+			return err
+		}
+		var b strings.Builder
+		writeFus(&b, headerLines(content, g.Chip), g.Chip, j.Fuses)
+		jedText = strings.ReplaceAll(b.String(), "\n", eol)
+	}
+	if opts.outPath == "-" {
+		_, err := io.WriteString(os.Stdout, jedText)
+		return err
+	}
+	return ioutil.WriteFile(opts.outPath, []byte(jedText), 0644)
 }
 
 func cmdBurn(args []string) error {
-	deviceOverride, rest, err := parseBurnArgs(args)
+	opts, rest, err := parseBurnArgs(args)
 	if err != nil {
 		return err
 	}
@@ -156,123 +480,299 @@ func cmdBurn(args []string) error {
 	}
 	inPath := rest[0]
 	ext := strings.ToLower(filepath.Ext(inPath))
+	if ext != ".pld" && ext != ".jed" {
+		return errors.New("burn requires a .jed or .pld input")
+	}
 	jedPath := inPath
-	tempDir := ""
-	if ext == ".pld" {
-		tempDir, err = os.MkdirTemp("", "cupl-burn-*")
+	var work burnWorkDir
+	if ext == ".pld" || opts.readBack {
+		work, err = newBurnWorkDir(opts.keep)
 		if err != nil {
 			return err
 		}
-		defer os.RemoveAll(tempDir)
+		defer work.cleanup()
+	}
+	if ext == ".pld" {
 		base := strings.TrimSuffix(filepath.Base(inPath), filepath.Ext(inPath))
-		jedPath = filepath.Join(tempDir, base+".jed")
-		if err := buildJed(inPath, jedPath); err != nil {
+		jedPath = filepath.Join(work.dir, base+".jed")
+		err := buildJed(inPath, jedPath)
+		if work.kept() {
+			fmt.Printf("jed: %s (built from %s, kept)\n", jedPath, inPath)
+		}
+		if err != nil {
 			return err
 		}
-	} else if ext != ".jed" {
-		return errors.New("burn requires a .jed or .pld input")
 	}
 	data, err := ioutil.ReadFile(jedPath)
 	if err != nil {
 		return err
 	}
-	device := deviceOverride
+	prog, progName, err := lookupProgrammer(opts.programmer)
+	if err != nil {
+		return err
+	}
+	device := opts.device
 	if device == "" {
 		device, err = jedDeviceFromFile(data)
 		if err != nil {
 			return err
 		}
+		if prog.device != nil {
+			j, err := jed.Parse(data)
+			if err != nil {
+				return err
+			}
+			if device, err = prog.device(device, j.QF); err != nil {
+				return fmt.Errorf("%s: %w", progName, err)
+			}
+		}
+	}
+	if opts.verify && prog.verify == nil {
+		return fmt.Errorf("programmer %s cannot verify", progName)
+	}
+	if opts.readBack && prog.read == nil {
+		return fmt.Errorf("programmer %s cannot read a part back", progName)
+	}
+	if opts.dryRun {
+		if ext == ".pld" && !work.kept() {
+			fmt.Printf("jed: %s (built from %s, removed on exit)\n", jedPath, inPath)
+		}
+		fmt.Printf("device: %s\n", device)
+		fmt.Printf("write: %s\n", formatArgv(programmerArgv(prog.write, device, jedPath)))
+		if opts.verify {
+			fmt.Printf("verify: %s\n", formatArgv(programmerArgv(prog.verify, device, jedPath)))
+		}
+		if opts.readBack {
+			fmt.Printf("read-back: %s\n", formatArgv(programmerArgv(prog.read, device, work.readBackPath())))
+		}
+		return nil
+	}
+	if err := runProgrammer(prog.write, device, jedPath); err != nil {
+		return err
+	}
+
+	if opts.verify {
+		if err := runProgrammer(prog.verify, device, jedPath); err != nil {
+			fmt.Println("verify: FAIL")
+			return fmt.Errorf("verify: %w", err)
+		}
+		fmt.Println("verify: pass")
 	}
-	cmd := exec.Command("minipro", "-p", device, "-w", jedPath)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-	return cmd.Run()
+	if opts.readBack {
+		return readBackCompare(prog, device, data, work)
+	}
+	return nil
+}
+
+// workDirEnv names the environment variable that sets a fixed work directory
+// for cupl burn; it is created if needed and never removed.
+const workDirEnv = "CUPL_WORKDIR"
+
+// burnWorkDir holds the JEDEC built from a .pld and the read-back of the
+// part. It is a temporary directory unless --keep or $CUPL_WORKDIR asks for
+// the files to outlive the burn.
+type burnWorkDir struct {
+	dir  string
+	temp bool // remove dir on cleanup
 }
 
-func parseBurnArgs(args []string) (string, []string, error) {
+func newBurnWorkDir(keep bool) (burnWorkDir, error) {
+	if dir := os.Getenv(workDirEnv); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return burnWorkDir{}, err
+		}
+		return burnWorkDir{dir: dir}, nil
+	}
+	dir, err := os.MkdirTemp("", "cupl-burn-*")
+	if err != nil {
+		return burnWorkDir{}, err
+	}
+	return burnWorkDir{dir: dir, temp: !keep}, nil
+}
+
+// kept reports whether the files survive the burn.
+func (w burnWorkDir) kept() bool { return !w.temp }
+
+func (w burnWorkDir) readBackPath() string { return filepath.Join(w.dir, "read-back.jed") }
+
+func (w burnWorkDir) cleanup() {
+	if w.temp {
+		os.RemoveAll(w.dir)
+	}
+}
+
+// readBackCompare reads the programmed part into the work directory and
+// diffs its fuses against the source. A part with its security fuse set
+// reads back blank, so that is rejected up front.
+func readBackCompare(prog programmer, device string, src []byte, work burnWorkDir) error {
+	want, err := jed.Parse(src)
+	if err != nil {
+		return err
+	}
+	if want.G != 0 {
+		return errors.New("read-back: the security fuse is set, so the part cannot be read")
+	}
+	readPath := work.readBackPath()
+	if work.kept() {
+		fmt.Printf("read-back: reading the part into %s\n", readPath)
+	}
+	if err := runProgrammer(prog.read, device, readPath); err != nil {
+		return fmt.Errorf("read-back: %w", err)
+	}
+	data, err := ioutil.ReadFile(readPath)
+	if err != nil {
+		return err
+	}
+	got, err := jed.Parse(data)
+	if err != nil {
+		return fmt.Errorf("read-back: %w", err)
+	}
+	if diff := jed.Diff(got, want); diff != "" {
+		fmt.Printf("read-back: FAIL: part (got) vs source (want): %s", diff)
+		return errMismatch
+	}
+	fmt.Printf("read-back: pass (%d fuses)\n", want.QF)
+	return nil
+}
+
+type burnOptions struct {
+	device     string // programmer device name; empty reads it from the JED header
+	programmer string // registry name or command template; empty uses $CUPL_PROGRAMMER or minipro
+	verify     bool   // run the programmer's verify command after writing
+	readBack   bool   // read the part back and diff its fuses against the JED
+	dryRun     bool   // print the programmer commands instead of running them
+	keep       bool   // keep the work directory with the built JED and read-back
+}
+
+func parseBurnArgs(args []string) (burnOptions, []string, error) {
+	var opts burnOptions
 	fs := flag.NewFlagSet("burn", flag.ContinueOnError)
 	device := fs.String("p", "", "minipro device name (override)")
+	fs.StringVar(&opts.programmer, "programmer", "", "programmer name or command template")
+	fs.BoolVar(&opts.verify, "verify", false, "verify the part after writing")
+	fs.BoolVar(&opts.readBack, "read-back", false, "read the part back and compare its fuses")
+	fs.BoolVar(&opts.readBack, "r", false, "shorthand for --read-back")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "print the programmer commands without running them")
+	fs.BoolVar(&opts.keep, "keep", false, "keep the built JED and read-back instead of removing them")
 	rest := make([]string, 0, len(args))
 	for i := 0; i < len(args); i++ {
 		arg := args[i]
 		if arg == "-p" || arg == "--p" || arg == "--device" {
 			if i+1 >= len(args) {
-				return "", nil, errors.New("missing value for -p")
+				return opts, nil, errors.New("missing value for -p")
 			}
 			if err := fs.Set("p", args[i+1]); err != nil {
-				return "", nil, err
+				return opts, nil, err
 			}
 			i++
 			continue
 		}
 		if strings.HasPrefix(arg, "-p=") {
 			if err := fs.Set("p", strings.TrimPrefix(arg, "-p=")); err != nil {
-				return "", nil, err
+				return opts, nil, err
+			}
+			continue
+		}
+		if arg == "--programmer" {
+			if i+1 >= len(args) {
+				return opts, nil, errors.New("missing value for --programmer")
 			}
+			opts.programmer = args[i+1]
+			i++
 			continue
 		}
 		if strings.HasPrefix(arg, "--device=") {
 			if err := fs.Set("p", strings.TrimPrefix(arg, "--device=")); err != nil {
-				return "", nil, err
+				return opts, nil, err
 			}
 			continue
 		}
 		if strings.HasPrefix(arg, "-") {
 			if err := fs.Parse([]string{arg}); err != nil {
-				return "", nil, err
+				return opts, nil, err
 			}
 			continue
 		}
 		rest = append(rest, arg)
 	}
-	return *device, rest, nil
+	opts.device = *device
+	return opts, rest, nil
 }
 
+// deviceHeadersEnv names the environment variable with extra comma-separated
+// header prefixes that jedDeviceFromFile accepts before a device name.
+const deviceHeadersEnv = "CUPL_DEVICE_HEADERS"
+
+// deviceHeaders are the free-form header prefixes that name the device, as
+// written by cupl and WinCUPL ("Device") and by other toolchains.
+var deviceHeaders = []string{"Device", "Part", "Chip"}
+
+// jedDeviceFromFile finds the device a JEDEC file was built for. It looks for
+// a header line starting with one of deviceHeaders (or $CUPL_DEVICE_HEADERS)
+// before the first '*', then for "*N DEVICE name" notes and a "*D" field, and
+// finally infers the chip from the *QF fuse count.
 func jedDeviceFromFile(data []byte) (string, error) {
 	s := string(data)
-	s = strings.TrimPrefix(s, "\x02")
+	if idx := strings.Index(s, "\x02"); idx >= 0 {
+		s = s[idx+1:]
+	}
 	if idx := strings.Index(s, "\x03"); idx >= 0 {
 		s = s[:idx]
 	}
-	for _, line := range strings.Split(s, "\n") {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-		if strings.HasPrefix(line, "*") {
-			break
+	prefixes := deviceHeaders
+	for _, p := range strings.Split(os.Getenv(deviceHeadersEnv), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			prefixes = append(prefixes[:len(prefixes):len(prefixes)], p)
 		}
-		if strings.HasPrefix(line, "Device") {
-			v := strings.TrimSpace(strings.TrimPrefix(line, "Device"))
-			if v == "" {
-				return "", errors.New("JED device header is empty")
+	}
+
+	fields := strings.Split(s, "*")
+	for _, line := range strings.Split(fields[0], "\n") {
+		line = strings.TrimSpace(line)
+		for _, prefix := range prefixes {
+			if len(line) < len(prefix) || !strings.EqualFold(line[:len(prefix)], prefix) {
+				continue
 			}
-			fields := strings.Fields(v)
-			if len(fields) == 0 {
-				return "", errors.New("JED device header is empty")
+			v := line[len(prefix):]
+			if v != "" && v[0] != ' ' && v[0] != '\t' && v[0] != ':' {
+				continue // a longer word, e.g. "Partno"
 			}
-			return fields[0], nil
+			name := strings.Fields(strings.TrimPrefix(strings.TrimSpace(v), ":"))
+			if len(name) == 0 {
+				return "", fmt.Errorf("JED %s header is empty", prefix)
+			}
+			return name[0], nil
 		}
 	}
-	return "", errors.New("JED device header not found")
-}
-
 
-func headerLines(c cupllang.Content, chip gal.Chip) []string {
-	lines := []string{
-		fmt.Sprintf("CUPlang        %s", cuplroot.Version()),
-		fmt.Sprintf("Device          %s", headerDeviceName(chip)),
+	qf := -1
+	for _, field := range fields[1:] {
+		field = strings.TrimSpace(field)
+		words := strings.Fields(field)
+		switch {
+		case len(words) >= 3 && words[0] == "N" && strings.EqualFold(words[1], "DEVICE"):
+			return words[2], nil
+		case len(words) == 1 && len(field) > 1 && field[0] == 'D':
+			return field[1:], nil
+		case strings.HasPrefix(field, "QF"):
+			if n, err := strconv.Atoi(strings.TrimSpace(field[2:])); err == nil {
+				qf = n
+			}
+		}
 	}
-	keys := []string{"Name", "Partno", "Revision", "Date", "Designer", "Company", "Assembly", "Location"}
-	for _, k := range keys {
-		if v := strings.TrimSpace(c.Meta[k]); v != "" {
-			lines = append(lines, fmt.Sprintf("%-15s %s", k, v))
+	if qf >= 0 {
+		if chip, err := gal.ChipForFuseCount(qf); err == nil {
+			if qf == chip.TotalSize()+1 {
+				return "atf" + chip.ShortName(), nil
+			}
+			return "g" + chip.ShortName(), nil
 		}
 	}
-	return lines
+	return "", fmt.Errorf("JED device not found: searched header lines starting with %s, *N DEVICE notes, the *D field and the *QF fuse count; give the device with -p",
+		strings.Join(prefixes, ", "))
 }
 
-func headerDeviceName(chip gal.Chip) string {
-	return strings.ToLower(strings.TrimPrefix(chip.Name(), "GAL"))
+
+func headerLines(c cupllang.Content, chip gal.Chip) []string {
+	return jed.HeaderLines(cuplroot.Version(), chip, c.Meta, c.MetaOrder)
 }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+
+	cupllang "github.com/pborges/cupl/internal/cupl"
+)
+
+// cmdParse prints the parsed design as JSON for editors and other tooling.
+// Expressions are objects tagged with their node "Type".
+func cmdParse(args []string) error {
+	jsonOut := false
+	var inputs []string
+	for _, arg := range args {
+		switch arg {
+		case "--json":
+			jsonOut = true
+		default:
+			inputs = append(inputs, arg)
+		}
+	}
+	if !jsonOut {
+		return errors.New("parse requires --json")
+	}
+	if len(inputs) != 1 {
+		return errors.New("parse requires a single .pld input")
+	}
+	var content cupllang.Content
+	var err error
+	if inputs[0] == "-" {
+		var data []byte
+		data, err = ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		fsys, file := cupllang.IncludeFS("stdin")
+		content, err = cupllang.ParseWithOptions(data, cupllang.ParseOptions{FS: fsys, File: file})
+	} else {
+		content, err = cupllang.ParseFile(inputs[0])
+	}
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(content)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pborges/cupl/internal/gal"
+)
+
+// programmerEnv names the environment variable that selects the default
+// programmer when --programmer is not given.
+const programmerEnv = "CUPL_PROGRAMMER"
+
+// programmer holds the command templates a device programmer runs. Each is
+// an argv whose {device} and {file} placeholders are filled in per burn; a
+// nil template means the programmer cannot perform that step.
+type programmer struct {
+	write  []string
+	verify []string // compares the part against {file}, failing on a mismatch
+	read   []string // reads the part into {file}
+	// device maps the device named in a JEDEC header, and the file's *QF
+	// fuse count, to the programmer's name for the part; nil passes the name
+	// through. A -p device is never mapped.
+	device func(name string, fuses int) (string, error)
+}
+
+var programmers = map[string]programmer{
+	"minipro": {
+		write:  []string{"minipro", "-p", "{device}", "-w", "{file}"},
+		verify: []string{"minipro", "-p", "{device}", "-m", "{file}"},
+		read:   []string{"minipro", "-p", "{device}", "-r", "{file}"},
+	},
+	// afterburner_gal prints a read to stdout rather than to a file, so it
+	// has no read template.
+	"afterburner": {
+		write:  []string{"afterburner_gal", "w", "-t", "{device}", "-f", "{file}"},
+		verify: []string{"afterburner_gal", "v", "-t", "{device}", "-f", "{file}"},
+		device: afterburnerDevice,
+	},
+}
+
+const defaultProgrammer = "minipro"
+
+// lookupProgrammer resolves a --programmer value, falling back to
+// $CUPL_PROGRAMMER and then minipro. A value containing a {file} placeholder
+// is a command template for a programmer without an entry, e.g. an in-house
+// jig; it can only write.
+func lookupProgrammer(name string) (programmer, string, error) {
+	if name == "" {
+		name = os.Getenv(programmerEnv)
+	}
+	if name == "" {
+		name = defaultProgrammer
+	}
+	if strings.Contains(name, "{file}") {
+		return programmer{write: strings.Fields(name)}, name, nil
+	}
+	p, ok := programmers[name]
+	if !ok {
+		names := make([]string, 0, len(programmers))
+		for n := range programmers {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return programmer{}, "", fmt.Errorf("unknown programmer %q (known: %s; or give a command template with {device} and {file})", name, strings.Join(names, ", "))
+	}
+	return p, name, nil
+}
+
+// afterburnerDevice maps a device mnemonic to the GAL type afterburner's -t
+// takes: GAL16V8, GAL20V8 or GAL22V10, or ATF16V8B and ATF22V10C for the
+// Atmel parts. Our own headers name an Atmel part like its Lattice
+// equivalent, so its extra power-down fuse in the count identifies it too.
+func afterburnerDevice(name string, fuses int) (string, error) {
+	chip, err := gal.ParseChip(name)
+	if err != nil {
+		return "", err
+	}
+	if atmel, _ := gal.ParseAtmel(name); atmel || chip.HasAtmelVariant() && fuses == chip.TotalSize()+1 {
+		switch chip {
+		case gal.ChipGAL16V8:
+			return "ATF16V8B", nil
+		case gal.ChipGAL22V10:
+			return "ATF22V10C", nil
+		}
+	}
+	return chip.Name(), nil
+}
+
+// programmerArgv fills in a command template's placeholders.
+func programmerArgv(template []string, device, file string) []string {
+	r := strings.NewReplacer("{device}", device, "{file}", file)
+	argv := make([]string, len(template))
+	for i, arg := range template {
+		argv[i] = r.Replace(arg)
+	}
+	return argv
+}
+
+// formatArgv renders an argv for display, quoting arguments that a shell
+// would split or expand.
+func formatArgv(argv []string) string {
+	out := make([]string, len(argv))
+	for i, arg := range argv {
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\$*?;&|<>()") {
+			arg = strconv.Quote(arg)
+		}
+		out[i] = arg
+	}
+	return strings.Join(out, " ")
+}
+
+// runProgrammer runs a command template with its placeholders filled in.
+func runProgrammer(template []string, device, file string) error {
+	argv := programmerArgv(template, device, file)
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
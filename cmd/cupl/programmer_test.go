@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestAfterburnerDevice(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		fuses int
+		want  string
+	}{
+		{"g16v8as", 2194, "GAL16V8"},
+		{"GAL20V8", 2706, "GAL20V8"},
+		{"g22v10", 5892, "GAL22V10"},
+		{"atf16v8", 2195, "ATF16V8B"},
+		{"ATF22V10C", 5893, "ATF22V10C"},
+		// cupl build names an Atmel part like its GAL equivalent; the
+		// power-down fuse gives it away.
+		{"22v10", 5893, "ATF22V10C"},
+	} {
+		got, err := afterburnerDevice(tc.name, tc.fuses)
+		if err != nil || got != tc.want {
+			t.Errorf("afterburnerDevice(%q, %d) = %q, %v, want %q", tc.name, tc.fuses, got, err, tc.want)
+		}
+	}
+	if _, err := afterburnerDevice("pal16l8", 2048); err == nil {
+		t.Error("pal16l8: got no error")
+	}
+}
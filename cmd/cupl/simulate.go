@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	cupllang "github.com/pborges/cupl/internal/cupl"
+)
+
+// cmdSimulate evaluates a design's combinatorial outputs for the name=0|1
+// input values given after the .pld.
+func cmdSimulate(args []string) error {
+	if len(args) < 1 {
+		return errors.New("simulate requires a .pld input followed by name=0|1 values")
+	}
+	inputs := make(map[string]bool)
+	for _, arg := range args[1:] {
+		name, val, ok := strings.Cut(arg, "=")
+		if !ok || name == "" || (val != "0" && val != "1") {
+			return fmt.Errorf("invalid input %q, want name=0 or name=1", arg)
+		}
+		inputs[name] = val == "1"
+	}
+	content, err := cupllang.ParseFile(args[0])
+	if err != nil {
+		return err
+	}
+	res, err := cupllang.CompileDetailed(content)
+	if err != nil {
+		return err
+	}
+	printWarnings(args[0], res.Warnings)
+	outputs, err := cupllang.Simulate(content, res, inputs)
+	if err != nil {
+		return err
+	}
+	var skipped []string
+	for _, o := range outputs {
+		switch {
+		case o.Skipped != "":
+			skipped = append(skipped, fmt.Sprintf("%s (%s)", o.Name, o.Skipped))
+		case o.Disabled:
+			fmt.Printf("%-10s pin %-3d Z (output disabled)\n", o.Name, o.Pin)
+		default:
+			fmt.Printf("%-10s pin %-3d %d\n", o.Name, o.Pin, boolToInt(o.Value))
+		}
+	}
+	for _, s := range skipped {
+		fmt.Printf("skipped: %s\n", s)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/pborges/cupl/internal/jed"
+)
+
+// errMismatch is returned by verify when the fuse maps differ; the diff has
+// already been printed.
+var errMismatch = errors.New("fuse maps differ")
+
+func cmdVerify(args []string) error {
+	if len(args) != 2 {
+		return errors.New("verify requires two .jed inputs")
+	}
+	files, err := readJEDECFiles(args)
+	if err != nil {
+		return err
+	}
+	if diff := jed.Diff(files[0], files[1]); diff != "" {
+		fmt.Printf("%s (got) vs %s (want): %s", args[0], args[1], diff)
+		return errMismatch
+	}
+	fmt.Printf("%s and %s match (%d fuses)\n", args[0], args[1], files[0].QF)
+	return nil
+}
+
+// cmdDiff prints every fuse that differs between two .jed files with its
+// section name, followed by a count. Unlike verify it does not truncate the
+// list, and it accepts a GAL file against its Atmel equivalent.
+func cmdDiff(args []string) error {
+	if len(args) != 2 {
+		return errors.New("diff requires two .jed inputs")
+	}
+	files, err := readJEDECFiles(args)
+	if err != nil {
+		return err
+	}
+	diffs, err := jed.DiffFuses(files[0], files[1])
+	if err != nil {
+		return fmt.Errorf("%s vs %s: %w", args[0], args[1], err)
+	}
+	for _, d := range diffs {
+		fmt.Printf("fuse %5d  %-36s %s=%d %s=%d\n", d.Fuse, d.Section, args[0], boolToInt(d.Got), args[1], boolToInt(d.Want))
+	}
+	total := len(files[0].Fuses)
+	if len(files[1].Fuses) > total {
+		total = len(files[1].Fuses)
+	}
+	fmt.Printf("%d of %d fuses differ\n", len(diffs), total)
+	if len(diffs) > 0 {
+		return errMismatch
+	}
+	return nil
+}
+
+func readJEDECFiles(paths []string) ([]jed.File, error) {
+	files := make([]jed.File, len(paths))
+	for i, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		files[i], err = jed.Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return files, nil
+}
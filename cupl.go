@@ -0,0 +1,63 @@
+package cupl
+
+import (
+	"sort"
+
+	cupllang "github.com/pborges/cupl/internal/cupl"
+	"github.com/pborges/cupl/internal/jed"
+)
+
+// Pin is a device pin assigned by a PIN declaration.
+type Pin struct {
+	Number    int
+	Name      string
+	ActiveLow bool
+}
+
+// Result is a compiled design.
+type Result struct {
+	// Device is the target chip name, e.g. "GAL16V8".
+	Device string
+	// Pins lists the assigned pins in pin-number order.
+	Pins []Pin
+	// JEDEC is the generated JEDEC file, identical to `cupl build` output.
+	JEDEC []byte
+	// Warnings flag a design that fits but barely, e.g. an output using
+	// every product term of its OLMC.
+	Warnings []string
+}
+
+// Compile parses and compiles WinCUPL source into a JEDEC fuse map.
+func Compile(src []byte) (*Result, error) {
+	content, err := cupllang.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	compiled, err := cupllang.CompileDetailed(content)
+	if err != nil {
+		return nil, err
+	}
+	g := compiled.GAL
+	res := &Result{
+		Device:   g.Chip.Name(),
+		Warnings: compiled.Warnings,
+		JEDEC: []byte(jed.MakeJEDEC(jed.Config{
+			Header:        jed.HeaderLines(Version(), g.Chip, content.Meta, content.MetaOrder),
+			UserSignature: content.UserSignature(),
+		}, g)),
+	}
+	for num, def := range content.Pins {
+		res.Pins = append(res.Pins, Pin{Number: num, Name: def.Name, ActiveLow: def.ActiveLow})
+	}
+	sort.Slice(res.Pins, func(i, j int) bool { return res.Pins[i].Number < res.Pins[j].Number })
+	return res, nil
+}
+
+// Build compiles WinCUPL source and returns the JEDEC file contents.
+func Build(src []byte) ([]byte, error) {
+	res, err := Compile(src)
+	if err != nil {
+		return nil, err
+	}
+	return res.JEDEC, nil
+}
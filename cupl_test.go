@@ -0,0 +1,59 @@
+package cupl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pborges/cupl/examples"
+	"github.com/pborges/cupl/internal/jed"
+)
+
+func TestCompile(t *testing.T) {
+	src, err := examples.FS.ReadFile("r_22v10_reg.pld")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Compile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Device != "GAL22V10" {
+		t.Errorf("device = %q, want GAL22V10", res.Device)
+	}
+	if len(res.Pins) != 19 || res.Pins[0] != (Pin{Number: 1, Name: "Clock"}) {
+		t.Errorf("unexpected pins %v", res.Pins)
+	}
+	if oe := res.Pins[10]; oe != (Pin{Number: 13, Name: "OE", ActiveLow: true}) {
+		t.Errorf("pin 13 = %v, want active-low OE", oe)
+	}
+	j, err := jed.Parse(res.JEDEC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.QF != 5892 {
+		t.Errorf("QF = %d, want 5892", j.QF)
+	}
+}
+
+func TestCompileHeaderOrder(t *testing.T) {
+	src := "Designer Jane;\nNAME Demo;\nREV DATE 2026-10-01;\nPartno 01;\nUserid ABC;\nDevice g16v8;\nPin 2 = A;\nPin 19 = Y;\nY = A;\n"
+	res, err := Compile([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var header []string
+	for _, line := range strings.Split(strings.TrimPrefix(string(res.JEDEC), "\x02"), "\n") {
+		if strings.HasPrefix(line, "*") {
+			break
+		}
+		if line == "" {
+			continue
+		}
+		header = append(header, strings.Join(strings.Fields(line), " "))
+	}
+	want := []string{"CUPlang " + Version(), "Device 16v8", "Designer Jane", "Name Demo", "REV DATE 2026-10-01", "Partno 01"}
+	if !reflect.DeepEqual(header, want) {
+		t.Errorf("header = %q, want %q", header, want)
+	}
+}
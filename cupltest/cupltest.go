@@ -0,0 +1,87 @@
+// Package cupltest checks the compiler against a corpus of WinCUPL designs
+// and the JEDEC files WinCUPL built from them.
+package cupltest
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	cupllang "github.com/pborges/cupl/internal/cupl"
+	"github.com/pborges/cupl/internal/jed"
+	"github.com/pborges/cupl/internal/testutil"
+)
+
+// Mismatch is a golden pair the compiler does not reproduce.
+type Mismatch struct {
+	PLD string // source path in the FS
+	JED string // expected JEDEC path in the FS, "" if there is none
+	Err error  // the read, parse or compile error, or the fuse difference
+}
+
+func (m Mismatch) Error() string {
+	return fmt.Sprintf("%s: %v", m.PLD, m.Err)
+}
+
+// RunGoldenDir compiles every source in fsys matching pattern, as for
+// fs.Glob, and compares its fuses with the sibling .jed (or .JED) of the
+// same base name. Header and note fields are not compared. $INCLUDE paths
+// resolve within fsys. It returns one Mismatch per source that fails, in
+// pattern match order, or nil if all of them match.
+func RunGoldenDir(fsys fs.FS, pattern string) []Mismatch {
+	matches, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return []Mismatch{{PLD: pattern, Err: err}}
+	}
+	var mismatches []Mismatch
+	for _, pldPath := range matches {
+		jedPath, err := goldenPath(fsys, pldPath)
+		if err == nil {
+			err = compareGolden(fsys, pldPath, jedPath)
+		}
+		if err != nil {
+			mismatches = append(mismatches, Mismatch{PLD: pldPath, JED: jedPath, Err: err})
+		}
+	}
+	return mismatches
+}
+
+// goldenPath finds the JEDEC file next to pldPath.
+func goldenPath(fsys fs.FS, pldPath string) (string, error) {
+	base := strings.TrimSuffix(pldPath, path.Ext(pldPath))
+	for _, ext := range []string{".jed", ".JED"} {
+		if _, err := fs.Stat(fsys, base+ext); err == nil {
+			return base + ext, nil
+		}
+	}
+	return "", errors.New("no .jed file")
+}
+
+func compareGolden(fsys fs.FS, pldPath, jedPath string) error {
+	src, err := fs.ReadFile(fsys, pldPath)
+	if err != nil {
+		return err
+	}
+	want, err := fs.ReadFile(fsys, jedPath)
+	if err != nil {
+		return err
+	}
+	content, err := cupllang.ParseWithOptions(src, cupllang.ParseOptions{FS: fsys, File: pldPath})
+	if err != nil {
+		return fmt.Errorf("parse: %w", err)
+	}
+	g, err := cupllang.Compile(content)
+	if err != nil {
+		return fmt.Errorf("compile: %w", err)
+	}
+	diff, err := testutil.DiffJEDEC([]byte(jed.MakeJEDEC(jed.Config{}, g)), want)
+	if err != nil {
+		return err
+	}
+	if diff != "" {
+		return errors.New(diff)
+	}
+	return nil
+}
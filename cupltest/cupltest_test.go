@@ -0,0 +1,54 @@
+package cupltest
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/pborges/cupl/examples"
+)
+
+func TestRunGoldenDirExamples(t *testing.T) {
+	for _, pattern := range []string{"*.pld", "*.PLD"} {
+		for _, m := range RunGoldenDir(examples.FS, pattern) {
+			t.Error(m)
+		}
+	}
+}
+
+func TestRunGoldenDirMismatches(t *testing.T) {
+	want, err := examples.FS.ReadFile("_constant_output.jed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := examples.FS.ReadFile("_constant_output.pld")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{
+		"lib/ok.pld":     {Data: src},
+		"lib/ok.JED":     {Data: want},
+		"lib/bad.pld":    {Data: []byte("Device g16v8;\nPin 2 = A;\nPin 19 = Y;\nY = A;\n")},
+		"lib/bad.jed":    {Data: want},
+		"lib/broken.pld": {Data: []byte("Device g16v8;\nPin 19 = Y;\nY = ;\n")},
+		"lib/broken.jed": {Data: want},
+		"lib/lonely.pld": {Data: src},
+	}
+	got := RunGoldenDir(fsys, "lib/*.pld")
+	var paths []string
+	for _, m := range got {
+		paths = append(paths, m.PLD)
+	}
+	if strings.Join(paths, " ") != "lib/bad.pld lib/broken.pld lib/lonely.pld" {
+		t.Fatalf("mismatches %v, want bad, broken and lonely", got)
+	}
+	if got[0].JED != "lib/bad.jed" || !strings.Contains(got[0].Err.Error(), "fuse") {
+		t.Errorf("bad: %+v, want a fuse difference against lib/bad.jed", got[0])
+	}
+	if !strings.HasPrefix(got[1].Err.Error(), "parse: ") {
+		t.Errorf("broken: %v, want a parse error", got[1].Err)
+	}
+	if got[2].JED != "" {
+		t.Errorf("lonely: JED = %q, want none", got[2].JED)
+	}
+}
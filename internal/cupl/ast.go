@@ -1,16 +1,64 @@
 package cupl
 
+import (
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"strings"
+)
+
 type Content struct {
 	Meta      map[string]string
+	MetaOrder []string // Meta keys in source order
 	Device    string
 	Pins      map[int]PinDef
+	Nodes     map[int]PinDef // buried OLMC nodes from PINNODE, keyed by node number
 	Fields    map[string]Field
 	Equations []Equation
+	Order     []string     // signal names from ORDER:, one per vector column
+	Vectors   []TestVector // rows of the VECTORS: section
+	// MinLevel is the minimization level 0-4 from MIN. Parse sets
+	// DefaultMinLevel when the source has no MIN, but the zero value of a
+	// Content built by hand is level 0: terms are placed as written.
+	MinLevel  int
+	MinLevels map[string]int      // per-output overrides of MinLevel from MIN name = level
+	Rows      map[string]int      // first product term row per output from ROW name = row
+	Constants map[string]Constant // NAME = <number>; equations, for field:NAME comparisons
+}
+
+// Constant is the value of an equation whose right-hand side is a single
+// number, such as ROM = 'h'E000;. A field comparison may name it in place
+// of the number.
+type Constant struct {
+	Value uint64
+	Mask  uint64 // 1=care, 0=don't-care
+	Line  int
+}
+
+// DefaultMinLevel is the minimization level used when the source has no MIN
+// directive. Level 0 disables Quine-McCluskey minimization.
+const (
+	DefaultMinLevel = 1
+	MaxMinLevel     = 4
+)
+
+// MaxUserSignature is the size in bytes of the GAL electronic signature.
+const MaxUserSignature = 8
+
+// UserSignature returns the USERID header value, or nil if there is none.
+// It is programmed into the SIG fuses in place of Partno and emitted as the
+// JEDEC *U field, so the two always agree.
+func (c Content) UserSignature() []byte {
+	if id := strings.TrimSpace(c.Meta["Userid"]); id != "" {
+		return []byte(id)
+	}
+	return nil
 }
 
 type PinDef struct {
 	Name      string
 	ActiveLow bool
+	Line      int // source line of the PIN or PINNODE statement
 }
 
 type Field struct {
@@ -22,6 +70,15 @@ type FieldBit struct {
 	Name      string
 	BitNumber int
 	HasNumber bool
+	Neg       bool // listed as !Name: the field bit is the signal's complement
+}
+
+// TestVector is one row of the VECTORS: section. Values holds one character
+// per ORDER signal: 0/1 to drive an input, C to pulse a clock, and H/L/Z/X for
+// the expected output.
+type TestVector struct {
+	Line   int
+	Values string
 }
 
 type Equation struct {
@@ -29,13 +86,22 @@ type Equation struct {
 	LHS    string
 	Expr   Expr
 	Append bool
+
+	// DontCare matches inputs the equation leaves unspecified, such as the
+	// values no TABLE row lists. The minimizer may cover them or not.
+	DontCare Expr
 }
 
 // Expr AST
 
 type Expr interface{ isExpr() }
 
-type ExprIdent struct{ Name string }
+type ExprIdent struct {
+	Name string
+	// Feedback is the feedback source named by a .IO ("IO") or .Q/.DQ ("Q")
+	// extension, or "" for the OLMC's default feedback.
+	Feedback string
+}
 
 func (ExprIdent) isExpr() {}
 
@@ -63,6 +129,11 @@ type ExprFieldRange struct {
 	Field string
 	Lo    uint64
 	Hi    uint64
+	// LoConst and HiConst name the Constants a bound was written as;
+	// Compile fills in Lo and Hi from them. A name that reads as a hex
+	// number (BEEF) is parsed as that number.
+	LoConst string `json:",omitempty"`
+	HiConst string `json:",omitempty"`
 }
 
 func (ExprFieldRange) isExpr() {}
@@ -71,6 +142,10 @@ type ExprFieldEquality struct {
 	Field string
 	Value uint64
 	Mask  uint64 // 1=care, 0=don't-care
+	// Const names the Constant the value was written as; Compile fills in
+	// Value and Mask from it. A name that reads as a hex number (BEEF) is
+	// parsed as that number.
+	Const string `json:",omitempty"`
 }
 
 func (ExprFieldEquality) isExpr() {}
@@ -82,3 +157,245 @@ type ExprIdentList struct {
 }
 
 func (ExprIdentList) isExpr() {}
+
+// Operator precedence in ExprString, matching exprParser: $ binds loosest,
+// then #, &, and ! tightest.
+const (
+	precXor = iota + 1
+	precOr
+	precAnd
+	precNot
+	precPrimary
+)
+
+// ExprString renders e in CUPL notation with only the parentheses the
+// parser needs to rebuild the same tree: binary operators group to the
+// left, so a right operand of equal precedence is parenthesized. Constants
+// print as 'b'0 and 'b'1, field values in hex, or binary when they have
+// don't-care bits.
+func ExprString(e Expr) string {
+	s, _ := exprString(e)
+	return s
+}
+
+// exprString returns e's text and the precedence of its outermost operator.
+func exprString(e Expr) (string, int) {
+	switch e := e.(type) {
+	case ExprIdent:
+		if e.Feedback != "" {
+			return e.Name + "." + e.Feedback, precPrimary
+		}
+		return e.Name, precPrimary
+	case ExprConst:
+		if e.Value {
+			return "'b'1", precPrimary
+		}
+		return "'b'0", precPrimary
+	case ExprNot:
+		return "!" + operand(e.X, precNot), precNot
+	case ExprAnd:
+		return operand(e.A, precAnd) + " & " + operand(e.B, precAnd+1), precAnd
+	case ExprOr:
+		return operand(e.A, precOr) + " # " + operand(e.B, precOr+1), precOr
+	case ExprXor:
+		return operand(e.A, precXor) + " $ " + operand(e.B, precXor+1), precXor
+	case ExprFieldEquality:
+		if e.Const != "" {
+			return e.Field + ":" + e.Const, precPrimary
+		}
+		return e.Field + ":" + fieldValueString(e.Value, e.Mask), precPrimary
+	case ExprFieldRange:
+		lo, hi := e.LoConst, e.HiConst
+		if lo == "" {
+			lo = fmt.Sprintf("'h'%X", e.Lo)
+		}
+		if hi == "" {
+			hi = fmt.Sprintf("'h'%X", e.Hi)
+		}
+		return fmt.Sprintf("%s:[%s..%s]", e.Field, lo, hi), precPrimary
+	case ExprIdentList:
+		return "[" + strings.Join(e.Names, ", ") + "]", precPrimary
+	}
+	return fmt.Sprintf("%v", e), precPrimary
+}
+
+// operand renders x, parenthesized if it binds looser than min.
+func operand(x Expr, min int) string {
+	s, prec := exprString(x)
+	if prec < min {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+// fieldValueString renders a field comparison value as the parser reads it
+// back: hex digits when every bit up to the mask's width is cared about,
+// otherwise binary with X for the don't-care bits.
+func fieldValueString(value, mask uint64) string {
+	width := bits.Len64(mask)
+	if width%4 == 0 && width > 0 && mask == ^uint64(0)>>(64-width) {
+		return fmt.Sprintf("'h'%0*X", width/4, value)
+	}
+	if width == 0 {
+		return "'b'X"
+	}
+	var b strings.Builder
+	b.WriteString("'b'")
+	for i := width - 1; i >= 0; i-- {
+		switch {
+		case mask&(1<<uint(i)) == 0:
+			b.WriteByte('X')
+		case value&(1<<uint(i)) != 0:
+			b.WriteByte('1')
+		default:
+			b.WriteByte('0')
+		}
+	}
+	return b.String()
+}
+
+// JSON encoding. Each expression node is an object whose "Type" names the
+// node (Ident, Not, And, ...) next to its fields, so a decoder can rebuild
+// the Expr interface; Equation.UnmarshalJSON does that for Content.
+
+func marshalNode(typ string, node interface{}) ([]byte, error) {
+	fields, err := json.Marshal(node)
+	if err != nil {
+		return nil, err
+	}
+	out := []byte(fmt.Sprintf(`{"Type":%q`, typ))
+	if len(fields) > 2 {
+		out = append(append(out, ','), fields[1:]...)
+	} else {
+		out = append(out, '}')
+	}
+	return out, nil
+}
+
+func (e ExprIdent) MarshalJSON() ([]byte, error) {
+	type plain ExprIdent
+	return marshalNode("Ident", plain(e))
+}
+
+func (e ExprNot) MarshalJSON() ([]byte, error) {
+	type plain ExprNot
+	return marshalNode("Not", plain(e))
+}
+
+func (e ExprAnd) MarshalJSON() ([]byte, error) {
+	type plain ExprAnd
+	return marshalNode("And", plain(e))
+}
+
+func (e ExprOr) MarshalJSON() ([]byte, error) {
+	type plain ExprOr
+	return marshalNode("Or", plain(e))
+}
+
+func (e ExprXor) MarshalJSON() ([]byte, error) {
+	type plain ExprXor
+	return marshalNode("Xor", plain(e))
+}
+
+func (e ExprConst) MarshalJSON() ([]byte, error) {
+	type plain ExprConst
+	return marshalNode("Const", plain(e))
+}
+
+func (e ExprFieldRange) MarshalJSON() ([]byte, error) {
+	type plain ExprFieldRange
+	return marshalNode("FieldRange", plain(e))
+}
+
+func (e ExprFieldEquality) MarshalJSON() ([]byte, error) {
+	type plain ExprFieldEquality
+	return marshalNode("FieldEquality", plain(e))
+}
+
+func (e ExprIdentList) MarshalJSON() ([]byte, error) {
+	type plain ExprIdentList
+	return marshalNode("IdentList", plain(e))
+}
+
+// unmarshalExpr decodes an expression written by the nodes' MarshalJSON.
+// A missing value or JSON null decodes to a nil Expr.
+func unmarshalExpr(data []byte) (Expr, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+	var node struct {
+		Type string
+		X    json.RawMessage
+		A, B json.RawMessage
+	}
+	if err := json.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	binary := func() (Expr, Expr, error) {
+		a, err := unmarshalExpr(node.A)
+		if err != nil {
+			return nil, nil, err
+		}
+		b, err := unmarshalExpr(node.B)
+		return a, b, err
+	}
+	switch node.Type {
+	case "":
+		return nil, fmt.Errorf("expression without a Type: %s", data)
+	case "Ident":
+		var e ExprIdent
+		err := json.Unmarshal(data, &e)
+		return e, err
+	case "Not":
+		x, err := unmarshalExpr(node.X)
+		return ExprNot{X: x}, err
+	case "And":
+		a, b, err := binary()
+		return ExprAnd{A: a, B: b}, err
+	case "Or":
+		a, b, err := binary()
+		return ExprOr{A: a, B: b}, err
+	case "Xor":
+		a, b, err := binary()
+		return ExprXor{A: a, B: b}, err
+	case "Const":
+		var e ExprConst
+		err := json.Unmarshal(data, &e)
+		return e, err
+	case "FieldRange":
+		var e ExprFieldRange
+		err := json.Unmarshal(data, &e)
+		return e, err
+	case "FieldEquality":
+		var e ExprFieldEquality
+		err := json.Unmarshal(data, &e)
+		return e, err
+	case "IdentList":
+		var e ExprIdentList
+		err := json.Unmarshal(data, &e)
+		return e, err
+	default:
+		return nil, fmt.Errorf("unknown expression type %q", node.Type)
+	}
+}
+
+func (eq *Equation) UnmarshalJSON(data []byte) error {
+	type plain Equation
+	var raw struct {
+		*plain
+		Expr     json.RawMessage
+		DontCare json.RawMessage
+	}
+	raw.plain = (*plain)(eq)
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	var err error
+	if eq.Expr, err = unmarshalExpr(raw.Expr); err != nil {
+		return fmt.Errorf("line %d: %w", eq.Line, err)
+	}
+	if eq.DontCare, err = unmarshalExpr(raw.DontCare); err != nil {
+		return fmt.Errorf("line %d: %w", eq.Line, err)
+	}
+	return nil
+}
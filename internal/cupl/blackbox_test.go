@@ -49,15 +49,11 @@ func TestBlackbox(t *testing.T) {
 }
 
 func compareJEDEC(t *testing.T, gotJed string, expected []byte) {
-	got, err := testutil.ParseJEDEC([]byte(gotJed))
+	diff, err := testutil.DiffJEDEC([]byte(gotJed), expected)
 	if err != nil {
-		t.Fatalf("parse got jed: %v", err)
-	}
-	want, err := testutil.ParseJEDEC(expected)
-	if err != nil {
-		t.Fatalf("parse expected jed: %v", err)
+		t.Fatal(err)
 	}
-	if diff := testutil.CompareJEDEC(got, want); diff != "" {
+	if diff != "" {
 		t.Fatalf("%s", diff)
 	}
 }
@@ -2,6 +2,7 @@ package cupl
 
 import (
 	"fmt"
+	"reflect"
 	"sort"
 	"strings"
 
@@ -13,16 +14,234 @@ type Symbol struct {
 	ActiveLow bool
 }
 
+// CompileResult is a compiled design along with what it was built from.
+type CompileResult struct {
+	GAL *gal.GAL
+	// Blueprint holds the placed product terms of each OLMC and global
+	// signal. Feedback from registered active-high GAL22V10 outputs is
+	// already inverted, see Blueprint.NeedsFeedbackFlip.
+	Blueprint *gal.Blueprint
+	Symbols   map[string]Symbol
+	Mode      gal.Mode // GAL16V8/GAL20V8 operating mode; ModeAuto otherwise
+	Outputs   []OutputTerms
+	// Equations are the source equations after field and set assignments
+	// were expanded into one equation per bit.
+	Equations []Equation
+	// Warnings flag designs that compile but barely fit, such as an output
+	// using every product term row of its OLMC, and declared pins, nodes and
+	// fields that no equation uses (see IsUnusedWarning).
+	Warnings []string
+}
+
+// unusedSuffix ends every warning about an unused declaration.
+const unusedSuffix = " is declared but never used"
+
+// IsUnusedWarning reports whether a CompileResult warning is about a
+// declared pin, node or field that no equation uses. Such warnings do not
+// affect the fuse map; the CLI only prints them with -v.
+func IsUnusedWarning(w string) bool {
+	return strings.HasSuffix(w, unusedSuffix)
+}
+
+// OutputTerms records an output's sum of products before and after
+// minimization, including polarity selection.
+type OutputTerms struct {
+	Name      string
+	Pin       int
+	Line      int    // line of the output's first equation
+	Extension string // "", "R" (registered) or "T" (tristate)
+	Terms     []Term // as written, with APPEND equations merged
+	Minimized []Term // as placed in the OLMC
+	MaxTerms  int    // product term rows the OLMC has for the output
+}
+
+// CompileOptions configures CompileWithOptions.
+type CompileOptions struct {
+	// Minimizer reduces each output's product terms; nil uses
+	// QuineMcCluskey. It is not called at minimization level 0.
+	Minimizer Minimizer
+	// DontCares lets the minimizer use input values a TABLE does not list,
+	// and inputs matching no IF of a CONDITION without a DEFAULT, as
+	// don't-cares. By default those inputs drive the outputs to 0, as in
+	// WinCUPL and Simulate.
+	DontCares bool
+	// NoMinimize keeps every output's product terms as written, as at MIN
+	// level 0, overriding both MIN and per-output MIN name = level.
+	NoMinimize bool
+}
+
 // Compile builds a GAL fuse map from CUPL content.
 func Compile(c Content) (*gal.GAL, error) {
+	return CompileWithOptions(c, CompileOptions{})
+}
+
+// CompileWithOptions is Compile with a choice of minimizer.
+func CompileWithOptions(c Content, opts CompileOptions) (*gal.GAL, error) {
+	res, err := CompileDetailedWithOptions(c, opts)
+	if err != nil {
+		return nil, err
+	}
+	return res.GAL, nil
+}
+
+// CompileDetailed compiles CUPL content like Compile and also returns the
+// symbol table, the selected mode and each output's product terms.
+func CompileDetailed(c Content) (*CompileResult, error) {
+	return CompileDetailedWithOptions(c, CompileOptions{})
+}
+
+// CompileBlueprint compiles CUPL content to the blueprint Compile builds the
+// fuse map from: the minimized product terms of each OLMC and global signal.
+//
+// Deprecated: use CompileDetailed, whose Blueprint field is the same value.
+func CompileBlueprint(c Content) (*gal.Blueprint, error) {
+	res, err := CompileDetailed(c)
+	if err != nil {
+		return nil, err
+	}
+	return res.Blueprint, nil
+}
+
+// CompileDetailedWithOptions is CompileDetailed with a choice of minimizer.
+func CompileDetailedWithOptions(c Content, opts CompileOptions) (*CompileResult, error) {
+	m := opts.Minimizer
+	if m == nil {
+		m = QuineMcCluskey
+	}
+	if opts.NoMinimize {
+		c.MinLevel, c.MinLevels = 0, nil
+	}
+	if !opts.DontCares {
+		eqs := make([]Equation, len(c.Equations))
+		for i, eq := range c.Equations {
+			eq.DontCare = nil
+			eqs[i] = eq
+		}
+		c.Equations = eqs
+	}
+	res, err := compileDesign(c, m)
+	if err != nil {
+		return nil, err
+	}
+	res.GAL, err = gal.BuildGAL(*res.Blueprint)
+	if err != nil {
+		return nil, err
+	}
+	res.Mode = res.GAL.Mode()
+
+	chip := res.Blueprint.Chip
+	for i, out := range res.Outputs {
+		olmc, _ := chip.PinToOLMC(out.Pin)
+		max := chip.NumRowsForOLMC(olmc)
+		if oeRowReserved(chip, res.Mode, out.Extension) {
+			max--
+		}
+		// Rows skipped by ROW are not available to the output.
+		max -= res.Blueprint.OLMC[olmc].FirstRow
+		res.Outputs[i].MaxTerms = max
+		if len(out.Minimized) >= max {
+			res.Warnings = append(res.Warnings, fmt.Sprintf("line %d: output %s uses %d/%d product terms", out.Line, out.Name, len(out.Minimized), max))
+		}
+	}
+	if partno := strings.TrimSpace(c.Meta["Partno"]); len(partno) > MaxUserSignature && c.UserSignature() == nil {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("Partno %q is longer than %d bytes; the signature holds %q", partno, MaxUserSignature, partno[:MaxUserSignature]))
+	}
+	res.Warnings = append(res.Warnings, unusedDeclarations(c, res)...)
+	return res, nil
+}
+
+// partnoSignature packs Partno into the electronic signature as WinCUPL
+// does: left-justified, padded with NULs and cut to MaxUserSignature bytes.
+// The Name field is not used.
+func partnoSignature(partno string) []byte {
+	sig := make([]byte, MaxUserSignature)
+	copy(sig, partno)
+	return sig
+}
+
+// unusedDeclarations reports the pins, nodes and fields that no equation
+// names, on either side. A field counts as used when any equation names the
+// field itself; using its bits one by one does not. Pins the device
+// dedicates to the register clock and output enable are not reported, since
+// they need no equation.
+func unusedDeclarations(c Content, res *CompileResult) []string {
+	used := make(map[string]bool)
+	for _, eq := range c.Equations {
+		if info, err := parseEquationLHS(eq.LHS); err == nil {
+			used[info.Name] = true
+		}
+		walkNames(eq.Expr, func(name string) { used[name] = true })
+		walkNames(eq.DontCare, func(name string) { used[name] = true })
+	}
+	for name := range used {
+		if f, ok := c.Fields[name]; ok {
+			for _, b := range f.Bits {
+				used[b.Name] = true
+			}
+		}
+	}
+
+	registered := false
+	for _, out := range res.Outputs {
+		registered = registered || out.Extension == "R"
+	}
+	dedicated := make(map[int]bool)
+	switch chip := res.Blueprint.Chip; {
+	case chip == gal.ChipGAL22V10 && registered:
+		dedicated[1] = true
+	case res.Mode == gal.ModeRegistered:
+		dedicated[1] = true
+		dedicated[chip.NumPins()/2+1] = true
+	}
+
+	var lint []string
+	report := func(kind string, defs map[int]PinDef) {
+		nums := make([]int, 0, len(defs))
+		for n := range defs {
+			nums = append(nums, n)
+		}
+		sort.Ints(nums)
+		for _, n := range nums {
+			def := defs[n]
+			if used[def.Name] || kind == "pin" && dedicated[n] {
+				continue
+			}
+			lint = append(lint, fmt.Sprintf("line %d: %s %d (%s)%s", def.Line, kind, n, def.Name, unusedSuffix))
+		}
+	}
+	report("pin", c.Pins)
+	report("node", c.Nodes)
+	names := make([]string, 0, len(c.Fields))
+	for name := range c.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !used[name] {
+			lint = append(lint, fmt.Sprintf("field %s%s", name, unusedSuffix))
+		}
+	}
+	return lint
+}
+
+// compileDesign compiles CUPL content to the blueprint the fuse map is
+// built from, reducing product terms with m.
+func compileDesign(c Content, m Minimizer) (*CompileResult, error) {
 	chip, err := gal.ParseChip(c.Device)
 	if err != nil {
 		return nil, err
 	}
 	bp := gal.NewBlueprint(chip)
 	bp.ModeHint = gal.ParseModeHint(c.Device)
+	bp.Atmel, bp.PowerDown = gal.ParseAtmel(c.Device)
 	if partno := strings.TrimSpace(c.Meta["Partno"]); partno != "" {
-		bp.Sig = []byte(partno)
+		bp.Sig = partnoSignature(partno)
+	}
+	if uid := c.UserSignature(); uid != nil {
+		if len(uid) > MaxUserSignature {
+			return nil, fmt.Errorf("USERID %q is longer than %d bytes", uid, MaxUserSignature)
+		}
+		bp.Sig = uid
 	}
 
 	symbols := make(map[string]Symbol)
@@ -30,15 +249,55 @@ func Compile(c Content) (*gal.GAL, error) {
 		if pin < 1 || pin > chip.NumPins() {
 			return nil, fmt.Errorf("pin %d out of range for %s", pin, chip.Name())
 		}
-		bp.Pins[pin-1] = def.Name
+		bp.Pins[pin-1] = gal.PinDef{Name: def.Name, ActiveLow: def.ActiveLow}
+		symbols[def.Name] = Symbol{Pin: pin, ActiveLow: def.ActiveLow}
+	}
+	// A node is the feedback of an OLMC whose package pin is left unassigned,
+	// so references resolve to that OLMC's pin.
+	for node, def := range c.Nodes {
+		olmc, ok := chip.NodeToOLMC(node)
+		if !ok {
+			return nil, fmt.Errorf("node %d out of range for %s", node, chip.Name())
+		}
+		pin := chip.MinOLMCPin() + olmc
+		if other, ok := c.Pins[pin]; ok {
+			return nil, fmt.Errorf("node %d (%s) shares its OLMC with pin %d (%s)", node, def.Name, pin, other.Name)
+		}
+		if _, ok := symbols[def.Name]; ok {
+			return nil, fmt.Errorf("node %d: %q is already defined", node, def.Name)
+		}
 		symbols[def.Name] = Symbol{Pin: pin, ActiveLow: def.ActiveLow}
 	}
 	// Add power pins
 	symbols["VCC"] = Symbol{Pin: chip.NumPins(), ActiveLow: false}
 	symbols["GND"] = Symbol{Pin: chip.NumPins() / 2, ActiveLow: false}
 
+	vectors, err := compileVectors(c, chip, symbols)
+	if err != nil {
+		return nil, err
+	}
+	bp.Vectors = vectors
+
+	c.Equations, err = resolveConstants(c)
+	if err != nil {
+		return nil, err
+	}
 	// Desugar set/bus operations (field-name LHS) before processing
-	c.Equations = desugarSetOps(c)
+	c.Equations, err = desugarSetOps(c)
+	if err != nil {
+		return nil, err
+	}
+	c.Equations, err = toggles(c.Equations)
+	if err != nil {
+		return nil, err
+	}
+	c.Equations, err = clockEnables(c.Equations)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPinAssignments(c, chip); err != nil {
+		return nil, err
+	}
 
 	aliases := make(map[string]Expr)
 	for _, eq := range c.Equations {
@@ -64,6 +323,7 @@ func Compile(c Content) (*gal.GAL, error) {
 	type compiledEq struct {
 		eq         Equation
 		terms      []Term
+		dontCare   []Term
 		activeLow  bool
 		outputName string
 		extension  string
@@ -75,9 +335,21 @@ func Compile(c Content) (*gal.GAL, error) {
 			return nil, fmt.Errorf("line %d: %w", eq.Line, err)
 		}
 
-		// Handle global AR/SP signals
-		if isGlobalSignal(info.Name) {
-			chosenTerms, err := exprToTerms(eq.Expr, c.Fields, aliases)
+		// Handle global AR/SP signals. Per-output .AR/.SP equations drive the
+		// same shared rows, so every definition is ORed into the global term.
+		global := info.Name
+		if info.Extension == "AR" || info.Extension == "SP" {
+			if _, ok := symbols[info.Name]; !ok {
+				return nil, fmt.Errorf("line %d: unknown output %q", eq.Line, info.Name)
+			}
+			global = info.Extension
+		}
+		if isGlobalSignal(global) {
+			expr := eq.Expr
+			if info.ActiveLow {
+				expr = ExprNot{X: expr}
+			}
+			chosenTerms, err := exprToTerms(expr, c.Fields, aliases)
 			if err != nil {
 				return nil, fmt.Errorf("line %d: %w", eq.Line, err)
 			}
@@ -86,11 +358,11 @@ func Compile(c Content) (*gal.GAL, error) {
 				return nil, fmt.Errorf("line %d: %w", eq.Line, err)
 			}
 			term := gal.Term{Line: eq.Line, Pins: galTerms}
-			switch strings.ToUpper(info.Name) {
+			switch strings.ToUpper(global) {
 			case "AR":
-				bp.AR = &term
+				bp.AR = orTerm(bp.AR, term)
 			case "SP":
-				bp.SP = &term
+				bp.SP = orTerm(bp.SP, term)
 			}
 			continue
 		}
@@ -105,7 +377,7 @@ func Compile(c Content) (*gal.GAL, error) {
 		// This matches WinCUPL's behavior.
 		compileExpr := eq.Expr
 		polarityFlipped := false
-		if notExpr, ok := eq.Expr.(ExprNot); ok && !eq.Append && info.Extension != "E" && info.Extension != "R" {
+		if notExpr, ok := eq.Expr.(ExprNot); ok && !eq.Append && info.Extension != "E" && info.Extension != "R" && info.Extension != "CK" && info.Extension != "LE" {
 			compileExpr = notExpr.X
 			polarityFlipped = true
 		}
@@ -115,14 +387,23 @@ func Compile(c Content) (*gal.GAL, error) {
 			return nil, fmt.Errorf("line %d: %w", eq.Line, err)
 		}
 
+		var dontCare []Term
+		if eq.DontCare != nil {
+			dontCare, err = exprToTerms(eq.DontCare, c.Fields, aliases)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", eq.Line, err)
+			}
+		}
+
 		finalActiveLow := info.ActiveLow
 		if polarityFlipped {
 			finalActiveLow = !finalActiveLow
 		}
 
-		compiled = append(compiled, compiledEq{eq: eq, terms: chosenTerms, activeLow: finalActiveLow, outputName: info.Name, extension: info.Extension})
+		compiled = append(compiled, compiledEq{eq: eq, terms: chosenTerms, dontCare: dontCare, activeLow: finalActiveLow, outputName: info.Name, extension: info.Extension})
 		// Mark feedback use based on actual terms (post range expansion).
-		for _, term := range chosenTerms {
+		// Don't-care terms count too: the minimized cover may use their inputs.
+		for _, term := range append(chosenTerms[:len(chosenTerms):len(chosenTerms)], dontCare...) {
 			for _, lit := range term.Lits {
 				if sym, ok := symbols[lit.Name]; ok {
 					if olmc, ok := chip.PinToOLMC(sym.Pin); ok {
@@ -133,9 +414,31 @@ func Compile(c Content) (*gal.GAL, error) {
 		}
 	}
 
+	for name, level := range c.MinLevels {
+		sym, ok := symbols[name]
+		if ok {
+			_, ok = chip.PinToOLMC(sym.Pin)
+		}
+		if !ok {
+			return nil, fmt.Errorf("MIN %s = %d: %s is not an output", name, level, name)
+		}
+	}
+	for name, row := range c.Rows {
+		sym, ok := symbols[name]
+		olmc := 0
+		if ok {
+			olmc, ok = chip.PinToOLMC(sym.Pin)
+		}
+		if !ok {
+			return nil, fmt.Errorf("ROW %s = %d: %s is not an output", name, row, name)
+		}
+		bp.OLMC[olmc].FirstRow = row
+	}
+
 	// Accumulate all terms per output (including APPEND), then minimize and place.
 	type olmcAccum struct {
 		terms     []Term
+		dontCare  []Term
 		activeLow bool
 		line      int
 		lhs       string
@@ -143,6 +446,8 @@ func Compile(c Content) (*gal.GAL, error) {
 	}
 	accum := make(map[int]*olmcAccum) // keyed by OLMC index
 	oeAccum := make(map[int]*olmcAccum)
+	ckAccum := make(map[int]*olmcAccum)
+	leAccum := make(map[int]*olmcAccum)
 
 	for _, item := range compiled {
 		eq := item.eq
@@ -157,11 +462,47 @@ func Compile(c Content) (*gal.GAL, error) {
 		}
 
 		if item.extension == "E" {
-			// Output enable equation — store separately
-			if _, exists := oeAccum[olmc]; exists {
-				return nil, fmt.Errorf("line %d: OE for %q already defined", eq.Line, lhs)
+			// Output enable equation — store separately. APPENDed enables
+			// are ORed like the output's own terms, and an active-low LHS
+			// (!Q.OE = dis) complements the sum, as it does for outputs.
+			// The complement applies to the whole sum, so every APPEND must
+			// share the first equation's polarity.
+			if a, exists := oeAccum[olmc]; exists {
+				if !eq.Append {
+					return nil, fmt.Errorf("line %d: OE for %q already defined", eq.Line, lhs)
+				}
+				if item.activeLow != a.activeLow {
+					return nil, fmt.Errorf("line %d: APPEND to %s.OE is %s, but line %d defines it %s", eq.Line, lhs, polarityName(item.activeLow), a.line, polarityName(a.activeLow))
+				}
+				a.terms = append(a.terms, item.terms...)
+				continue
 			}
 			oeAccum[olmc] = &olmcAccum{
+				terms:     item.terms,
+				activeLow: item.activeLow,
+				line:      eq.Line,
+				lhs:       lhs,
+			}
+			continue
+		}
+
+		if item.extension == "CK" {
+			if _, exists := ckAccum[olmc]; exists {
+				return nil, fmt.Errorf("line %d: CK for %q already defined", eq.Line, lhs)
+			}
+			ckAccum[olmc] = &olmcAccum{
+				terms: item.terms,
+				line:  eq.Line,
+				lhs:   lhs,
+			}
+			continue
+		}
+
+		if item.extension == "LE" {
+			if _, exists := leAccum[olmc]; exists {
+				return nil, fmt.Errorf("line %d: LE for %q already defined", eq.Line, lhs)
+			}
+			leAccum[olmc] = &olmcAccum{
 				terms: item.terms,
 				line:  eq.Line,
 				lhs:   lhs,
@@ -170,13 +511,24 @@ func Compile(c Content) (*gal.GAL, error) {
 		}
 
 		if a, exists := accum[olmc]; exists {
+			if kinds := item.extension + a.extension; kinds == "RT" || kinds == "TR" {
+				// WinCUPL spells a toggle flip-flop .T; here it is a
+				// tristate output, and a toggle is .TOG.
+				return nil, fmt.Errorf("line %d: %q has both .D and .T equations (the other is on line %d); .T is a tristate output, not a toggle flip-flop, so write a toggle register as %s.TOG = toggle", eq.Line, lhs, a.line, lhs)
+			}
 			if !eq.Append {
 				return nil, fmt.Errorf("line %d: output %q already defined", eq.Line, lhs)
 			}
+			if item.extension != a.extension {
+				// One OLMC cannot sum registered and combinatorial terms.
+				return nil, fmt.Errorf("line %d: APPEND to %q is %s, but line %d defines it %s", eq.Line, lhs, outputKind(item.extension), a.line, outputKind(a.extension))
+			}
 			a.terms = append(a.terms, item.terms...)
+			a.dontCare = append(a.dontCare, item.dontCare...)
 		} else {
 			accum[olmc] = &olmcAccum{
 				terms:     item.terms,
+				dontCare:  item.dontCare,
 				activeLow: item.activeLow || sym.ActiveLow,
 				line:      eq.Line,
 				lhs:       lhs,
@@ -185,14 +537,31 @@ func Compile(c Content) (*gal.GAL, error) {
 		}
 	}
 
+	var outputs []OutputTerms
+	outIndex := make(map[int]int)
 	for olmc, a := range accum {
+		written := a.terms
 		// Minimize the accumulated terms for this output
-		a.terms = minimizeTerms(a.terms)
+		level := c.minLevelFor(a.lhs)
+		if len(a.dontCare) > 0 && level > 0 {
+			a.terms = m.Minimize(a.terms, a.dontCare)
+		} else {
+			a.terms = reducer(level, m)(a.terms)
+		}
 
 		galTerms, err := mapTermsToPins(a.terms, symbols)
 		if err != nil {
 			return nil, fmt.Errorf("line %d: %w", a.line, err)
 		}
+		outIndex[olmc] = len(outputs)
+		outputs = append(outputs, OutputTerms{
+			Name:      a.lhs,
+			Pin:       chip.MinOLMCPin() + olmc,
+			Line:      a.line,
+			Extension: a.extension,
+			Terms:     written,
+			Minimized: a.terms,
+		})
 
 		term := gal.Term{Line: a.line, Pins: galTerms}
 		bp.OLMC[olmc].Output = &term
@@ -206,13 +575,30 @@ func Compile(c Content) (*gal.GAL, error) {
 		case "R":
 			bp.OLMC[olmc].Registered = true
 		case "T":
-			// Tristate data — implies OE term needed
+			// Tristate data: the logic rows drive the pin while row 0 holds
+			// the .OE equation, or stays TRUE (always enabled) without one.
+			bp.OLMC[olmc].Tristate = true
 		}
 	}
 
+	if err := checkFeedbackLoops(bp, symbols); err != nil {
+		return nil, err
+	}
+	if err := checkFeedbackSources(c.Equations, bp, symbols); err != nil {
+		return nil, err
+	}
+
 	// Place OE terms
 	for olmc, oe := range oeAccum {
-		oe.terms = minimizeTerms(oe.terms)
+		reduce := reducer(c.minLevelFor(oe.lhs), m)
+		oe.terms = reduce(oe.terms)
+		if oe.activeLow {
+			neg, ok := complementTerms(oe.terms)
+			if !ok {
+				return nil, fmt.Errorf("line %d: complement of %s.OE is too large", oe.line, oe.lhs)
+			}
+			oe.terms = reduce(neg)
+		}
 		galTerms, err := mapTermsToPins(oe.terms, symbols)
 		if err != nil {
 			return nil, fmt.Errorf("line %d: %w", oe.line, err)
@@ -221,12 +607,72 @@ func Compile(c Content) (*gal.GAL, error) {
 		bp.OLMC[olmc].OETerm = &term
 	}
 
+	// DeMorgan polarity selection: if an output's sum of products does not
+	// fit its OLMC, try the complement with the XOR bit inverted. Whether
+	// row 0 is free depends on the mode, so this waits until every output
+	// and OE term is in the blueprint.
+	mode := gal.DetectMode(bp)
+	for olmc, a := range accum {
+		if a.extension == "R" || c.minLevelFor(a.lhs) == 0 {
+			continue
+		}
+		budget := chip.NumRowsForOLMC(olmc) - bp.OLMC[olmc].FirstRow
+		if oeRowReserved(chip, mode, a.extension) {
+			budget--
+		}
+		if len(a.terms) <= budget {
+			continue
+		}
+		neg, ok := complementTerms(a.terms)
+		if !ok {
+			continue
+		}
+		neg = m.Minimize(neg, nil)
+		if len(neg) >= len(a.terms) {
+			continue
+		}
+		galTerms, err := mapTermsToPins(neg, symbols)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", a.line, err)
+		}
+		outputs[outIndex[olmc]].Minimized = neg
+		bp.OLMC[olmc].Output = &gal.Term{Line: a.line, Pins: galTerms}
+		if bp.OLMC[olmc].Active == gal.ActiveLow {
+			bp.OLMC[olmc].Active = gal.ActiveHigh
+		} else {
+			bp.OLMC[olmc].Active = gal.ActiveLow
+		}
+	}
+
+	// Place clock terms
+	for olmc, ck := range ckAccum {
+		galTerms, err := mapTermsToPins(reducer(c.minLevelFor(ck.lhs), m)(ck.terms), symbols)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", ck.line, err)
+		}
+		term := gal.Term{Line: ck.line, Pins: galTerms}
+		bp.OLMC[olmc].CKTerm = &term
+	}
+
+	// Place latch enable terms
+	for olmc, le := range leAccum {
+		galTerms, err := mapTermsToPins(reducer(c.minLevelFor(le.lhs), m)(le.terms), symbols)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", le.line, err)
+		}
+		term := gal.Term{Line: le.line, Pins: galTerms}
+		bp.OLMC[olmc].LETerm = &term
+	}
+
 	// Note: AC1 handling for unused OLMCs is done in setTristate based on mode.
 
 	// needs_flip: On GAL22V10, registered + active-high outputs have their
 	// feedback taken from the register (pre-XOR gate). Since XOR=1 inverts
 	// the output, the feedback value is the complement of the pin value.
 	// To compensate, flip the negation for any AND array reference to such pins.
+	// This runs on the mapped pin terms, after aliases were inlined by toNNF,
+	// so an alias that reaches such an output (tmp = Q0 & SEL; X.D = tmp;) is
+	// flipped exactly like a direct reference, under any number of negations.
 	if chip == gal.ChipGAL22V10 {
 		flipPins := make(map[int]bool)
 		for i, olmc := range bp.OLMC {
@@ -250,13 +696,264 @@ func Compile(c Content) (*gal.GAL, error) {
 			for i := range bp.OLMC {
 				flipTermPins(bp.OLMC[i].Output)
 				flipTermPins(bp.OLMC[i].OETerm)
+				flipTermPins(bp.OLMC[i].LETerm)
 			}
 			flipTermPins(bp.AR)
 			flipTermPins(bp.SP)
 		}
 	}
 
-	return gal.BuildGAL(bp)
+	sort.Slice(outputs, func(i, j int) bool { return outputs[i].Pin < outputs[j].Pin })
+	return &CompileResult{Blueprint: &bp, Symbols: symbols, Outputs: outputs, Equations: c.Equations}, nil
+}
+
+// checkPinAssignments rejects pin declarations the device cannot honor, so
+// they are reported where they are written instead of as a confusing error
+// further down: a signal on a supply pin, a name declared on two pins, and
+// an output equation for a pin without an OLMC.
+func checkPinAssignments(c Content, chip gal.Chip) error {
+	pins := make([]int, 0, len(c.Pins))
+	for pin := range c.Pins {
+		pins = append(pins, pin)
+	}
+	sort.Ints(pins)
+	byName := make(map[string]int)
+	for _, pin := range pins {
+		def := c.Pins[pin]
+		switch pin {
+		case chip.NumPins() / 2:
+			return fmt.Errorf("line %d: pin %d (%s) is the GND pin of the %s", def.Line, pin, def.Name, chip.Name())
+		case chip.NumPins():
+			return fmt.Errorf("line %d: pin %d (%s) is the VCC pin of the %s", def.Line, pin, def.Name, chip.Name())
+		}
+		if first, ok := byName[def.Name]; ok {
+			return fmt.Errorf("line %d: %s is assigned to both pin %d (line %d) and pin %d", def.Line, def.Name, first, c.Pins[first].Line, pin)
+		}
+		byName[def.Name] = pin
+	}
+	for _, eq := range c.Equations {
+		info, err := parseEquationLHS(eq.LHS)
+		if err != nil || info.Extension == "AR" || info.Extension == "SP" {
+			continue // reported, or checked, when the equation is compiled
+		}
+		pin, ok := byName[info.Name]
+		if !ok {
+			continue
+		}
+		if _, ok := chip.PinToOLMC(pin); !ok {
+			return fmt.Errorf("line %d: output %s is on pin %d (line %d), which has no output macrocell; %s outputs are pins %d-%d",
+				eq.Line, info.Name, pin, c.Pins[pin].Line, chip.Name(), chip.MinOLMCPin(), chip.MaxOLMCPin())
+		}
+	}
+	return nil
+}
+
+// checkFeedbackSources validates .IO/.Q/.DQ references. Each OLMC has a
+// single feedback column whose source is fixed by its mode: a registered
+// OLMC feeds back its register, any other feeds back its pin. The extension
+// therefore selects no fuse; it asserts which source the design expects.
+func checkFeedbackSources(eqs []Equation, bp gal.Blueprint, symbols map[string]Symbol) error {
+	chip := bp.Chip
+	for _, eq := range eqs {
+		var err error
+		check := func(id ExprIdent) {
+			if err != nil || id.Feedback == "" {
+				return
+			}
+			ref := id.Name + "." + id.Feedback
+			sym, ok := symbols[id.Name]
+			if !ok {
+				err = fmt.Errorf("line %d: %s: %q is not a pin", eq.Line, ref, id.Name)
+				return
+			}
+			olmc, isOLMC := chip.PinToOLMC(sym.Pin)
+			registered := isOLMC && bp.OLMC[olmc].Registered
+			switch {
+			case id.Feedback == "Q" && !isOLMC:
+				err = fmt.Errorf("line %d: %s: input %s has no register", eq.Line, ref, id.Name)
+			case id.Feedback == "Q" && !registered:
+				err = fmt.Errorf("line %d: %s: %s is not registered; its feedback is the pin (%s.IO)", eq.Line, ref, id.Name, id.Name)
+			case id.Feedback == "IO" && registered:
+				err = fmt.Errorf("line %d: %s: registered %s feeds back its register, not the pin (%s.Q)", eq.Line, ref, id.Name, id.Name)
+			}
+		}
+		walkIdents(eq.Expr, check)
+		if eq.DontCare != nil {
+			walkIdents(eq.DontCare, check)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkIdents calls fn for every identifier in expr.
+func walkIdents(expr Expr, fn func(ExprIdent)) {
+	switch e := expr.(type) {
+	case ExprIdent:
+		fn(e)
+	case ExprNot:
+		walkIdents(e.X, fn)
+	case ExprAnd:
+		walkIdents(e.A, fn)
+		walkIdents(e.B, fn)
+	case ExprOr:
+		walkIdents(e.A, fn)
+		walkIdents(e.B, fn)
+	case ExprXor:
+		walkIdents(e.A, fn)
+		walkIdents(e.B, fn)
+	}
+}
+
+// walkNames calls fn with every signal, set member and field name expr
+// refers to, before sets are expanded and constants resolved.
+func walkNames(expr Expr, fn func(string)) {
+	switch e := expr.(type) {
+	case ExprIdent:
+		fn(e.Name)
+	case ExprIdentList:
+		for _, name := range e.Names {
+			fn(name)
+		}
+	case ExprFieldRange:
+		fn(e.Field)
+	case ExprFieldEquality:
+		fn(e.Field)
+	case ExprNot:
+		walkNames(e.X, fn)
+	case ExprAnd:
+		walkNames(e.A, fn)
+		walkNames(e.B, fn)
+	case ExprOr:
+		walkNames(e.A, fn)
+		walkNames(e.B, fn)
+	case ExprXor:
+		walkNames(e.A, fn)
+		walkNames(e.B, fn)
+	}
+}
+
+// checkFeedbackLoops rejects combinatorial outputs that depend on themselves
+// through the feedback of other combinatorial outputs; such a design
+// oscillates or latches. A registered output breaks the loop.
+func checkFeedbackLoops(bp gal.Blueprint, symbols map[string]Symbol) error {
+	chip := bp.Chip
+	names := make(map[int]string)
+	for name, sym := range symbols {
+		names[sym.Pin] = name
+	}
+	combinatorial := func(pin int) bool {
+		olmc, ok := chip.PinToOLMC(pin)
+		return ok && bp.OLMC[olmc].Output != nil && !bp.OLMC[olmc].Registered
+	}
+	deps := make(map[int][]int)
+	for i, olmc := range bp.OLMC {
+		pin := chip.MinOLMCPin() + i
+		if !combinatorial(pin) {
+			continue
+		}
+		seen := make(map[int]bool)
+		for _, row := range olmc.Output.Pins {
+			for _, p := range row {
+				if combinatorial(p.Pin) && !seen[p.Pin] {
+					seen[p.Pin] = true
+					deps[pin] = append(deps[pin], p.Pin)
+				}
+			}
+		}
+		sort.Ints(deps[pin])
+	}
+
+	const (
+		unvisited = iota
+		active
+		done
+	)
+	state := make(map[int]int)
+	var path []int
+	var visit func(pin int) error
+	visit = func(pin int) error {
+		state[pin] = active
+		path = append(path, pin)
+		for _, dep := range deps[pin] {
+			switch state[dep] {
+			case active:
+				start := 0
+				for path[start] != dep {
+					start++
+				}
+				loop := make([]string, 0, len(path)-start+1)
+				for _, p := range append(path[start:], dep) {
+					loop = append(loop, names[p])
+				}
+				olmc, _ := chip.PinToOLMC(dep)
+				return fmt.Errorf("line %d: combinational feedback loop: %s", bp.OLMC[olmc].Output.Line, strings.Join(loop, " -> "))
+			case unvisited:
+				if err := visit(dep); err != nil {
+					return err
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[pin] = done
+		return nil
+	}
+	for pin := chip.MinOLMCPin(); pin <= chip.MaxOLMCPin(); pin++ {
+		if state[pin] == unvisited && len(deps[pin]) > 0 {
+			if err := visit(pin); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compileVectors lays each test vector out by pin number, as JEDEC *V fields
+// expect. Pins not in ORDER are X; the power pins are N.
+func compileVectors(c Content, chip gal.Chip, symbols map[string]Symbol) ([]string, error) {
+	if len(c.Vectors) == 0 {
+		return nil, nil
+	}
+	if len(c.Order) == 0 {
+		return nil, fmt.Errorf("line %d: VECTORS without ORDER", c.Vectors[0].Line)
+	}
+	pins := make([]int, len(c.Order))
+	for i, name := range c.Order {
+		sym, ok := symbols[name]
+		if !ok || name == "VCC" || name == "GND" {
+			return nil, fmt.Errorf("ORDER signal %q is not a defined pin", name)
+		}
+		pins[i] = sym.Pin
+	}
+	out := make([]string, 0, len(c.Vectors))
+	for _, v := range c.Vectors {
+		if len(v.Values) != len(pins) {
+			return nil, fmt.Errorf("line %d: test vector has %d values, ORDER lists %d", v.Line, len(v.Values), len(pins))
+		}
+		row := []byte(strings.Repeat("X", chip.NumPins()))
+		row[chip.NumPins()/2-1] = 'N'
+		row[chip.NumPins()-1] = 'N'
+		for i, pin := range pins {
+			val := v.Values[i]
+			if _, isOutput := chip.PinToOLMC(pin); !isOutput && strings.IndexByte("HLZ", val) >= 0 {
+				return nil, fmt.Errorf("line %d: %q is an input and cannot expect %c", v.Line, c.Order[i], val)
+			}
+			row[pin-1] = val
+		}
+		out = append(out, string(row))
+	}
+	return out, nil
+}
+
+// orTerm returns the OR of dst and t. The line of the first definition is kept.
+func orTerm(dst *gal.Term, t gal.Term) *gal.Term {
+	if dst == nil {
+		return &t
+	}
+	dst.Pins = append(dst.Pins, t.Pins...)
+	return dst
 }
 
 // isGlobalSignal returns true for AR and SP (global signals, not pins).
@@ -265,8 +962,90 @@ func isGlobalSignal(name string) bool {
 	return n == "AR" || n == "SP"
 }
 
-// desugarSetOps expands field-name LHS equations into per-bit equations.
-func desugarSetOps(c Content) []Equation {
+// resolveConstants returns c's equations with the named constants of field
+// comparisons (addr:ROM, addr:[ROM..TOP]) replaced by their values.
+func resolveConstants(c Content) ([]Equation, error) {
+	lookup := func(field, name string, line int) (Constant, error) {
+		k, ok := c.Constants[name]
+		if v, m, err := parseNumberWithMask(name); err == nil {
+			// The name was parsed as a hex number; it is ambiguous once a
+			// constant shares it.
+			if ok {
+				return Constant{}, fmt.Errorf("line %d: %s:%s is ambiguous: %s is a hex number and the constant on line %d; write 'h'%s for the number or rename the constant", line, field, name, name, k.Line, name)
+			}
+			return Constant{Value: v, Mask: m}, nil
+		}
+		if ok {
+			return k, nil
+		}
+		for _, eq := range c.Equations {
+			if eq.LHS == name {
+				return Constant{}, fmt.Errorf("line %d: %s is not a numeric constant (line %d)", line, name, eq.Line)
+			}
+		}
+		return Constant{}, fmt.Errorf("line %d: unknown constant %s", line, name)
+	}
+	var resolve func(Expr, int) (Expr, error)
+	resolve = func(expr Expr, line int) (Expr, error) {
+		var err error
+		switch e := expr.(type) {
+		case ExprNot:
+			e.X, err = resolve(e.X, line)
+			return e, err
+		case ExprAnd:
+			if e.A, err = resolve(e.A, line); err == nil {
+				e.B, err = resolve(e.B, line)
+			}
+			return e, err
+		case ExprOr:
+			if e.A, err = resolve(e.A, line); err == nil {
+				e.B, err = resolve(e.B, line)
+			}
+			return e, err
+		case ExprXor:
+			if e.A, err = resolve(e.A, line); err == nil {
+				e.B, err = resolve(e.B, line)
+			}
+			return e, err
+		case ExprFieldEquality:
+			if e.Const != "" {
+				k, err := lookup(e.Field, e.Const, line)
+				e.Value, e.Mask = k.Value, k.Mask
+				return e, err
+			}
+		case ExprFieldRange:
+			for _, b := range []struct {
+				name string
+				dst  *uint64
+			}{{e.LoConst, &e.Lo}, {e.HiConst, &e.Hi}} {
+				if b.name == "" {
+					continue
+				}
+				k, err := lookup(e.Field, b.name, line)
+				if err != nil {
+					return e, err
+				}
+				*b.dst = k.Value
+			}
+			return e, nil
+		}
+		return expr, nil
+	}
+	out := make([]Equation, len(c.Equations))
+	for i, eq := range c.Equations {
+		expr, err := resolve(eq.Expr, eq.Line)
+		if err != nil {
+			return nil, err
+		}
+		eq.Expr = expr
+		out[i] = eq
+	}
+	return out, nil
+}
+
+// desugarSetOps expands field-name LHS equations into per-bit equations. An
+// active-low LHS (!bus = ...) makes each bit's equation active-low.
+func desugarSetOps(c Content) ([]Equation, error) {
 	var out []Equation
 	for _, eq := range c.Equations {
 		lhs := strings.TrimSpace(eq.LHS)
@@ -281,100 +1060,271 @@ func desugarSetOps(c Content) []Equation {
 			continue
 		}
 		// LHS is a field name — expand to per-bit equations
-		expanded := expandFieldExpr(eq.Expr, field, c.Fields, eq.Line, eq.Append, lhs)
+		expanded, err := expandFieldExpr(eq.Expr, field, c.Fields, eq.Line, eq.Append, lhs)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", eq.Line, err)
+		}
 		out = append(out, expanded...)
 	}
-	return out
+	return out, nil
+}
+
+// clockEnables folds each X.CE = en equation into X's register: none of the
+// supported devices has a clock enable, so the register reloads itself
+// while en is false, X.D = X & !en # d & en. APPENDed .D equations are
+// summed first so the enable covers all of them.
+func clockEnables(eqs []Equation) ([]Equation, error) {
+	enables := make(map[string]Equation)
+	var names []string
+	for _, eq := range eqs {
+		info, err := parseEquationLHS(eq.LHS)
+		if err != nil || info.Extension != "CE" {
+			continue
+		}
+		if info.ActiveLow {
+			eq.Expr = ExprNot{X: eq.Expr}
+		}
+		if prev, ok := enables[info.Name]; ok {
+			return nil, fmt.Errorf("line %d: CE for %q already defined on line %d", eq.Line, info.Name, prev.Line)
+		}
+		enables[info.Name] = eq
+		names = append(names, info.Name)
+	}
+	if len(enables) == 0 {
+		return eqs, nil
+	}
+
+	out := make([]Equation, 0, len(eqs))
+	first := make(map[string]int) // index in out of each enabled register's .D equation
+	for _, eq := range eqs {
+		info, err := parseEquationLHS(eq.LHS)
+		if err != nil {
+			out = append(out, eq)
+			continue
+		}
+		ce, ok := enables[info.Name]
+		if !ok {
+			out = append(out, eq)
+			continue
+		}
+		if info.Extension == "CE" {
+			continue
+		}
+		switch info.Extension {
+		case "R":
+		case "", "T":
+			return nil, fmt.Errorf("line %d: %s.CE on line %d needs a registered output, but %q is %s", eq.Line, info.Name, ce.Line, info.Name, outputKind(info.Extension))
+		default:
+			out = append(out, eq)
+			continue
+		}
+		i, seen := first[info.Name]
+		if !seen {
+			first[info.Name] = len(out)
+			out = append(out, eq)
+			continue
+		}
+		d := &out[i]
+		d.Expr = ExprOr{A: d.Expr, B: eq.Expr}
+		switch {
+		case d.DontCare == nil:
+			d.DontCare = eq.DontCare
+		case eq.DontCare != nil:
+			d.DontCare = ExprOr{A: d.DontCare, B: eq.DontCare}
+		}
+	}
+	for _, name := range names {
+		ce := enables[name]
+		i, ok := first[name]
+		if !ok {
+			return nil, fmt.Errorf("line %d: %s.CE needs a %s.D equation to enable", ce.Line, name, name)
+		}
+		d := &out[i]
+		info, _ := parseEquationLHS(d.LHS)
+		// The hold term keeps the register's value, which an active-low
+		// LHS (!Q.D = d) stores complemented.
+		var hold Expr = ExprIdent{Name: name}
+		if info.ActiveLow {
+			hold = ExprNot{X: hold}
+		}
+		d.Expr = ExprOr{
+			A: ExprAnd{A: hold, B: ExprNot{X: ce.Expr}},
+			B: ExprAnd{A: d.Expr, B: ce.Expr},
+		}
+		if d.DontCare != nil {
+			d.DontCare = ExprAnd{A: d.DontCare, B: ce.Expr}
+		}
+		d.Append = false
+	}
+	return out, nil
 }
 
-func expandFieldExpr(expr Expr, outField Field, fields map[string]Field, line int, isAppend bool, lhs string) []Equation {
+// toggles rewrites each X.TOG = t equation as the D register X.D = X $ t:
+// the supported devices only have D flip-flops, and .T is taken by tristate
+// outputs. APPENDed .TOG equations are summed into one toggle condition.
+func toggles(eqs []Equation) ([]Equation, error) {
+	type toggle struct {
+		index int // in out
+		line  int
+	}
+	found := make(map[string]*toggle)
+	var names []string
+	drives := make(map[string]Equation) // each toggled name's other output equation
+	out := make([]Equation, 0, len(eqs))
+	for _, eq := range eqs {
+		info, err := parseEquationLHS(eq.LHS)
+		if err != nil {
+			out = append(out, eq)
+			continue
+		}
+		if info.Extension != "TOG" {
+			if outputExtension(info.Extension) {
+				if _, ok := drives[info.Name]; !ok {
+					drives[info.Name] = eq
+				}
+			}
+			out = append(out, eq)
+			continue
+		}
+		if t, ok := found[info.Name]; ok {
+			if !eq.Append {
+				return nil, fmt.Errorf("line %d: TOG for %q already defined on line %d", eq.Line, info.Name, t.line)
+			}
+			d := &out[t.index]
+			x := d.Expr.(ExprXor)
+			x.B = ExprOr{A: x.B, B: eq.Expr}
+			d.Expr = x
+			continue
+		}
+		// The register's own value is the other XOR input, which an
+		// active-low LHS (!Q.TOG = t) stores complemented.
+		var hold Expr = ExprIdent{Name: info.Name}
+		lhs := info.Name + ".D"
+		if info.ActiveLow {
+			hold = ExprNot{X: hold}
+			lhs = "!" + lhs
+		}
+		found[info.Name] = &toggle{index: len(out), line: eq.Line}
+		names = append(names, info.Name)
+		out = append(out, Equation{Line: eq.Line, LHS: lhs, Expr: ExprXor{A: hold, B: eq.Expr}})
+	}
+	for _, name := range names {
+		if other, ok := drives[name]; ok {
+			info, _ := parseEquationLHS(other.LHS)
+			return nil, fmt.Errorf("line %d: %q is a toggle register (%s.TOG on line %d), so it cannot also have a %s equation", other.Line, name, name, found[name].line, outputKind(info.Extension))
+		}
+	}
+	return out, nil
+}
+
+func expandFieldExpr(expr Expr, outField Field, fields map[string]Field, line int, isAppend bool, lhs string) ([]Equation, error) {
 	width := len(outField.Bits)
-	bitExprs := exprToBitExprs(expr, width, fields)
+	bitExprs, err := exprToBitExprs(expr, width, fields)
+	if err != nil {
+		return nil, err
+	}
+	prefix := ""
+	if strings.HasPrefix(lhs, "!") {
+		prefix = "!"
+	}
 	var out []Equation
 	for i, be := range bitExprs {
 		out = append(out, Equation{
 			Line:   line,
-			LHS:    outField.Bits[i].Name,
+			LHS:    prefix + outField.Bits[i].Name,
 			Expr:   be,
 			Append: isAppend,
 		})
 	}
-	return out
+	return out, nil
 }
 
-// exprToBitExprs breaks an expression into per-bit expressions for a field of given width.
-func exprToBitExprs(expr Expr, width int, fields map[string]Field) []Expr {
+// exprToBitExprs breaks an expression into per-bit expressions for a field
+// of given width. Scalars are broadcast to every bit; a set or field of a
+// different width is an error rather than being broadcast whole. A field
+// comparison (addr:'h'F0, addr:[0..7]) is a single condition, not a set, so
+// it too is broadcast: [D0..7] & addr:'h'F0 gates every bit of D.
+func exprToBitExprs(expr Expr, width int, fields map[string]Field) ([]Expr, error) {
 	switch e := expr.(type) {
 	case ExprAnd:
-		leftBits := exprToBitExprs(e.A, width, fields)
-		rightBits := exprToBitExprs(e.B, width, fields)
-		out := make([]Expr, width)
-		for i := 0; i < width; i++ {
-			out[i] = ExprAnd{A: leftBits[i], B: rightBits[i]}
-		}
-		return out
+		return bitwise(e.A, e.B, width, fields, func(a, b Expr) Expr { return ExprAnd{A: a, B: b} })
 	case ExprOr:
-		leftBits := exprToBitExprs(e.A, width, fields)
-		rightBits := exprToBitExprs(e.B, width, fields)
-		out := make([]Expr, width)
-		for i := 0; i < width; i++ {
-			out[i] = ExprOr{A: leftBits[i], B: rightBits[i]}
-		}
-		return out
+		return bitwise(e.A, e.B, width, fields, func(a, b Expr) Expr { return ExprOr{A: a, B: b} })
 	case ExprXor:
-		leftBits := exprToBitExprs(e.A, width, fields)
-		rightBits := exprToBitExprs(e.B, width, fields)
-		out := make([]Expr, width)
-		for i := 0; i < width; i++ {
-			out[i] = ExprXor{A: leftBits[i], B: rightBits[i]}
-		}
-		return out
+		return bitwise(e.A, e.B, width, fields, func(a, b Expr) Expr { return ExprXor{A: a, B: b} })
 	case ExprNot:
-		innerBits := exprToBitExprs(e.X, width, fields)
+		innerBits, err := exprToBitExprs(e.X, width, fields)
+		if err != nil {
+			return nil, err
+		}
 		out := make([]Expr, width)
 		for i := 0; i < width; i++ {
 			out[i] = ExprNot{X: innerBits[i]}
 		}
-		return out
+		return out, nil
 	case ExprIdent:
 		// Check if this ident is a field name
-		if f, ok := fields[e.Name]; ok && len(f.Bits) == width {
+		if f, ok := fields[e.Name]; ok {
+			if len(f.Bits) != width {
+				return nil, fmt.Errorf("field %s is %d bits wide, but the assignment is %d bits", e.Name, len(f.Bits), width)
+			}
 			out := make([]Expr, width)
 			for i, b := range f.Bits {
 				out[i] = ExprIdent{Name: b.Name}
+				if b.Neg {
+					out[i] = ExprNot{X: out[i]}
+				}
 			}
-			return out
+			return out, nil
 		}
 		// Scalar: broadcast to all bits
 		out := make([]Expr, width)
 		for i := 0; i < width; i++ {
 			out[i] = e
 		}
-		return out
+		return out, nil
 	case ExprIdentList:
-		if len(e.Names) == width {
-			out := make([]Expr, width)
-			for i, name := range e.Names {
-				out[i] = ExprIdent{Name: name}
-			}
-			return out
+		if len(e.Names) != width {
+			return nil, fmt.Errorf("set [%s] is %d bits wide, but the assignment is %d bits", strings.Join(e.Names, ", "), len(e.Names), width)
+		}
+		out := make([]Expr, width)
+		for i, name := range e.Names {
+			out[i] = ExprIdent{Name: name}
 		}
-		// Width mismatch: broadcast whole expression
+		return out, nil
+	case ExprFieldEquality, ExprFieldRange:
 		out := make([]Expr, width)
 		for i := 0; i < width; i++ {
 			out[i] = expr
 		}
-		return out
+		return out, nil
 	default:
 		// Scalar expression: broadcast
 		out := make([]Expr, width)
 		for i := 0; i < width; i++ {
 			out[i] = expr
 		}
-		return out
+		return out, nil
 	}
 }
 
+// bitwise applies op to each bit of a and b.
+func bitwise(a, b Expr, width int, fields map[string]Field, op func(a, b Expr) Expr) ([]Expr, error) {
+	leftBits, err := exprToBitExprs(a, width, fields)
+	if err != nil {
+		return nil, err
+	}
+	rightBits, err := exprToBitExprs(b, width, fields)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Expr, width)
+	for i := 0; i < width; i++ {
+		out[i] = op(leftBits[i], rightBits[i])
+	}
+	return out, nil
+}
+
 // exprToLiterals returns all literals (variable names) referenced by expr.
 func exprToLiterals(expr Expr, fields map[string]Field) ([]Literal, error) {
 	switch e := expr.(type) {
@@ -455,13 +1405,126 @@ func exprToTerms(expr Expr, fields map[string]Field, aliases map[string]Expr) ([
 	if err != nil {
 		return nil, err
 	}
-	terms, err := dnf(nnf, fields)
+	terms, err := dnf(simplify(nnf), fields)
 	if err != nil {
 		return nil, err
 	}
 	return terms, nil
 }
 
+// simplify folds constants and the identities x & x = x # x = x,
+// x & !x = 0, x # !x = 1, x $ x = 0 and x $ !x = 1, so DNF does not expand
+// redundant or contradictory terms. AND and OR chains are flattened first,
+// so a repeat need not be adjacent (A & B & A).
+func simplify(expr Expr) Expr {
+	switch e := expr.(type) {
+	case ExprNot:
+		switch x := simplify(e.X).(type) {
+		case ExprConst:
+			return ExprConst{Value: !x.Value}
+		case ExprNot:
+			return x.X
+		default:
+			return ExprNot{X: x}
+		}
+	case ExprAnd:
+		return simplifyChain(e, true)
+	case ExprOr:
+		return simplifyChain(e, false)
+	case ExprXor:
+		a, b := simplify(e.A), simplify(e.B)
+		if c, ok := a.(ExprConst); ok {
+			a, b = b, ExprConst{Value: c.Value}
+		}
+		if c, ok := b.(ExprConst); ok {
+			if c.Value {
+				return simplify(ExprNot{X: a})
+			}
+			return a
+		}
+		switch {
+		case reflect.DeepEqual(a, b):
+			return ExprConst{Value: false}
+		case complementary(a, b):
+			return ExprConst{Value: true}
+		}
+		return ExprXor{A: a, B: b}
+	default:
+		return expr
+	}
+}
+
+// simplifyChain simplifies an AND (and=true) or OR chain. The operands keep
+// their order, so the terms DNF produces are ordered as written.
+func simplifyChain(expr Expr, and bool) Expr {
+	var ops []Expr
+	var flatten func(e Expr)
+	flatten = func(e Expr) {
+		switch x := e.(type) {
+		case ExprAnd:
+			if and {
+				flatten(x.A)
+				flatten(x.B)
+				return
+			}
+		case ExprOr:
+			if !and {
+				flatten(x.A)
+				flatten(x.B)
+				return
+			}
+		}
+		if s := simplify(e); reflect.DeepEqual(s, e) {
+			ops = append(ops, s)
+		} else {
+			flatten(s) // the simplified operand may be a chain of this kind
+		}
+	}
+	flatten(expr)
+
+	// true is the identity of AND and false absorbs it; OR is the reverse.
+	var kept []Expr
+	for _, op := range ops {
+		if c, ok := op.(ExprConst); ok {
+			if c.Value != and {
+				return ExprConst{Value: !and}
+			}
+			continue
+		}
+		dup := false
+		for _, k := range kept {
+			if complementary(op, k) {
+				return ExprConst{Value: !and}
+			}
+			dup = dup || reflect.DeepEqual(op, k)
+		}
+		if !dup {
+			kept = append(kept, op)
+		}
+	}
+	if len(kept) == 0 {
+		return ExprConst{Value: and}
+	}
+	out := kept[0]
+	for _, k := range kept[1:] {
+		if and {
+			out = ExprAnd{A: out, B: k}
+		} else {
+			out = ExprOr{A: out, B: k}
+		}
+	}
+	return out
+}
+
+// complementary reports whether one of a and b is the negation of the other.
+func complementary(a, b Expr) bool {
+	if n, ok := a.(ExprNot); ok && reflect.DeepEqual(n.X, b) {
+		return true
+	}
+	n, ok := b.(ExprNot)
+	return ok && reflect.DeepEqual(n.X, a)
+}
+
 func toNNF(expr Expr, neg bool, aliases map[string]Expr, visiting map[string]bool) (Expr, error) {
 	switch e := expr.(type) {
 	case ExprConst:
@@ -479,6 +1542,14 @@ func toNNF(expr Expr, neg bool, aliases map[string]Expr, visiting map[string]boo
 			delete(visiting, e.Name)
 			return out, err
 		}
+		// VCC and GND are the supply rails, not array inputs: they tie a
+		// term high or low.
+		switch e.Name {
+		case "VCC":
+			return ExprConst{Value: !neg}, nil
+		case "GND":
+			return ExprConst{Value: neg}, nil
+		}
 		if neg {
 			return ExprNot{X: e}, nil
 		}
@@ -569,7 +1640,7 @@ func toNNF(expr Expr, neg bool, aliases map[string]Expr, visiting map[string]boo
 type LHSInfo struct {
 	Name      string
 	ActiveLow bool
-	Extension string // "", "R", "T", "E"
+	Extension string // "", "R", "T", "E", "CK", "CE", "LE", "AR", "SP", "TOG"
 }
 
 func parseEquationLHS(lhs string) (LHSInfo, error) {
@@ -600,6 +1671,35 @@ func parseEquationLHS(lhs string) (LHSInfo, error) {
 	return info, nil
 }
 
+// oeRowReserved reports whether row 0 of an output's OLMC holds its output
+// enable rather than a product term. That is every output on the GAL22V10,
+// and on the GAL16V8/20V8 all but simple-mode outputs and registered outputs
+// in registered mode.
+func oeRowReserved(chip gal.Chip, mode gal.Mode, extension string) bool {
+	return chip == gal.ChipGAL22V10 || mode == gal.ModeComplex || mode == gal.ModeRegistered && extension != "R"
+}
+
+// polarityName describes an equation's LHS polarity.
+func polarityName(activeLow bool) string {
+	if activeLow {
+		return "active-low"
+	}
+	return "active-high"
+}
+
+// outputKind describes the output an equation with extension ext defines.
+func outputKind(ext string) string {
+	switch ext {
+	case "":
+		return "combinatorial"
+	case "R":
+		return "registered (.D)"
+	case "T":
+		return "tristate (.T)"
+	}
+	return "." + ext
+}
+
 func dnf(expr Expr, fields map[string]Field) ([]Term, error) {
 	switch e := expr.(type) {
 	case ExprConst:
@@ -658,12 +1758,16 @@ func fieldEqualityTerms(fe ExprFieldEquality, fields map[string]Field) ([]Term,
 	if width == 0 {
 		return nil, fmt.Errorf("field %q has no bits", fe.Field)
 	}
+	if err := checkFieldWidth(field); err != nil {
+		return nil, err
+	}
 
 	// Project value and mask through the field's bit mapping
 	projValue := projectValue(field, fe.Value)
 	projMask := projectValue(field, fe.Mask)
 
 	// Build a single AND term: for each care-bit, the field bit must match the value bit
+	bits := fieldBitsByWeight(field)
 	var lits []Literal
 	for i := 0; i < width; i++ {
 		bitPos := width - 1 - i // MSB first
@@ -671,7 +1775,7 @@ func fieldEqualityTerms(fe ExprFieldEquality, fields map[string]Field) ([]Term,
 			continue // don't-care bit
 		}
 		neg := (projValue>>bitPos)&1 == 0
-		lits = append(lits, Literal{Name: field.Bits[i].Name, Neg: neg})
+		lits = append(lits, Literal{Name: bits[i].Name, Neg: neg != bits[i].Neg})
 	}
 	return []Term{{Lits: lits}}, nil
 }
@@ -685,11 +1789,15 @@ func fieldEqualityTermsNeg(fe ExprFieldEquality, fields map[string]Field) ([]Ter
 	if width == 0 {
 		return nil, fmt.Errorf("field %q has no bits", fe.Field)
 	}
+	if err := checkFieldWidth(field); err != nil {
+		return nil, err
+	}
 
 	projValue := projectValue(field, fe.Value)
 	projMask := projectValue(field, fe.Mask)
 
 	// Negation of AND(lits) = OR of negated literals (one term per care-bit, each with that bit flipped)
+	bits := fieldBitsByWeight(field)
 	var terms []Term
 	for i := 0; i < width; i++ {
 		bitPos := width - 1 - i
@@ -698,7 +1806,7 @@ func fieldEqualityTermsNeg(fe ExprFieldEquality, fields map[string]Field) ([]Ter
 		}
 		// Flip this bit
 		neg := (projValue>>bitPos)&1 == 1
-		terms = append(terms, Term{Lits: []Literal{{Name: field.Bits[i].Name, Neg: neg}}})
+		terms = append(terms, Term{Lits: []Literal{{Name: bits[i].Name, Neg: neg != bits[i].Neg}}})
 	}
 	return terms, nil
 }
@@ -718,6 +1826,49 @@ func andDNF(a, b []Term) []Term {
 	return out
 }
 
+// minLevelFor returns the minimization level for output name: its own
+// MIN name = level override, or the design's MIN level.
+func (c Content) minLevelFor(name string) int {
+	if level, ok := c.MinLevels[name]; ok {
+		return level
+	}
+	return c.MinLevel
+}
+
+// reducer returns the term reduction for a minimization level. Level 0 keeps
+// terms as written (hand-crafted hazard covers survive); every higher level
+// runs m.
+func reducer(level int, m Minimizer) func([]Term) []Term {
+	if level == 0 {
+		return dedupeTerms
+	}
+	return func(terms []Term) []Term { return m.Minimize(terms, nil) }
+}
+
+// maxComplementTerms bounds the intermediate size of complementTerms.
+const maxComplementTerms = 256
+
+// complementTerms returns the negation of a sum of products, also as a sum of
+// products, by applying DeMorgan to each term and multiplying out. It gives up
+// (ok=false) if the expansion grows past maxComplementTerms.
+func complementTerms(terms []Term) ([]Term, bool) {
+	out := []Term{{}} // TRUE
+	for _, t := range terms {
+		negated := make([]Term, 0, len(t.Lits))
+		for _, l := range t.Lits {
+			negated = append(negated, Term{Lits: []Literal{{Name: l.Name, Neg: !l.Neg}}})
+		}
+		out = andDNF(out, negated)
+		if len(out) > maxComplementTerms {
+			out = minimizeTerms(out)
+			if len(out) > maxComplementTerms {
+				return nil, false
+			}
+		}
+	}
+	return out, true
+}
+
 func mergeTerms(a, b Term) (Term, bool) {
 	m := map[string]bool{}
 	for _, l := range a.Lits {
@@ -750,7 +1901,17 @@ func fieldRangeTerms(fr ExprFieldRange, fields map[string]Field, negated bool) (
 	if width == 0 {
 		return nil, fmt.Errorf("field %q has no bits", field.Name)
 	}
+	if err := checkFieldWidth(field); err != nil {
+		return nil, err
+	}
 	lo, hi := fr.Lo, fr.Hi
+	if n := fieldValueBits(field); n < maxFieldBits {
+		for _, v := range []uint64{lo, hi} {
+			if v>>n != 0 {
+				return nil, fmt.Errorf("range value 'h%X does not fit field %s, which only holds %d bits", v, field.Name, n)
+			}
+		}
+	}
 	projLo := projectValue(field, lo)
 	projHi := projectValue(field, hi)
 	if projLo > projHi {
@@ -770,6 +1931,7 @@ func fieldRangeTerms(fr ExprFieldRange, fields map[string]Field, negated bool) (
 		}
 	}
 
+	bits := fieldBitsByWeight(field)
 	var out []Term
 	for _, r := range ranges {
 		cubes := rangeToCubes(r[0], r[1], width)
@@ -781,7 +1943,7 @@ func fieldRangeTerms(fr ExprFieldRange, fields map[string]Field, negated bool) (
 				}
 				idx := width - 1 - bit // map LSB->last
 				bitVal := (c.value >> bit) & 1
-				lit := Literal{Name: field.Bits[idx].Name, Neg: bitVal == 0}
+				lit := Literal{Name: bits[idx].Name, Neg: (bitVal == 0) != bits[idx].Neg}
 				term.Lits = append(term.Lits, lit)
 			}
 			out = append(out, term)
@@ -836,24 +1998,20 @@ func maxBlockSize(lo, remaining uint64) uint64 {
 	return maxPow
 }
 
+// projectValue maps v onto the field's bits: bit i of the result, counting
+// from the most significant, is the bit of v at the weight of
+// fieldBitsByWeight(field)[i]. Without bit numbers the field is positional.
 func projectValue(field Field, v uint64) uint64 {
 	width := len(field.Bits)
 	if width == 0 {
 		return 0
 	}
-	allNumbered := true
-	for _, b := range field.Bits {
-		if !b.HasNumber {
-			allNumbered = false
-			break
-		}
-	}
-	if !allNumbered {
+	if !fieldNumbered(field) {
 		mask := uint64(1<<width) - 1
 		return v & mask
 	}
 	var out uint64
-	for _, b := range field.Bits {
+	for _, b := range fieldBitsByWeight(field) {
 		out <<= 1
 		if (v>>b.BitNumber)&1 == 1 {
 			out |= 1
@@ -862,6 +2020,140 @@ func projectValue(field Field, v uint64) uint64 {
 	return out
 }
 
+// fieldBitsByWeight returns the field's bits from the most to the least
+// significant. Numbered bits are ordered by their number, so a field may be
+// declared LSB-first ([A0..7]) or with gaps; otherwise the declaration order
+// is taken as MSB-first.
+func fieldBitsByWeight(field Field) []FieldBit {
+	if !fieldNumbered(field) {
+		return field.Bits
+	}
+	bits := append([]FieldBit(nil), field.Bits...)
+	sort.SliceStable(bits, func(i, j int) bool { return bits[i].BitNumber > bits[j].BitNumber })
+	return bits
+}
+
+// fieldValueBits returns how many bits of a value a field compares. Numbered
+// bits weigh by their number, so [A15..12] holds 16 bits; otherwise a field
+// holds one bit per declared bit.
+func fieldValueBits(field Field) uint {
+	if !fieldNumbered(field) {
+		return uint(len(field.Bits))
+	}
+	var n uint
+	for _, b := range field.Bits {
+		if uint(b.BitNumber)+1 > n {
+			n = uint(b.BitNumber) + 1
+		}
+	}
+	return n
+}
+
+// maxFieldBits is the widest field value the compiler handles: values and
+// masks are uint64s.
+const maxFieldBits = 64
+
+// checkFieldWidth rejects a field whose values do not fit in maxFieldBits,
+// rather than letting the upper bits silently drop out of comparisons.
+func checkFieldWidth(field Field) error {
+	if n := fieldValueBits(field); n > maxFieldBits {
+		return fmt.Errorf("field %s is %d bits wide; fields are limited to %d bits", field.Name, n, maxFieldBits)
+	}
+	return nil
+}
+
+// EvalExpr evaluates expr for an assignment of signal values. Values are
+// logical, so an active-low pin's signal is true when the pin is low. Field
+// comparisons weigh and complement their members as the compiler does. A
+// signal missing from assign is an error.
+func EvalExpr(expr Expr, assign map[string]bool, fields map[string]Field) (bool, error) {
+	switch e := expr.(type) {
+	case ExprIdent:
+		v, ok := assign[e.Name]
+		if !ok {
+			return false, fmt.Errorf("%s has no value", e.Name)
+		}
+		return v, nil
+	case ExprConst:
+		return e.Value, nil
+	case ExprNot:
+		v, err := EvalExpr(e.X, assign, fields)
+		return !v, err
+	case ExprAnd:
+		l, r, err := evalPair(e.A, e.B, assign, fields)
+		return l && r, err
+	case ExprOr:
+		l, r, err := evalPair(e.A, e.B, assign, fields)
+		return l || r, err
+	case ExprXor:
+		l, r, err := evalPair(e.A, e.B, assign, fields)
+		return l != r, err
+	case ExprFieldEquality:
+		field, v, err := evalField(e.Field, assign, fields)
+		if err != nil {
+			return false, err
+		}
+		mask := projectValue(field, e.Mask)
+		return v&mask == projectValue(field, e.Value)&mask, nil
+	case ExprFieldRange:
+		field, v, err := evalField(e.Field, assign, fields)
+		if err != nil {
+			return false, err
+		}
+		lo, hi := projectValue(field, e.Lo), projectValue(field, e.Hi)
+		if lo > hi {
+			lo, hi = hi, lo
+		}
+		return v >= lo && v <= hi, nil
+	case ExprIdentList:
+		return false, fmt.Errorf("set %v used as a single value", e.Names)
+	default:
+		return false, fmt.Errorf("unsupported expression %T", expr)
+	}
+}
+
+func evalPair(a, b Expr, assign map[string]bool, fields map[string]Field) (bool, bool, error) {
+	l, err := EvalExpr(a, assign, fields)
+	if err != nil {
+		return false, false, err
+	}
+	r, err := EvalExpr(b, assign, fields)
+	return l, r, err
+}
+
+// evalField returns a field's value under assign, packed MSB first like
+// projectValue.
+func evalField(name string, assign map[string]bool, fields map[string]Field) (Field, uint64, error) {
+	field, ok := fields[name]
+	if !ok {
+		return field, 0, fmt.Errorf("unknown field %q", name)
+	}
+	if err := checkFieldWidth(field); err != nil {
+		return field, 0, err
+	}
+	var v uint64
+	for _, b := range fieldBitsByWeight(field) {
+		bit, ok := assign[b.Name]
+		if !ok {
+			return field, 0, fmt.Errorf("%s has no value", b.Name)
+		}
+		v <<= 1
+		if bit != b.Neg {
+			v |= 1
+		}
+	}
+	return field, v, nil
+}
+
+func fieldNumbered(field Field) bool {
+	for _, b := range field.Bits {
+		if !b.HasNumber {
+			return false
+		}
+	}
+	return true
+}
+
 func mapTermsToPins(terms []Term, symbols map[string]Symbol) ([][]gal.Pin, error) {
 	var out [][]gal.Pin
 	for _, t := range terms {
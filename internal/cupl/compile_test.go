@@ -0,0 +1,2047 @@
+package cupl
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pborges/cupl/internal/gal"
+	"github.com/pborges/cupl/internal/jed"
+)
+
+func mustCompileError(t *testing.T, src string) string {
+	t.Helper()
+	content, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	_, err = Compile(content)
+	if err == nil {
+		t.Fatal("expected compile error")
+	}
+	return err.Error()
+}
+
+func TestCompileClockMustBeDedicatedPin(t *testing.T) {
+	src := `
+Device g16v8;
+Pin 1 = Clock;
+Pin 2 = A;
+Pin 3 = B;
+Pin 12 = Q;
+Q.D = A;
+Q.CK = Clock & B;
+`
+	if msg := mustCompileError(t, src); !strings.Contains(msg, "clocked by pin 1 only") {
+		t.Fatalf("unexpected error: %s", msg)
+	}
+}
+
+func TestCompileClockRequiresRegisteredOutput(t *testing.T) {
+	src := `
+Device g22v10;
+Pin 1 = Clock;
+Pin 2 = A;
+Pin 14 = Y;
+Y = A;
+Y.CK = Clock;
+`
+	if msg := mustCompileError(t, src); !strings.Contains(msg, "requires a registered") {
+		t.Fatalf("unexpected error: %s", msg)
+	}
+}
+
+func TestCompileComplementFitsRowBudget(t *testing.T) {
+	// Y is an OR of single literals; its complement is one product term.
+	// Row 0 of Y's OLMC is only free in simple mode, so eight terms fit
+	// there but are complemented once another output forces the complex or
+	// registered mode.
+	const eight = "Y = A # B # C # D # E # F # G # H;\n"
+	tests := []struct {
+		name      string
+		eqs       string
+		mode      gal.Mode
+		rows      int
+		activeLow bool
+	}{
+		{"simple nine terms", "Y = A # B # C # D # E # F # G # H # I;\n", gal.ModeSimple, 1, true},
+		{"simple eight terms", eight, gal.ModeSimple, 8, false},
+		{"complex eight terms", eight + "Z = A;\nZ.OE = B;\n", gal.ModeComplex, 1, true},
+		{"registered eight terms", eight + "Z.D = A;\n", gal.ModeRegistered, 1, true},
+	}
+	for _, tt := range tests {
+		src := `
+Device g16v8;
+Pin 2 = A;
+Pin 3 = B;
+Pin 4 = C;
+Pin 5 = D;
+Pin 6 = E;
+Pin 7 = F;
+Pin 8 = G;
+Pin 9 = H;
+Pin 11 = I;
+Pin 18 = Z;
+Pin 19 = Y;
+` + tt.eqs
+		content, err := Parse([]byte(src))
+		if err != nil {
+			t.Fatalf("%s: parse: %v", tt.name, err)
+		}
+		res, err := CompileDetailed(content)
+		if err != nil {
+			t.Fatalf("%s: compile: %v", tt.name, err)
+		}
+		if res.Mode != tt.mode {
+			t.Errorf("%s: mode %v, want %v", tt.name, res.Mode, tt.mode)
+		}
+		for _, out := range res.Outputs {
+			if out.Name != "Y" {
+				continue
+			}
+			if len(out.Minimized) != tt.rows {
+				t.Errorf("%s: Y uses %d rows, want %d", tt.name, len(out.Minimized), tt.rows)
+			}
+			if len(out.Minimized) > out.MaxTerms {
+				t.Errorf("%s: Y uses %d rows, but only %d are free", tt.name, len(out.Minimized), out.MaxTerms)
+			}
+		}
+		chip := res.GAL.Chip
+		olmc, _ := chip.PinToOLMC(19)
+		if xor := res.GAL.Xor[chip.NumOLMCs()-1-olmc]; xor == tt.activeLow {
+			t.Errorf("%s: XOR for Y is %v, want %v", tt.name, xor, !tt.activeLow)
+		}
+	}
+}
+
+func TestCompileVectorWidthMustMatchOrder(t *testing.T) {
+	src := `
+Device g16v8;
+Pin 2 = A;
+Pin 12 = Y;
+Y = A;
+ORDER: A, Y;
+VECTORS:
+0 L
+1
+`
+	if msg := mustCompileError(t, src); !strings.Contains(msg, "line 9: test vector has 1 values") {
+		t.Fatalf("unexpected error: %s", msg)
+	}
+}
+
+func TestCompilePerOutputARSPMerge(t *testing.T) {
+	const header = `
+Device g22v10;
+Pin 1 = Clock;
+Pin 2 = A;
+Pin 3 = B;
+Pin 4 = C;
+Pin 14 = Q0;
+Pin 15 = Q1;
+Q0.D = A;
+Q1.D = B;
+`
+	compile := func(src string) *CompileResult {
+		t.Helper()
+		content, err := Parse([]byte(src))
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		res, err := CompileDetailed(content)
+		if err != nil {
+			t.Fatalf("compile: %v", err)
+		}
+		return res
+	}
+	merged := compile(header + "AR = C;\nQ0.AR = A;\nQ1.AR = B;\nQ0.SP = C;\n")
+	global := compile(header + "AR = C # A # B;\nSP = C;\n")
+
+	if !reflect.DeepEqual(merged.Blueprint.AR.Pins, global.Blueprint.AR.Pins) {
+		t.Errorf("AR terms %v, want %v", merged.Blueprint.AR.Pins, global.Blueprint.AR.Pins)
+	}
+	if !reflect.DeepEqual(merged.Blueprint.SP.Pins, global.Blueprint.SP.Pins) {
+		t.Errorf("SP terms %v, want %v", merged.Blueprint.SP.Pins, global.Blueprint.SP.Pins)
+	}
+	// AR is row 0 and SP is row 131 of the GAL22V10 fuse map.
+	cols := gal.ChipGAL22V10.NumCols()
+	for _, row := range []int{0, 131} {
+		got := merged.GAL.Fuses[row*cols : (row+1)*cols]
+		want := global.GAL.Fuses[row*cols : (row+1)*cols]
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("row %d: got %v, want %v", row, got, want)
+		}
+	}
+	if !reflect.DeepEqual(merged.GAL.Fuses, global.GAL.Fuses) {
+		t.Error("per-output AR/SP fuse map differs from the global AR/SP design")
+	}
+}
+
+func TestCompilePerOutputARRequiresPin(t *testing.T) {
+	src := `
+Device g22v10;
+Pin 2 = A;
+Pin 14 = Q0;
+Q0 = A;
+Q9.AR = A;
+`
+	if msg := mustCompileError(t, src); !strings.Contains(msg, `unknown output "Q9"`) {
+		t.Fatalf("unexpected error: %s", msg)
+	}
+}
+
+func TestCompileMinLevelZeroKeepsTerms(t *testing.T) {
+	const header = `
+Device g16v8;
+Pin 2 = A;
+Pin 3 = B;
+Pin 4 = C;
+Pin 5 = D;
+Pin 19 = Y;
+`
+	// Nine distinct terms that all reduce to A.
+	const redundant = `Y = A&B # A&!B # A&C # A&!C # A&D # A&!D # A&B&C # A&B&D # A&C&D;`
+
+	content, err := Parse([]byte(header + redundant))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if _, err := Compile(content); err != nil {
+		t.Fatalf("compile at default level: %v", err)
+	}
+
+	if msg := mustCompileError(t, header+"MIN 0;\n"+redundant); !strings.Contains(msg, "too many product terms") {
+		t.Fatalf("unexpected error: %s", msg)
+	}
+
+	// Identical terms are still merged at level 0.
+	content, err = Parse([]byte(header + "MIN 0;\nY = A&B # B&A # A&B # C # C # D # D # !A # !A;"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if content.MinLevel != 0 {
+		t.Fatalf("MinLevel = %d, want 0", content.MinLevel)
+	}
+	if _, err := Compile(content); err != nil {
+		t.Fatalf("compile at level 0: %v", err)
+	}
+}
+
+func TestCompilePerOutputMinLevel(t *testing.T) {
+	// Hazard cover: B&C is redundant (consensus of A&B and !A&C) but keeps
+	// the output steady while A switches.
+	const src = `
+Device g16v8;
+Pin 2 = A;
+Pin 3 = B;
+Pin 4 = C;
+Pin 19 = Y;
+Pin 18 = Z;
+MIN Z = 0;
+Y = A&B # !A&C # B&C;
+Z = A&B # !A&C # B&C;
+`
+	content, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if got := content.MinLevels["Z"]; got != 0 || len(content.MinLevels) != 1 {
+		t.Fatalf("MinLevels = %v, want map[Z:0]", content.MinLevels)
+	}
+	res, err := CompileDetailed(content)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	rows := make(map[string]int)
+	for _, out := range res.Outputs {
+		rows[out.Name] = len(out.Minimized)
+	}
+	if rows["Y"] != 2 {
+		t.Errorf("Y has %d product terms, want 2 (minimized at the default level)", rows["Y"])
+	}
+	if rows["Z"] != 3 {
+		t.Errorf("Z has %d product terms, want 3 (MIN Z = 0 keeps the cover)", rows["Z"])
+	}
+
+	if msg := mustCompileError(t, strings.Replace(src, "MIN Z = 0;", "MIN Q = 0;", 1)); !strings.Contains(msg, "MIN Q = 0: Q is not an output") {
+		t.Fatalf("unexpected error: %s", msg)
+	}
+
+	// NoMinimize overrides a per-output MIN too: MIN Y = 2 builds the same
+	// fuses as the design without it, at level 0.
+	withMin, err := Parse([]byte(strings.Replace(src, "MIN Z = 0;", "MIN Y = 2;", 1)))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	plain, err := Parse([]byte(strings.Replace(src, "MIN Z = 0;", "MIN 0;", 1)))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	got, err := CompileDetailedWithOptions(withMin, CompileOptions{NoMinimize: true})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	want, err := CompileDetailed(plain)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	for _, out := range got.Outputs {
+		if len(out.Minimized) != 3 {
+			t.Errorf("NoMinimize: %s has %d product terms, want 3", out.Name, len(out.Minimized))
+		}
+	}
+	if !reflect.DeepEqual(got.GAL.Fuses, want.GAL.Fuses) {
+		t.Error("NoMinimize with MIN Y = 2: fuses differ from the design at MIN 0")
+	}
+}
+
+func TestCompileMinimizerOption(t *testing.T) {
+	const src = `
+Device g16v8;
+Pin 2 = A;
+Pin 3 = B;
+Pin 4 = C;
+Pin 19 = Y;
+Pin 18 = Z;
+MIN Z = 0;
+Y = A&B # !A&C # B&C;
+Z = A&B # !A&C # B&C;
+`
+	content, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	// A pass-through minimizer keeps Y's hazard cover; level 0 (Z) never
+	// calls it.
+	var calls []int
+	passThrough := MinimizerFunc(func(terms, dontCare []Term) []Term {
+		calls = append(calls, len(terms))
+		return terms
+	})
+	res, err := CompileDetailedWithOptions(content, CompileOptions{Minimizer: passThrough})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	for _, out := range res.Outputs {
+		if !reflect.DeepEqual(out.Minimized, out.Terms) {
+			t.Errorf("%s: minimized %v, want the terms as written %v", out.Name, out.Minimized, out.Terms)
+		}
+	}
+	if want := []int{3}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("minimizer called with %v terms, want %v", calls, want)
+	}
+
+	// Without options Compile keeps using Quine-McCluskey.
+	want, err := Compile(content)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	got, err := CompileWithOptions(content, CompileOptions{Minimizer: QuineMcCluskey})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	if !reflect.DeepEqual(got.Fuses, want.Fuses) {
+		t.Error("QuineMcCluskey fuses differ from the default")
+	}
+}
+
+func TestCompileRowPlacement(t *testing.T) {
+	header := "Device g22v10;\nPin 2 = A;\nPin 3 = B;\nPin 23 = Y;\nY = A # B;\n"
+	compile := func(src string) *gal.GAL {
+		t.Helper()
+		content, err := Parse([]byte(src))
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		g, err := Compile(content)
+		if err != nil {
+			t.Fatalf("compile: %v", err)
+		}
+		return g
+	}
+	packed := compile(header)
+	placed := compile(header + "ROW Y = 3;\n")
+	olmc, _ := gal.ChipGAL22V10.PinToOLMC(23)
+	cleared := make([]bool, gal.ChipGAL22V10.NumCols())
+	// Row 0 is the OE row; Y's two terms move from rows 1-2 to rows 4-5 and
+	// every other row is cleared.
+	for row := 0; row < gal.ChipGAL22V10.NumRowsForOLMC(olmc); row++ {
+		want := cleared
+		switch row {
+		case 0:
+			want = packed.Row(olmc, 0)
+		case 4, 5:
+			want = packed.Row(olmc, row-3)
+		}
+		if got := placed.Row(olmc, row); !reflect.DeepEqual(got, want) {
+			t.Errorf("row %d: got %v, want %v", row, got, want)
+		}
+	}
+
+	content, err := Parse([]byte(header + "ROW Y = 3;\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	res, err := CompileDetailed(content)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	if max := gal.ChipGAL22V10.NumRowsForOLMC(olmc) - 1 - 3; res.Outputs[0].MaxTerms != max {
+		t.Errorf("MaxTerms %d, want %d", res.Outputs[0].MaxTerms, max)
+	}
+
+	for _, tc := range []struct{ row, want string }{
+		{"ROW Y = 8;\n", "line 5: pin 23: product terms from row 8 need 9 rows, it has 8"},
+		{"ROW A = 1;\n", "ROW A = 1: A is not an output"},
+	} {
+		if msg := mustCompileError(t, header+tc.row); msg != tc.want {
+			t.Errorf("%q: got %s, want %s", tc.row, msg, tc.want)
+		}
+	}
+}
+
+// Rows skipped by ROW come out of the budget that decides whether an output
+// is complemented to fit, on top of the OE row the device mode reserves.
+func TestCompileRowPlacementComplementBudget(t *testing.T) {
+	const header = `
+Device g16v8;
+Pin 2 = A;
+Pin 3 = B;
+Pin 4 = C;
+Pin 5 = D;
+Pin 6 = E;
+Pin 7 = F;
+Pin 8 = G;
+Pin 18 = Z;
+Pin 19 = Y;
+ROW Y = 1;
+Y = A # B # C # D # E # F # G;
+`
+	tests := []struct {
+		name      string
+		eqs       string
+		maxTerms  int
+		rows      int
+		activeLow bool
+	}{
+		{"simple", "", 7, 7, false},
+		{"complex", "Z = A;\nZ.OE = B;\n", 6, 1, true},
+	}
+	for _, tt := range tests {
+		content, err := Parse([]byte(header + tt.eqs))
+		if err != nil {
+			t.Fatalf("%s: parse: %v", tt.name, err)
+		}
+		res, err := CompileDetailed(content)
+		if err != nil {
+			t.Fatalf("%s: compile: %v", tt.name, err)
+		}
+		for _, out := range res.Outputs {
+			if out.Name != "Y" {
+				continue
+			}
+			if out.MaxTerms != tt.maxTerms {
+				t.Errorf("%s: MaxTerms %d, want %d", tt.name, out.MaxTerms, tt.maxTerms)
+			}
+			if len(out.Minimized) != tt.rows {
+				t.Errorf("%s: Y uses %d rows, want %d", tt.name, len(out.Minimized), tt.rows)
+			}
+		}
+		chip := res.GAL.Chip
+		olmc, _ := chip.PinToOLMC(19)
+		if xor := res.GAL.Xor[chip.NumOLMCs()-1-olmc]; xor == tt.activeLow {
+			t.Errorf("%s: XOR for Y is %v, want %v", tt.name, xor, !tt.activeLow)
+		}
+	}
+}
+
+func TestCompilePinNodeResolvesToOLMCFeedback(t *testing.T) {
+	const logic = `
+Pin 1 = Clock;
+Pin 2 = Go;
+Pin 23 = Busy;
+S0.D = Go & !S1;
+S1.D = S0;
+Busy = S0 # S1;
+`
+	compile := func(src string) []bool {
+		t.Helper()
+		content, err := Parse([]byte(src))
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		g, err := Compile(content)
+		if err != nil {
+			t.Fatalf("compile: %v", err)
+		}
+		return g.Fuses
+	}
+	// A node compiles exactly like a Pin on its OLMC: the output is still
+	// enabled and drives the package pin.
+	nodes := compile("Device g22v10;\nPINNODE [25..26] = [S0..1];" + logic)
+	pins := compile("Device g22v10;\nPin [14..15] = [S0..1];" + logic)
+	for i := range pins {
+		if nodes[i] != pins[i] {
+			t.Fatalf("fuse %d differs between PINNODE and Pin designs", i)
+		}
+	}
+
+	if msg := mustCompileError(t, "Device g22v10;\nPin 14 = Q;\nPINNODE 25 = S0;"+logic); !strings.Contains(msg, "shares its OLMC with pin 14") {
+		t.Fatalf("unexpected error: %s", msg)
+	}
+	if msg := mustCompileError(t, "Device g16v8;\nPINNODE 25 = S0;\nPin 2 = A;\nPin 12 = Y;\nY = A;"); !strings.Contains(msg, "node 25 out of range") {
+		t.Fatalf("unexpected error: %s", msg)
+	}
+}
+
+func TestCompileCombinationalFeedbackLoop(t *testing.T) {
+	src := `
+Device g16v8;
+Pin 2 = C;
+Pin 3 = D;
+Pin 13 = A;
+Pin 14 = B;
+A = B & C;
+B = A & D;
+`
+	if msg := mustCompileError(t, src); !strings.Contains(msg, "combinational feedback loop: A -> B -> A") {
+		t.Fatalf("unexpected error: %s", msg)
+	}
+
+	// A registered output in the loop breaks it.
+	src = `
+Device g16v8;
+Pin 1 = Clock;
+Pin 2 = C;
+Pin 3 = D;
+Pin 13 = A;
+Pin 14 = B;
+A.D = B & C;
+B = A & D;
+`
+	content, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if _, err := Compile(content); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+}
+
+func TestCompileAtmelPowerDownFuse(t *testing.T) {
+	const logic = `
+Pin 2 = A;
+Pin 3 = B;
+Pin 14 = Y;
+Y = A & B;
+`
+	compile := func(device string) *gal.GAL {
+		t.Helper()
+		content, err := Parse([]byte("Device " + device + ";" + logic))
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		g, err := Compile(content)
+		if err != nil {
+			t.Fatalf("compile %s: %v", device, err)
+		}
+		return g
+	}
+	lattice := compile("g22v10")
+	for _, tt := range []struct {
+		device    string
+		powerDown bool
+	}{
+		{"atf22v10c", false},
+		{"atf22v10cpd", true},
+	} {
+		g := compile(tt.device)
+		if g.FuseCount() != lattice.FuseCount()+1 {
+			t.Errorf("%s: FuseCount = %d, want %d", tt.device, g.FuseCount(), lattice.FuseCount()+1)
+		}
+		if g.PowerDown != tt.powerDown {
+			t.Errorf("%s: PowerDown = %v, want %v", tt.device, g.PowerDown, tt.powerDown)
+		}
+		j, err := jed.Parse([]byte(jed.MakeJEDEC(jed.Config{}, g)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pd := j.Fuses[lattice.FuseCount()]; pd == tt.powerDown {
+			t.Errorf("%s: PD fuse = %v, want %v", tt.device, pd, !tt.powerDown)
+		}
+		for i := range lattice.Fuses {
+			if g.Fuses[i] != lattice.Fuses[i] {
+				t.Fatalf("%s: logic fuse %d differs from g22v10", tt.device, i)
+			}
+		}
+	}
+}
+
+func TestCompileUserSignature(t *testing.T) {
+	const design = `
+Partno PART;
+Device g16v8;
+Pin 2 = A;
+Pin 12 = Y;
+Y = A;
+`
+	content, err := Parse([]byte("Userid CAFE01;" + design))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	g, err := Compile(content)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	out := jed.MakeJEDEC(jed.Config{UserSignature: content.UserSignature()}, g)
+	if !strings.Contains(out, "*UH434146453031\n") {
+		t.Errorf("missing *U field in:\n%s", out)
+	}
+	// USERID replaces Partno in the SIG fuses: 'C' = 0x43, MSB first.
+	want := []bool{false, true, false, false, false, false, true, true}
+	for i, b := range want {
+		if g.Sig[i] != b {
+			t.Fatalf("SIG fuses %v do not start with USERID", g.Sig[:8])
+		}
+	}
+
+	if msg := mustCompileError(t, "Userid TOOLONGID;"+design); !strings.Contains(msg, "longer than 8 bytes") {
+		t.Fatalf("unexpected error: %s", msg)
+	}
+}
+
+func TestCompilePartnoSignature(t *testing.T) {
+	// WinCUPL programs Partno, not Name, into the SIG fuses, left-justified
+	// and padded with NULs.
+	for _, tc := range []struct {
+		name string
+		want string
+	}{
+		{"c_16v8_complex_feedback", "CombTest"},
+		{"c_16v8_complex_in", "Complex\x00"},
+		{"r_22v10_invertedreg", "InvReg\x00\x00"},
+	} {
+		content, err := Parse(mustRead(t, tc.name+".pld"))
+		if err != nil {
+			t.Fatalf("%s: parse: %v", tc.name, err)
+		}
+		g, err := Compile(content)
+		if err != nil {
+			t.Fatalf("%s: compile: %v", tc.name, err)
+		}
+		if got := string(g.Signature()); got != tc.want {
+			t.Errorf("%s: signature %q, want %q", tc.name, got, tc.want)
+		}
+		golden, err := jed.Parse(mustRead(t, tc.name+".jed"))
+		if err != nil {
+			t.Fatalf("%s: parse jed: %v", tc.name, err)
+		}
+		bp, err := gal.DisassembleGAL(g.Chip, golden.Fuses)
+		if err != nil {
+			t.Fatalf("%s: disassemble: %v", tc.name, err)
+		}
+		if got := strings.TrimRight(tc.want, "\x00"); string(bp.Sig) != got {
+			t.Errorf("%s: WinCUPL signature %q, want %q", tc.name, bp.Sig, got)
+		}
+	}
+
+	// A longer Partno keeps its first 8 bytes, with a warning.
+	content, err := Parse([]byte("Partno ABCDEFGHIJ;\nDevice g16v8;\nPin 2 = A;\nPin 19 = Y;\nY = A;\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	res, err := CompileDetailed(content)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	if got := string(res.GAL.Signature()); got != "ABCDEFGH" {
+		t.Errorf("signature %q, want %q", got, "ABCDEFGH")
+	}
+	if want := []string{`Partno "ABCDEFGHIJ" is longer than 8 bytes; the signature holds "ABCDEFGH"`}; !reflect.DeepEqual(res.Warnings, want) {
+		t.Errorf("warnings %q, want %q", res.Warnings, want)
+	}
+}
+
+func TestCompileTristateNeedsOERow(t *testing.T) {
+	src := `
+Device g16v8as;
+Pin 2 = A;
+Pin 13 = D0;
+D0.T = A;
+`
+	if msg := mustCompileError(t, src); !strings.Contains(msg, "needs complex or registered mode") {
+		t.Fatalf("unexpected error: %s", msg)
+	}
+}
+
+func TestCompileForcedModeConflicts(t *testing.T) {
+	const pins = "Pin 1 = Clock;\nPin 2 = A;\nPin 16 = M;\nPin 19 = Y;\n"
+	for _, tc := range []struct {
+		device, eqs, want string
+	}{
+		{"g16v8as", "Y.D = A;", "line 6: registered output on pin 19 needs registered mode, but the device forces simple mode"},
+		{"g16v8ma", "Y.D = A;", "line 6: registered output on pin 19 needs registered mode, but the device forces complex mode"},
+		{"g20v8as", "Y.D = A;", "registered output on pin 19 needs registered mode, but the device forces simple mode"},
+		{"g16v8as", "Y = A;\nY.OE = A;", "line 7: output enable on pin 19 needs complex or registered mode, but the device forces simple mode"},
+		{"g16v8as", "Y.T = A;", "line 6: tristate output on pin 19 needs complex or registered mode"},
+		{"g16v8as", "Y = A & M;", "line 6: Y reads pin 16 (M), which has no feedback path in the simple mode the device forces"},
+		// A centre OLMC may drive an output, but its value cannot be fed back.
+		{"g16v8as", "M = A;\nY = !M;", "line 7: Y reads pin 16 (M), which has no feedback path in the simple mode the device forces"},
+		{"g20v8as", "M = A;\nY = M;", "line 7: Y reads pin 18 (M), which has no feedback path in the simple mode the device forces"},
+	} {
+		src := "Device " + tc.device + ";\n" + pins + tc.eqs + "\n"
+		if tc.device == "g20v8as" {
+			src = "Device g20v8as;\nPin 1 = Clock;\nPin 2 = A;\nPin 18 = M;\nPin 19 = Y;\n" + tc.eqs + "\n"
+		}
+		if msg := mustCompileError(t, src); !strings.HasSuffix(msg, tc.want) {
+			t.Errorf("%s %q: got %q, want %q", tc.device, tc.eqs, msg, tc.want)
+		}
+	}
+	// The same designs build when the mode is detected, and so does reading
+	// an outer OLMC in simple mode, as the WinCUPL MECB designs do.
+	outer, err := Parse([]byte("Device g16v8as;\n" + pins + "Pin 18 = Z;\nZ = A;\nY = !Z;\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if _, err := Compile(outer); err != nil {
+		t.Errorf("g16v8as reading pin 18: %v", err)
+	}
+	for _, eqs := range []string{"Y.D = A;", "Y = A;\nY.OE = A;", "Y = A & M;", "M = A;\nY = !M;"} {
+		content, err := Parse([]byte("Device g16v8;\n" + pins + eqs + "\n"))
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		if _, err := Compile(content); err != nil {
+			t.Errorf("g16v8 %q: %v", eqs, err)
+		}
+	}
+}
+
+func TestCompileTiedOutputs(t *testing.T) {
+	const logic = `
+Pin 2 = A;
+Pin [%d..%d] = [H0..3];
+Pin [%d..%d] = [L0..3];
+H0 = VCC;
+H1 = 'b'1;
+H2 = 'h'F;
+H3 = VCC & 'b'1;
+L0 = GND;
+L1 = 'b'0;
+L2 = VCC & GND;
+L3 = A & GND # !A & GND;
+`
+	for _, tc := range []struct {
+		device   string
+		chip     gal.Chip
+		firstPin int
+		oeRows   int // rows ahead of the output terms
+	}{
+		{"g16v8", gal.ChipGAL16V8, 12, 0},
+		{"g22v10", gal.ChipGAL22V10, 14, 1},
+	} {
+		t.Run(tc.device, func(t *testing.T) {
+			src := fmt.Sprintf("Device %s;"+logic, tc.device, tc.firstPin, tc.firstPin+3, tc.firstPin+4, tc.firstPin+7)
+			content, err := Parse([]byte(src))
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			g, err := Compile(content)
+			if err != nil {
+				t.Fatalf("compile: %v", err)
+			}
+			cols := tc.chip.NumCols()
+			// A blown row is an AND of nothing (true); an intact row is false.
+			rowState := func(row int) string {
+				blown, intact := true, true
+				for _, f := range g.Fuses[row*cols : (row+1)*cols] {
+					blown = blown && f
+					intact = intact && !f
+				}
+				switch {
+				case blown:
+					return "blown"
+				case intact:
+					return "intact"
+				default:
+					return "mixed"
+				}
+			}
+			for i := 0; i < 8; i++ {
+				pin := tc.firstPin + i
+				olmc, _ := tc.chip.PinToOLMC(pin)
+				b := tc.chip.BoundsForOLMC(olmc)
+				for r := tc.oeRows; r < b.MaxRows; r++ {
+					want := "intact"
+					if i < 4 && r == tc.oeRows {
+						want = "blown"
+					}
+					if got := rowState(b.StartRow + r); got != want {
+						t.Errorf("pin %d row %d: got %s, want %s", pin, r, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCompileTableDontCares(t *testing.T) {
+	const header = `
+Device g22v10;
+Pin [2..4] = [A2..0];
+Pin 23 = SEL;
+Pin 22 = ACK;
+FIELD addr = [A2..0];
+FIELD sel = [SEL, ACK];
+`
+	compile := func(src string, opts CompileOptions) *CompileResult {
+		t.Helper()
+		content, err := Parse([]byte(header + src))
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		res, err := CompileDetailedWithOptions(content, opts)
+		if err != nil {
+			t.Fatalf("compile: %v", err)
+		}
+		return res
+	}
+	// intact returns the connected fuses in each logic row of SEL.
+	intact := func(src string, opts CompileOptions) []int {
+		t.Helper()
+		g := compile(src, opts).GAL
+		chip := gal.ChipGAL22V10
+		olmc, _ := chip.PinToOLMC(23)
+		b := chip.BoundsForOLMC(olmc)
+		cols := chip.NumCols()
+		var out []int
+		for r := b.StartRow + 1; r < b.StartRow+b.MaxRows; r++ {
+			n := 0
+			for _, f := range g.Fuses[r*cols : (r+1)*cols] {
+				if !f {
+					n++
+				}
+			}
+			if n == cols {
+				break // unused rows are fully intact
+			}
+			out = append(out, n)
+		}
+		return out
+	}
+	dontCares := CompileOptions{DontCares: true}
+
+	// Values 011 and 1xx are not listed. They drive SEL to 0 by default, as
+	// in WinCUPL, so SEL is !A2 & !A1; as don't-cares SEL reduces to !A1.
+	const partial = `TABLE addr => sel { 'b'000 => 'b'10; 'b'001 => 'b'10; 'b'010 => 'b'00; }`
+	if got, want := intact(partial, CompileOptions{}), []int{2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("partial TABLE: got %v intact fuses per row, want %v", got, want)
+	}
+	if got, want := intact(partial, dontCares), []int{1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("partial TABLE with don't-cares: got %v intact fuses per row, want %v", got, want)
+	}
+	const full = `TABLE addr => sel { 'b'000 => 'b'10; 'b'001 => 'b'10; 'b'01X => 'b'00; 'b'1XX => 'b'00; }`
+	if got, want := intact(full, dontCares), []int{2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("full TABLE: got %v intact fuses per row, want %v", got, want)
+	}
+
+	// An unlisted value (addr = 'b'100) matches none of SEL's product terms;
+	// as a don't-care it would be covered by !A1.
+	value := map[string]bool{"A2": true, "A1": false, "A0": false}
+	for _, out := range compile(partial, CompileOptions{}).Outputs {
+		if out.Name != "SEL" {
+			continue
+		}
+		for _, term := range out.Minimized {
+			match := true
+			for _, lit := range term.Lits {
+				if value[lit.Name] == lit.Neg {
+					match = false
+				}
+			}
+			if match {
+				t.Errorf("SEL term %v is true for the unlisted value 'b'100", term)
+			}
+		}
+	}
+
+	// Without a DEFAULT, inputs matching no IF condition drive SEL to 0 too,
+	// unless they are don't-cares: SEL then only has to stay low where ACK's
+	// condition holds, so it reduces to !A1.
+	const cond = `CONDITION { IF !A2 & !A1 OUT SEL; IF A1 & A0 OUT ACK; }`
+	if got, want := intact(cond, CompileOptions{}), []int{2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("CONDITION: got %v intact fuses per row, want %v", got, want)
+	}
+	if got, want := intact(cond, dontCares), []int{1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("CONDITION with don't-cares: got %v intact fuses per row, want %v", got, want)
+	}
+	const withDefault = `CONDITION { IF !A2 & !A1 OUT SEL; IF A1 & A0 OUT ACK; DEFAULT OUT ACK; }`
+	if got, want := intact(withDefault, dontCares), []int{2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("CONDITION with DEFAULT: got %v intact fuses per row, want %v", got, want)
+	}
+}
+
+func TestCompileRegisteredReservesClockAndOE(t *testing.T) {
+	for _, tc := range []struct {
+		device string
+		oePin  int
+		q      int
+	}{
+		{"g16v8", 11, 12},
+		{"g20v8", 13, 15},
+	} {
+		for _, use := range []struct{ expr, want string }{
+			{"A & CLK", "pin 1 is clock in registered mode"},
+			{"A & OE", fmt.Sprintf("pin %d is /OE in registered mode", tc.oePin)},
+		} {
+			src := fmt.Sprintf("Device %s;\nPin 1 = CLK;\nPin %d = OE;\nPin 2 = A;\nPin %d = Q;\nQ.D = %s;\n", tc.device, tc.oePin, tc.q, use.expr)
+			if msg := mustCompileError(t, src); !strings.Contains(msg, use.want) {
+				t.Errorf("%s: Q.D = %s: unexpected error: %s", tc.device, use.expr, msg)
+			}
+		}
+	}
+}
+
+func TestCompileFieldBitWeights(t *testing.T) {
+	// lits renders the single-row terms of expr as "a0 !a1 ..." sorted by name.
+	lits := func(field, expr string) []string {
+		t.Helper()
+		src := "Device g22v10;\nPin [2..9] = [a0..7];\nPin 23 = Y;\nFIELD x = " + field + ";\nY = " + expr + ";\n"
+		c, err := Parse([]byte(src))
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		terms, err := exprToTerms(c.Equations[0].Expr, c.Fields, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", expr, err)
+		}
+		var out []string
+		for _, term := range minimizeTerms(terms) {
+			var names []string
+			for _, l := range term.Lits {
+				if l.Neg {
+					names = append(names, "!"+l.Name)
+				} else {
+					names = append(names, l.Name)
+				}
+			}
+			sort.Strings(names)
+			out = append(out, strings.Join(names, " "))
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	// 'h'2A sets bits 1, 3 and 5 whatever order the field lists them in.
+	want := []string{"!a0 !a2 !a4 !a6 !a7 a1 a3 a5"}
+	for _, field := range []string{"[a7..0]", "[a0..7]", "[a0,a2,a1,a3,a5,a4,a7,a6]"} {
+		if got := lits(field, "x:'h'2A"); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", field, got, want)
+		}
+	}
+	// A gapped field only looks at its own bits.
+	if got, want := lits("[a1,a3,a5,a7]", "x:'h'2A"), []string{"!a7 a1 a3 a5"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("gapped: got %v, want %v", got, want)
+	}
+	// Ranges compare values by weight, so [0..3] leaves a0 and a1 free.
+	if got, want := lits("[a0..3]", "x:[0..3]"), []string{"!a2 !a3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LSB-first range: got %v, want %v", got, want)
+	}
+
+	// TABLE output values use the same weights.
+	c, err := Parse([]byte("Device g16v8;\nPin [2..3] = [i0..1];\nPin [12..15] = [o0..3];\nFIELD in = [i1..0];\nFIELD out = [o0..3];\nTABLE in => out { 'b'01 => 'b'0001; }\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(c.Equations) != 1 || c.Equations[0].LHS != "o0" {
+		t.Errorf("TABLE 'b'0001 drives %v, want o0", c.Equations)
+	}
+}
+
+func TestCompileAliasOfRegisteredFeedback(t *testing.T) {
+	compile := func(body string) *gal.GAL {
+		t.Helper()
+		content, err := Parse([]byte("Device g22v10;\nPin 1 = CLK;\nPin 2 = SEL;\nPin 3 = A;\nPin 23 = Q0;\nPin 22 = X;\nQ0.D = A;\n" + body))
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		g, err := Compile(content)
+		if err != nil {
+			t.Fatalf("compile: %v", err)
+		}
+		return g
+	}
+	// An alias is inlined before its pins are mapped, so its reference to
+	// the active-high registered Q0 gets the same feedback flip as a direct
+	// reference, negated or not.
+	for _, tt := range []struct{ alias, direct string }{
+		{"tmp = Q0 & SEL;\nX.D = tmp;\n", "X.D = Q0 & SEL;\n"},
+		{"tmp = Q0 & SEL;\nX.D = !tmp;\n", "X.D = !(Q0 & SEL);\n"},
+		{"tmp = !Q0;\nX = tmp # SEL;\n", "X = !Q0 # SEL;\n"},
+	} {
+		if !reflect.DeepEqual(compile(tt.alias).Fuses, compile(tt.direct).Fuses) {
+			t.Errorf("%q and %q compile to different fuses", tt.alias, tt.direct)
+		}
+	}
+
+	content, err := Parse([]byte("Device g22v10;\nPin 1 = CLK;\nPin 2 = SEL;\nPin 3 = A;\nPin 23 = Q0;\nPin 22 = X;\nQ0.D = A;\ntmp = Q0 & SEL;\nX.D = tmp;\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	res, err := CompileDetailed(content)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	olmc, _ := gal.ChipGAL22V10.PinToOLMC(22)
+	for _, p := range res.Blueprint.OLMC[olmc].Output.Pins[0] {
+		if p.Pin == 23 && !p.Neg {
+			t.Error("Q0 is read uninverted; the register feedback is the complement of the pin")
+		}
+	}
+}
+
+func TestCompileTiedOffOutput(t *testing.T) {
+	for _, tt := range []struct {
+		device string
+		pin    int
+		oeRow  bool
+	}{
+		{"g16v8as", 18, false},
+		{"g16v8ma", 18, true},
+		{"g22v10", 22, true},
+	} {
+		build := func(body string) *gal.GAL {
+			t.Helper()
+			content, err := Parse([]byte(fmt.Sprintf("Device %s;\nPin 2 = A;\nPin 19 = X;\nPin %d = Y;\nX = A;\n%s", tt.device, tt.pin, body)))
+			if err != nil {
+				t.Fatalf("%s: parse: %v", tt.device, err)
+			}
+			g, err := Compile(content)
+			if err != nil {
+				t.Fatalf("%s: compile: %v", tt.device, err)
+			}
+			return g
+		}
+		unused, tied := build(""), build("Y = GND;\n")
+		if reflect.DeepEqual(unused.Fuses, tied.Fuses) && reflect.DeepEqual(unused.Xor, tied.Xor) && reflect.DeepEqual(unused.AC1, tied.AC1) {
+			t.Errorf("%s: Y = GND has the same fuse map as an unused Y", tt.device)
+			continue
+		}
+
+		// Y is a driven, active-high output with no product terms, and
+		// where it has an OE row that row is always true.
+		chip := tied.Chip
+		olmc, _ := chip.PinToOLMC(tt.pin)
+		n := chip.NumOLMCs()
+		if !tied.Xor[n-1-olmc] {
+			t.Errorf("%s: XOR for Y is not active-high", tt.device)
+		}
+		if tied.AC1[n-1-olmc] != tt.oeRow {
+			t.Errorf("%s: AC1 for Y is %v, want %v", tt.device, tied.AC1[n-1-olmc], tt.oeRow)
+		}
+		bounds := chip.BoundsForOLMC(olmc)
+		cols := chip.NumCols()
+		for row := bounds.StartRow; row < bounds.StartRow+bounds.MaxRows; row++ {
+			oe := tt.oeRow && row == bounds.StartRow
+			for _, blown := range tied.Fuses[row*cols : (row+1)*cols] {
+				if blown != oe {
+					t.Errorf("%s: row %d of Y is not %v", tt.device, row, oe)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestCompileActiveLowOutputEnable(t *testing.T) {
+	// oeRows renders Y's OE product terms as pin literals, e.g. "!2 3".
+	oeRows := func(body string) []string {
+		t.Helper()
+		content, err := Parse([]byte("Device g22v10;\nPin 2 = DIS;\nPin 3 = B;\nPin 4 = A;\nPin 23 = Y;\nY = A;\n" + body))
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		res, err := CompileDetailed(content)
+		if err != nil {
+			t.Fatalf("compile: %v", err)
+		}
+		olmc, _ := res.Blueprint.Chip.PinToOLMC(23)
+		var out []string
+		for _, row := range res.Blueprint.OLMC[olmc].OETerm.Pins {
+			sort.Slice(row, func(i, j int) bool { return row[i].Pin < row[j].Pin })
+			var lits []string
+			for _, p := range row {
+				if p.Neg {
+					lits = append(lits, fmt.Sprintf("!%d", p.Pin))
+				} else {
+					lits = append(lits, fmt.Sprintf("%d", p.Pin))
+				}
+			}
+			out = append(out, strings.Join(lits, " "))
+		}
+		sort.Strings(out)
+		return out
+	}
+	for _, tt := range []struct {
+		body string
+		want []string
+	}{
+		{"Y.OE = DIS;\n", []string{"2"}},
+		{"!Y.OE = DIS;\n", []string{"!2"}},
+		{"!Y.OE = !DIS;\n", []string{"2"}},
+		// The complement covers the whole sum, APPENDs included.
+		{"!Y.OE = DIS # B;\n", []string{"!2 !3"}},
+		{"!Y.OE = DIS;\nAPPEND !Y.OE = B;\n", []string{"!2 !3"}},
+	} {
+		if got := oeRows(tt.body); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: OE rows %v, want %v", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestCompileFieldActiveLowMembers(t *testing.T) {
+	// rows renders Y's product terms as pin literals, e.g. "!2 3".
+	rows := func(pins, field, expr string) []string {
+		t.Helper()
+		content, err := Parse([]byte("Device g22v10;\n" + pins + "Pin 23 = Y;\nFIELD data = " + field + ";\nY = " + expr + ";\n"))
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		res, err := CompileDetailed(content)
+		if err != nil {
+			t.Fatalf("compile: %v", err)
+		}
+		olmc, _ := res.Blueprint.Chip.PinToOLMC(23)
+		var out []string
+		for _, row := range res.Blueprint.OLMC[olmc].Output.Pins {
+			sort.Slice(row, func(i, j int) bool { return row[i].Pin < row[j].Pin })
+			var lits []string
+			for _, p := range row {
+				if p.Neg {
+					lits = append(lits, fmt.Sprintf("!%d", p.Pin))
+				} else {
+					lits = append(lits, fmt.Sprintf("%d", p.Pin))
+				}
+			}
+			out = append(out, strings.Join(lits, " "))
+		}
+		sort.Strings(out)
+		return out
+	}
+	var activeLow, activeHigh string
+	for i := 0; i < 8; i++ {
+		activeLow += fmt.Sprintf("Pin %d = !D%d;\n", i+2, i)
+		activeHigh += fmt.Sprintf("Pin %d = D%d;\n", i+2, i)
+	}
+
+	// data:'h'F0 sets D7..D4 logically. An active-low pin is low when its
+	// signal is set, and so is the pin of a complemented member; the two
+	// complements cancel.
+	low := []string{"2 3 4 5 !6 !7 !8 !9"}
+	high := []string{"!2 !3 !4 !5 6 7 8 9"}
+	for _, tt := range []struct {
+		name, pins, field string
+		want              []string
+	}{
+		{"active-low pins", activeLow, "[D7..0]", low},
+		{"complemented members", activeHigh, "[!D7..!D0]", low},
+		{"complemented list", activeHigh, "[!D7,!D6,!D5,!D4,!D3,!D2,!D1,!D0]", low},
+		{"both", activeLow, "[!D7..0]", high},
+	} {
+		if got := rows(tt.pins, tt.field, "data:'h'F0"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	// Ranges and set operations see the same complement.
+	if got, want := rows(activeHigh, "[!D1..!D0]", "data:[2..3]"), []string{"!3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("range: got %v, want %v", got, want)
+	}
+	if got, want := rows(activeHigh, "[!D0, D1]", "data:'b'11"), []string{"!2 3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("mixed list: got %v, want %v", got, want)
+	}
+
+	// A 16-bit decode with only some address lines active-low: data:'h'8000
+	// wants A15 set and the rest clear, so the active-low A15 pin is driven
+	// low and the active-low A14 pin high.
+	var mixed string
+	for i, pin := range []int{2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 14, 15, 16, 17, 18} {
+		if i >= 14 {
+			mixed += fmt.Sprintf("Pin %d = !A%d;\n", pin, i)
+		} else {
+			mixed += fmt.Sprintf("Pin %d = A%d;\n", pin, i)
+		}
+	}
+	if got, want := rows(mixed, "[A15..0]", "data:'h'8000"), []string{"!2 !3 !4 !5 !6 !7 !8 !9 !10 !11 !13 !14 !15 !16 17 !18"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("mixed polarity decode: got %v, want %v", got, want)
+	}
+
+	// Complemented members cannot be assigned.
+	for _, src := range []string{
+		"Device g22v10;\nPin [2..3] = [A0..1];\nPin [22..23] = [Y0..1];\nFIELD in = [A0..1];\nFIELD out = [!Y1..!Y0];\nout = in;\n",
+		"Device g22v10;\nPin [2..3] = [A0..1];\nPin [22..23] = [Y0..1];\nFIELD in = [A0..1];\nFIELD out = [!Y1..!Y0];\nTABLE in => out { 1 => 2; }\n",
+	} {
+		_, err := Parse([]byte(src))
+		if err == nil || !strings.Contains(err.Error(), "line 6: ") || !strings.Contains(err.Error(), "member !Y1 is complemented") {
+			t.Errorf("got %v, want a line 6 complemented member error", err)
+		}
+	}
+}
+
+func TestBracketReductions(t *testing.T) {
+	// dnf renders expr's minimized terms as sorted "A0 !A1 ..." strings.
+	dnf := func(src string) []string {
+		t.Helper()
+		expr, err := parseExprText(src, 1)
+		if err != nil {
+			t.Fatalf("%s: %v", src, err)
+		}
+		terms, err := exprToTerms(expr, nil, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", src, err)
+		}
+		var out []string
+		for _, term := range minimizeTerms(terms) {
+			var lits []string
+			for _, l := range term.Lits {
+				if l.Neg {
+					lits = append(lits, "!"+l.Name)
+				} else {
+					lits = append(lits, l.Name)
+				}
+			}
+			sort.Slice(lits, func(i, j int) bool { return strings.TrimPrefix(lits[i], "!") < strings.TrimPrefix(lits[j], "!") })
+			out = append(out, strings.Join(lits, " "))
+		}
+		sort.Strings(out)
+		return out
+	}
+	// parity lists the minterms of A0..A3 with an odd or even number of
+	// members set; XOR has no smaller sum of products.
+	parity := func(odd bool) []string {
+		var out []string
+		for v := 0; v < 16; v++ {
+			ones := 0
+			var lits []string
+			for bit := 0; bit < 4; bit++ {
+				if v>>bit&1 == 1 {
+					ones++
+					lits = append(lits, fmt.Sprintf("A%d", bit))
+				} else {
+					lits = append(lits, fmt.Sprintf("!A%d", bit))
+				}
+			}
+			if (ones%2 == 1) == odd {
+				out = append(out, strings.Join(lits, " "))
+			}
+		}
+		sort.Strings(out)
+		return out
+	}
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{"[A0..3]:$", parity(true)},
+		{"[A0..3]:!$", parity(false)},
+		{"[A0..3]:!#", []string{"!A0 !A1 !A2 !A3"}},
+		{"[A0..3]:!&", []string{"!A0", "!A1", "!A2", "!A3"}},
+		{"[A0..3]:&", []string{"A0 A1 A2 A3"}},
+		{"[A0, A1]:#", []string{"A0", "A1"}},
+	}
+	for _, tt := range tests {
+		if got := dnf(tt.src); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestSetOperationWidths(t *testing.T) {
+	const header = "Device g22v10;\nPin [2..5] = [A0..3];\nPin [6..9] = [B0..3];\nPin 10 = SEL;\nPin [20..23] = [Y0..3];\nFIELD out = [Y0..3];\nFIELD narrow = [B0..1];\n"
+	a2, b2, sel := ExprIdent{Name: "A2"}, ExprIdent{Name: "B2"}, ExprIdent{Name: "SEL"}
+	for _, tt := range []struct {
+		eq   string
+		want Expr // the expression assigned to Y2
+	}{
+		{"[Y0..3] = [A0..3] & [B0..3];", ExprAnd{A: a2, B: b2}},
+		{"[Y0..3] = SEL & [A0..3];", ExprAnd{A: sel, B: a2}},
+		{"[Y0..3] = !([A0..3] # SEL);", ExprNot{X: ExprOr{A: a2, B: sel}}},
+	} {
+		c, err := Parse([]byte(header + tt.eq + "\n"))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.eq, err)
+		}
+		if len(c.Equations) != 4 || c.Equations[2].LHS != "Y2" {
+			t.Fatalf("%s: got equations %+v", tt.eq, c.Equations)
+		}
+		if got := c.Equations[2].Expr; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Y2 = %#v, want %#v", tt.eq, got, tt.want)
+		}
+	}
+
+	// A set narrower than the assignment is an error instead of being
+	// broadcast to every bit.
+	_, err := Parse([]byte(header + "[Y0..3] = [A0..3] & [B0..1];\n"))
+	if err == nil || err.Error() != "line 8: set [B0, B1] is 2 bits wide, but the assignment is 4 bits" {
+		t.Errorf("bracket LHS: got %v", err)
+	}
+	if got := mustCompileError(t, header+"out = [A0..3] & narrow;\n"); got != "line 8: field narrow is 2 bits wide, but the assignment is 4 bits" {
+		t.Errorf("field LHS: got %q", got)
+	}
+	if got := mustCompileError(t, header+"out = [A0..3] $ [B0..2];\n"); !strings.Contains(got, "set [B0, B1, B2] is 3 bits wide") {
+		t.Errorf("field LHS with set: got %q", got)
+	}
+}
+
+func TestSetActiveLowLHS(t *testing.T) {
+	// An active-low set or field LHS inverts every bit, as if each bit's
+	// equation were written active-low by hand.
+	const header = "Device g22v10;\nPin [2..5] = [A0..3];\nPin [6..9] = [B0..3];\nPin [20..23] = [Y0..3];\nFIELD out = [Y3..0];\n"
+	compile := func(eqs string) *gal.GAL {
+		t.Helper()
+		content, err := Parse([]byte(header + eqs))
+		if err != nil {
+			t.Fatalf("%q: parse: %v", eqs, err)
+		}
+		g, err := Compile(content)
+		if err != nil {
+			t.Fatalf("%q: compile: %v", eqs, err)
+		}
+		return g
+	}
+	want := compile("!Y0 = A0 & B0;\n!Y1 = A1 & B1;\n!Y2 = A2 & B2;\n!Y3 = A3 & B3;\n")
+	for _, eq := range []string{
+		"![Y0..3] = [A0..3] & [B0..3];",
+		"!out = [A3..0] & [B3..0];",
+	} {
+		g := compile(eq + "\n")
+		if !reflect.DeepEqual(g.Fuses, want.Fuses) || !reflect.DeepEqual(g.Xor, want.Xor) {
+			t.Errorf("%s: fuses differ from the per-bit !Y equations", eq)
+		}
+	}
+	if g := compile("[Y0..3] = [A0..3] & [B0..3];\n"); reflect.DeepEqual(g.Xor, want.Xor) {
+		t.Error("active-high set has the active-low polarity")
+	}
+}
+
+func TestSetExpressionList(t *testing.T) {
+	// Each member of a bracket list on the right is a full expression,
+	// assigned to the set member in the same position.
+	const header = "Device g22v10;\nPin [2..5] = [A0..3];\nPin [6..9] = [B0..3];\nPin [20..23] = [Y0..3];\n"
+	compile := func(eqs string) *gal.GAL {
+		t.Helper()
+		content, err := Parse([]byte(header + eqs))
+		if err != nil {
+			t.Fatalf("%q: parse: %v", eqs, err)
+		}
+		g, err := Compile(content)
+		if err != nil {
+			t.Fatalf("%q: compile: %v", eqs, err)
+		}
+		return g
+	}
+	want := compile("Y0 = A0 & B0;\nY1 = A1;\nY2 = !A2;\nY3 = A3 # [B0..1]:&;\n")
+	for _, eq := range []string{
+		"[Y0..3] = [A0 & B0, A1, !A2, A3 # [B0..1]:&];",
+		"[Y0..3] = [A0&B0,A1,!A2,(A3 # B0 & B1)];",
+	} {
+		if g := compile(eq + "\n"); !reflect.DeepEqual(g.Fuses, want.Fuses) || !reflect.DeepEqual(g.Xor, want.Xor) {
+			t.Errorf("%s: fuses differ from the per-bit equations", eq)
+		}
+	}
+	// A list inside a larger expression is still a set operation.
+	want = compile("Y0 = A0 & B0;\nY1 = A1 & B1;\n")
+	if g := compile("[Y0..1] = [A0, A1] & [B0, B1];\n"); !reflect.DeepEqual(g.Fuses, want.Fuses) {
+		t.Error("[A0, A1] & [B0, B1]: fuses differ from the per-bit equations")
+	}
+
+	for _, tc := range []struct {
+		eq   string
+		want string
+	}{
+		{"[Y0..3] = [A0, A1 & B1];", "line 5: set of 2 expressions is assigned to 4 bits"},
+		{"[Y0..1] = [A0 &, A1];", "line 5: unexpected token \",\""},
+	} {
+		_, err := Parse([]byte(header + tc.eq + "\n"))
+		if err == nil || !strings.HasPrefix(err.Error(), tc.want) {
+			t.Errorf("%s: got error %v, want %q", tc.eq, err, tc.want)
+		}
+	}
+}
+
+func TestSetFieldComparison(t *testing.T) {
+	// A field comparison is one condition, so in a set assignment it gates
+	// every bit instead of being split across them.
+	const header = "Device g22v10;\nPin [2..5] = [A0..3];\nPin [6..9] = [B0..3];\nPin [20..23] = [Y0..3];\nFIELD addr = [A3..0];\nFIELD out = [Y3..0];\n"
+	for _, eq := range []string{
+		"[Y0..3] = [B0..3] & addr:'h'5;",
+		"[Y0..3] = [B0..3] & addr:[5..5];",
+		"[Y0..3] = !(![B0..3] # !addr:5);",
+		"out = [B3..0] & addr:5;",
+	} {
+		content, err := Parse([]byte(header + eq + "\n"))
+		if err != nil {
+			t.Fatalf("%s: parse: %v", eq, err)
+		}
+		res, err := CompileDetailed(content)
+		if err != nil {
+			t.Fatalf("%s: compile: %v", eq, err)
+		}
+		// B = 'b'1101 on every run; A selects whether it passes.
+		for _, tt := range []struct {
+			a    [4]bool
+			want [4]bool // Y0..Y3
+		}{
+			{[4]bool{true, false, true, false}, [4]bool{true, false, true, true}},    // addr = 5
+			{[4]bool{false, true, true, false}, [4]bool{false, false, false, false}}, // addr = 6
+		} {
+			inputs := map[string]bool{"B0": true, "B1": false, "B2": true, "B3": true}
+			for i, v := range tt.a {
+				inputs[fmt.Sprintf("A%d", i)] = v
+			}
+			got, err := Simulate(content, res, inputs)
+			if err != nil {
+				t.Fatalf("%s: simulate: %v", eq, err)
+			}
+			for _, o := range got {
+				if want := tt.want[o.Pin-20]; o.Value != want {
+					t.Errorf("%s with A=%v: %s = %v, want %v", eq, tt.a, o.Name, o.Value, want)
+				}
+			}
+		}
+	}
+}
+
+func TestEvalExpr(t *testing.T) {
+	fields := map[string]Field{
+		"addr": {Name: "addr", Bits: []FieldBit{{Name: "A0", BitNumber: 0, HasNumber: true}, {Name: "A1", BitNumber: 1, HasNumber: true}, {Name: "A2", BitNumber: 2, HasNumber: true}}},
+		"inv":  {Name: "inv", Bits: []FieldBit{{Name: "A2", Neg: true}, {Name: "A1"}}},
+	}
+	// A0=1 A1=0 A2=1: addr is 5 and inv is 'b'00.
+	assign := map[string]bool{"A0": true, "A1": false, "A2": true}
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{"A0", true},
+		{"!A0 # A1", false},
+		{"A0 & A2", true},
+		{"A0 $ A2", false},
+		{"'b'1 & A1", false},
+		{"addr:5", true},
+		{"addr:'b'1X1", true},
+		{"addr:'b'0XX", false},
+		{"addr:[4..7]", true},
+		{"addr:[7..6]", false},
+		{"!addr:[0..3]", true},
+		{"inv:0", true},
+	}
+	for _, tt := range tests {
+		expr, err := parseExprText(tt.src, 1)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.src, err)
+		}
+		got, err := EvalExpr(expr, assign, fields)
+		if err != nil {
+			t.Errorf("%s: %v", tt.src, err)
+		} else if got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+	expr, _ := parseExprText("A0 & B", 1)
+	if _, err := EvalExpr(expr, assign, fields); err == nil || err.Error() != "B has no value" {
+		t.Errorf("unassigned signal: got %v", err)
+	}
+}
+
+func TestCompileFieldRangeBounds(t *testing.T) {
+	src := func(field, expr string) string {
+		return "Device g22v10;\nPin [2..9] = [a0..7];\nPin 23 = Y;\nFIELD x = " + field + ";\nY = " + expr + ";\n"
+	}
+	for _, tt := range []struct{ field, expr, want string }{
+		{"[a7..0]", "x:[0..'h'FFFF]", "line 5: range value 'hFFFF does not fit field x, which only holds 8 bits"},
+		{"[a0..3]", "x:['h'10..0]", "which only holds 4 bits"},
+		{"[a4..7]", "!x:[0..'h'100]", "which only holds 8 bits"},
+		{"[a0,a1,a2]", "x:[0..8]", "which only holds 3 bits"},
+	} {
+		if got := mustCompileError(t, src(tt.field, tt.expr)); !strings.Contains(got, tt.want) {
+			t.Errorf("%s %s: got %q, want %q", tt.field, tt.expr, got, tt.want)
+		}
+	}
+	// Numbered bits weigh by their number, so a high nibble takes values up
+	// to 'hFF, and a descending range is accepted.
+	for _, expr := range []string{"x:['h'F0..'h'FF]", "x:['h'FF..'h'80]"} {
+		c, err := Parse([]byte(src("[a4..7]", expr)))
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		if _, err := Compile(c); err != nil {
+			t.Errorf("%s: %v", expr, err)
+		}
+	}
+}
+
+func TestFieldConstants(t *testing.T) {
+	const header = "Device g22v10;\nPin [2..5] = [A12..15];\nPin 6 = SEL;\nPin 23 = Y;\nFIELD addr = [A15..12];\n"
+	compile := func(src string) *gal.GAL {
+		t.Helper()
+		c, err := Parse([]byte(header + src))
+		if err != nil {
+			t.Fatalf("%q: parse: %v", src, err)
+		}
+		g, err := Compile(c)
+		if err != nil {
+			t.Fatalf("%q: compile: %v", src, err)
+		}
+		return g
+	}
+	for _, tt := range []struct{ named, literal string }{
+		{"ROM = 'h'E;\nY = addr:ROM & SEL;\n", "Y = addr:'h'E & SEL;\n"},
+		{"$DEFINE ROM 'h'E\nY = addr:ROM;\n", "Y = addr:'h'E;\n"},
+		{"IO = 'b'11X1;\nY = !addr:IO;\n", "Y = !addr:'b'11X1;\n"},
+		{"LO = 'h'4;\nHI = 'h'B;\nY = addr:[LO..HI];\n", "Y = addr:['h'4..'h'B];\n"},
+		{"TOP = 'h'F;\nY = addr:[8..TOP] & SEL;\n", "Y = addr:[8..'h'F] & SEL;\n"},
+		// Used before it is defined.
+		{"Y = addr:ROM;\nROM = 'h'E;\n", "Y = addr:'h'E;\n"},
+		// A name that reads as hex is that number when no constant has it.
+		{"Y = addr:E & SEL;\n", "Y = addr:'h'E & SEL;\n"},
+		{"Y = addr:[C..E];\n", "Y = addr:['h'C..'h'E];\n"},
+	} {
+		if got, want := compile(tt.named), compile(tt.literal); !reflect.DeepEqual(got.Fuses, want.Fuses) {
+			t.Errorf("%q: fuses differ from %q", tt.named, tt.literal)
+		}
+	}
+
+	for _, tt := range []struct{ src, want string }{
+		{"ROM = SEL;\nY = addr:ROM;\n", "line 7: ROM is not a numeric constant (line 6)"},
+		{"Y = addr:[0..TOP];\n", "line 6: unknown constant TOP"},
+		{"E = 'h'4;\nY = addr:E;\n", "line 7: addr:E is ambiguous: E is a hex number and the constant on line 6; write 'h'E for the number or rename the constant"},
+		{"Y = addr:[C..F];\nC = 'h'4;\n", "line 6: addr:C is ambiguous: C is a hex number and the constant on line 7; write 'h'C for the number or rename the constant"},
+	} {
+		if got := mustCompileError(t, header+tt.src); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestFieldWidthLimit(t *testing.T) {
+	const header = "Device g22v10;\nPin 2 = a0;\nPin 23 = Y;\n"
+	for _, tt := range []struct{ field, want string }{
+		{"[a0..64]", "line 4: field x is 65 bits wide; fields are limited to 64 bits"},
+		// Numbered bits weigh by their number, so bit 70 needs 71 bits.
+		{"[a70..68]", "line 4: field x is 71 bits wide; fields are limited to 64 bits"},
+	} {
+		_, err := Parse([]byte(header + "FIELD x = " + tt.field + ";\n"))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%s: got %v, want %q", tt.field, err, tt.want)
+		}
+	}
+	if _, err := Parse([]byte(header + "FIELD x = [a0..63];\n")); err != nil {
+		t.Errorf("64-bit field: %v", err)
+	}
+
+	// Fields built without Parse are checked when compared.
+	c, err := Parse([]byte(header + "Y = x:1;\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	wide := Field{Name: "x"}
+	for i := 0; i <= 64; i++ {
+		wide.Bits = append(wide.Bits, FieldBit{Name: fmt.Sprintf("a%d", i), BitNumber: i, HasNumber: true})
+	}
+	c.Fields["x"] = wide
+	if _, err := Compile(c); err == nil || !strings.Contains(err.Error(), "field x is 65 bits wide") {
+		t.Errorf("compile: got %v", err)
+	}
+}
+
+// The GAL16V8/20V8/22V10 XOR fuse only sets an output's polarity; there is
+// no XOR gate between product terms to split A $ B across. Two-input XOR is
+// already at its minimum of two rows as a sum of products.
+func TestCompileRegisteredXorUsesTwoRows(t *testing.T) {
+	content, err := Parse([]byte("Device g22v10;\nPin 1 = Clock;\nPin 2 = A;\nPin 3 = B;\nPin 23 = Q;\nQ.D = A $ B;\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	g, err := Compile(content)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	chip := gal.ChipGAL22V10
+	olmc, _ := chip.PinToOLMC(23)
+	b := chip.BoundsForOLMC(olmc)
+	cols := chip.NumCols()
+	used := 0
+	for r := b.StartRow + 1; r < b.StartRow+b.MaxRows; r++ {
+		for _, f := range g.Fuses[r*cols : (r+1)*cols] {
+			if f {
+				used++
+				break
+			}
+		}
+	}
+	if used != 2 {
+		t.Errorf("A $ B uses %d product terms, want 2", used)
+	}
+}
+
+func TestCompileDetailed(t *testing.T) {
+	content, err := Parse([]byte("Device g16v8;\nPin 2 = A;\nPin 3 = B;\nPin 19 = Y;\nY = A & B # A & !B;\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	res, err := CompileDetailed(content)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	g, err := Compile(content)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	if !reflect.DeepEqual(res.GAL.Fuses, g.Fuses) {
+		t.Error("CompileDetailed and Compile fuses differ")
+	}
+	if res.Mode != gal.ModeSimple {
+		t.Errorf("mode %v, want simple", res.Mode)
+	}
+	if res.Symbols["B"].Pin != 3 {
+		t.Errorf("symbol B: got %+v, want pin 3", res.Symbols["B"])
+	}
+	if len(res.Outputs) != 1 {
+		t.Fatalf("got %d outputs, want 1", len(res.Outputs))
+	}
+	out := res.Outputs[0]
+	if out.Name != "Y" || out.Pin != 19 || len(out.Terms) != 2 || len(out.Minimized) != 1 {
+		t.Errorf("got %+v, want Y on pin 19 with 2 terms minimized to 1", out)
+	}
+	olmc, _ := gal.ChipGAL16V8.PinToOLMC(19)
+	if want := [][]gal.Pin{{{Pin: 2}}}; !reflect.DeepEqual(res.Blueprint.OLMC[olmc].Output.Pins, want) {
+		t.Errorf("Y terms: got %+v, want %v", res.Blueprint.OLMC[olmc].Output.Pins, want)
+	}
+
+	bp, err := CompileBlueprint(content)
+	if err != nil {
+		t.Fatalf("compile blueprint: %v", err)
+	}
+	if !reflect.DeepEqual(bp, res.Blueprint) {
+		t.Error("CompileBlueprint and CompileDetailed blueprints differ")
+	}
+}
+
+func TestCompileWarnsAtTermLimit(t *testing.T) {
+	const header = "Device g16v8;\nPin [2..9] = [A0..7];\nPin 19 = CS;\n"
+	for _, tc := range []struct {
+		logic string
+		want  []string
+	}{
+		// Simple mode: all 8 rows are logic.
+		{"CS = A0&A1 # A1&A2 # A2&A3 # A3&A4 # A4&A5 # A5&A6 # A6&A7;", nil},
+		{"CS = A0&A1 # A1&A2 # A2&A3 # A3&A4 # A4&A5 # A5&A6 # A6&A7 # A7&A0;", []string{"line 4: output CS uses 8/8 product terms"}},
+		// Complex mode: row 0 holds the output enable.
+		{"CS = A0&A1 # A1&A2 # A2&A3 # A3&A4 # A4&A5 # A5&A6 # A6&A7;\nCS.OE = A0;", []string{"line 4: output CS uses 7/7 product terms"}},
+	} {
+		content, err := Parse([]byte(header + tc.logic))
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		res, err := CompileDetailed(content)
+		if err != nil {
+			t.Fatalf("compile: %v", err)
+		}
+		if !reflect.DeepEqual(res.Warnings, tc.want) {
+			t.Errorf("%s: got warnings %q, want %q", tc.logic, res.Warnings, tc.want)
+		}
+	}
+}
+
+func TestCompileLintsUnusedDeclarations(t *testing.T) {
+	for _, tc := range []struct {
+		src  string
+		want []string
+	}{
+		{"Device g16v8;\nPin 2 = A;\nPin 3 = B;\nPin 19 = Y;\nY = A;", []string{"line 3: pin 3 (B) is declared but never used"}},
+		// A field comparison uses every bit; a bit used alone leaves its
+		// field unused.
+		{"Device g16v8;\nPin [2..3] = [A0..1];\nPin 4 = C;\nPin 19 = Y;\nField addr = [A1..0];\nY = addr:2;", []string{"line 3: pin 4 (C) is declared but never used"}},
+		{"Device g16v8;\nPin [2..3] = [A0..1];\nPin 19 = Y;\nField addr = [A1..0];\nY = A0 & A1;", []string{"field addr is declared but never used"}},
+		// Set operations name the field on either side.
+		{"Device g16v8;\nPin [2..3] = [A0..1];\nPin [18..19] = [Y0..1];\nField in = [A0..1];\nField out = [Y0..1];\nout = !in;", nil},
+		// Registered mode dedicates pin 1 to the clock and pin 11 to /OE.
+		{"Device g16v8;\nPin 1 = Clock;\nPin 2 = A;\nPin 11 = OE;\nPin 19 = Q;\nQ.D = A;", nil},
+		{"Device g22v10;\nPin 1 = Clock;\nPin 2 = A;\nPin 23 = Y;\nY = A;", []string{"line 2: pin 1 (Clock) is declared but never used"}},
+	} {
+		content, err := Parse([]byte(tc.src))
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		res, err := CompileDetailed(content)
+		if err != nil {
+			t.Fatalf("compile %q: %v", tc.src, err)
+		}
+		if !reflect.DeepEqual(res.Warnings, tc.want) {
+			t.Errorf("%q: got warnings %q, want %q", tc.src, res.Warnings, tc.want)
+		}
+		for _, w := range res.Warnings {
+			if !IsUnusedWarning(w) {
+				t.Errorf("%q: IsUnusedWarning(%q) = false", tc.src, w)
+			}
+		}
+	}
+}
+
+func TestLintPolarity(t *testing.T) {
+	const header = "Device g16v8;\nPin [2..3] = [A0..1];\n"
+	for _, tc := range []struct {
+		src  string
+		want []string
+	}{
+		{"Pin 19 = ROM_CS;\nROM_CS = A0 & A1;", []string{"line 4: output ROM_CS looks like an active-low chip select but is active-high"}},
+		{"Pin 19 = nWE1;\nnWE1 = A0;", []string{"line 4: output nWE1 looks like an active-low write enable but is active-high"}},
+		{"Pin 19 = !ROM_CS;\nROM_CS = A0 & A1;", nil},
+		{"Pin 19 = ROM_CS;\n!ROM_CS = A0 & A1;", nil},
+		{"Pin 19 = ROM_CS;\nROM_CS = !(A0 & A1);", nil},
+		// Inverted twice is active-high again.
+		{"Pin 19 = !OE;\nOE = !(A0 & A1);", []string{"line 4: output OE looks like an active-low output enable but is active-high"}},
+		{"Pin 19 = CASE;\nCASE = A0;", nil},
+	} {
+		content, err := Parse([]byte(header + tc.src))
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		res, err := CompileDetailed(content)
+		if err != nil {
+			t.Fatalf("compile %q: %v", tc.src, err)
+		}
+		if got := LintPolarity(res); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: got %q, want %q", tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestCompileFeedbackExtensions(t *testing.T) {
+	header := "Device g22v10;\nPin 1 = Clock;\nPin 2 = A;\nPin 22 = C;\nPin 23 = Q;\nPin 21 = Y;\nQ.D = A;\nC = !A;\n"
+	compile := func(rhs string) *gal.GAL {
+		t.Helper()
+		content, err := Parse([]byte(header + "Y = " + rhs + ";\n"))
+		if err != nil {
+			t.Fatalf("parse %s: %v", rhs, err)
+		}
+		g, err := Compile(content)
+		if err != nil {
+			t.Fatalf("compile %s: %v", rhs, err)
+		}
+		return g
+	}
+	plain := compile("Q & C & A")
+	for _, rhs := range []string{"Q.Q & C.IO & A.IO", "Q.DQ & C & A.io"} {
+		if !reflect.DeepEqual(compile(rhs).Fuses, plain.Fuses) {
+			t.Errorf("Y = %s differs from Y = Q & C & A", rhs)
+		}
+	}
+
+	for rhs, want := range map[string]string{
+		"Q.IO": "line 9: Q.IO: registered Q feeds back its register, not the pin (Q.Q)",
+		"C.Q":  "line 9: C.Q: C is not registered; its feedback is the pin (C.IO)",
+		"A.DQ": "line 9: A.Q: input A has no register",
+	} {
+		if msg := mustCompileError(t, header+"Y = "+rhs+";\n"); msg != want {
+			t.Errorf("Y = %s: got %q, want %q", rhs, msg, want)
+		}
+	}
+}
+
+func TestCompilePinAssignmentConflicts(t *testing.T) {
+	for _, tc := range []struct{ src, want string }{
+		{"Device g16v8;\nPin 2 = A;\nPin 3 = A;\nPin 19 = Y;\nY = A;\n", "line 3: A is assigned to both pin 2 (line 2) and pin 3"},
+		{"Device g16v8;\nPin 2 = A;\nPin 3 = Y;\nY = A;\n", "line 4: output Y is on pin 3 (line 3), which has no output macrocell; GAL16V8 outputs are pins 12-19"},
+		{"Device g22v10;\nPin 2 = A;\nPin 12 = B;\n", "line 3: pin 12 (B) is the GND pin of the GAL22V10"},
+		{"Device g16v8;\nPin [2..3] = [A0..1];\nPin 20 = EN;\n", "line 3: pin 20 (EN) is the VCC pin of the GAL16V8"},
+	} {
+		if msg := mustCompileError(t, tc.src); msg != tc.want {
+			t.Errorf("got %q, want %q", msg, tc.want)
+		}
+	}
+
+	_, err := Parse([]byte("Device g16v8;\nPin 2 = A;\nPin [1..2] = [B0..1];\n"))
+	if err == nil || err.Error() != "line 3: pin 2 is assigned to both A (line 2) and B1" {
+		t.Errorf("got %v, want a duplicate pin error", err)
+	}
+}
+
+func TestCompileComplexModeOutputFeedback(t *testing.T) {
+	// Pins 15 and 16 have no feedback in simple mode, so reading them back
+	// selects complex mode, where they use array columns 18 and 14.
+	src := "Device g16v8;\nPin 2 = A;\nPin 3 = B;\nPin 15 = F;\nPin 16 = G;\nPin 19 = Y;\nF = A & B;\nG = A # B;\nY = F & !G;\n"
+	content, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	g, err := Compile(content)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	if g.Mode() != gal.ModeComplex {
+		t.Fatalf("mode %s, want complex", g.Mode())
+	}
+	chip := gal.ChipGAL16V8
+	olmc, _ := chip.PinToOLMC(19)
+	row := chip.BoundsForOLMC(olmc).StartRow + 1 // row 0 is the OE term
+	cols := chip.NumCols()
+	var connected []int
+	for col := 0; col < cols; col++ {
+		if !g.Fuses[row*cols+col] {
+			connected = append(connected, col)
+		}
+	}
+	if want := []int{15, 18}; !reflect.DeepEqual(connected, want) {
+		t.Errorf("Y row connects columns %v, want %v (G inverted, F true)", connected, want)
+	}
+
+	for _, pin := range []int{12, 19} {
+		src := fmt.Sprintf("Device g16v8ma;\nPin 2 = A;\nPin %d = F;\nPin 17 = Y;\nY = F;\n", pin)
+		if msg := mustCompileError(t, src); !strings.Contains(msg, fmt.Sprintf("pin %d is not an input in complex mode", pin)) {
+			t.Errorf("pin %d feedback: %s", pin, msg)
+		}
+	}
+}
+
+func TestCompileAppendExtensionMismatch(t *testing.T) {
+	header := "Device g22v10;\nPin 1 = CLK;\nPin 2 = A;\nPin 3 = B;\nPin 23 = Q;\n"
+	for _, tc := range []struct{ eqs, want string }{
+		{"Q.D = A;\nAPPEND Q = B;\n", `line 7: APPEND to "Q" is combinatorial, but line 6 defines it registered (.D)`},
+		{"Q = A;\nAPPEND Q.D = B;\n", `line 7: APPEND to "Q" is registered (.D), but line 6 defines it combinatorial`},
+		{"Q.T = A;\nAPPEND Q = B;\n", `line 7: APPEND to "Q" is combinatorial, but line 6 defines it tristate (.T)`},
+	} {
+		if msg := mustCompileError(t, header+tc.eqs); msg != tc.want {
+			t.Errorf("%q: got %s, want %s", tc.eqs, msg, tc.want)
+		}
+	}
+
+	content, err := Parse([]byte(header + "Q.D = A;\nAPPEND Q.D = B;\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if _, err := Compile(content); err != nil {
+		t.Errorf("matching APPEND: %v", err)
+	}
+}
+
+func TestCompileToggleRegister(t *testing.T) {
+	// .T is a tristate output, so a WinCUPL toggle flip-flop written next to
+	// a .D equation is rejected with the .TOG form to use instead.
+	header := "Device g22v10;\nPin 1 = CLK;\nPin 2 = EN;\nPin 3 = UP;\nPin 23 = Q;\n"
+	for _, eqs := range []string{"Q.D = EN;\nQ.T = EN;\n", "Q.T = EN;\nQ.D = EN;\n"} {
+		want := `line 7: "Q" has both .D and .T equations (the other is on line 6); .T is a tristate output, not a toggle flip-flop, so write a toggle register as Q.TOG = toggle`
+		if msg := mustCompileError(t, header+eqs); msg != want {
+			t.Errorf("%q: got %s, want %s", eqs, msg, want)
+		}
+	}
+
+	compile := func(eq string) *gal.GAL {
+		t.Helper()
+		content, err := Parse([]byte(header + eq))
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		g, err := Compile(content)
+		if err != nil {
+			t.Fatalf("%q: compile: %v", eq, err)
+		}
+		return g
+	}
+	toggle := compile("Q.D = Q $ EN;\n")
+	if want := compile("Q.D = Q & !EN # !Q & EN;\n"); !reflect.DeepEqual(toggle.Fuses, want.Fuses) || !reflect.DeepEqual(toggle.Xor, want.Xor) {
+		t.Error("Q.D = Q $ EN differs from its sum of products")
+	}
+
+	// Q.TOG = t is the D register Q.D = Q $ t.
+	for _, tt := range []struct{ tog, d string }{
+		{"Q.TOG = EN;\n", "Q.D = Q $ EN;\n"},
+		{"!Q.TOG = EN;\n", "!Q.D = !Q $ EN;\n"},
+		{"Q.TOG = EN;\nAPPEND Q.TOG = UP;\n", "Q.D = Q $ (EN # UP);\n"},
+	} {
+		got, want := compile(tt.tog), compile(tt.d)
+		if !reflect.DeepEqual(got.Fuses, want.Fuses) || !reflect.DeepEqual(got.Xor, want.Xor) || !reflect.DeepEqual(got.AC1, want.AC1) {
+			t.Errorf("%q: fuses differ from %q", tt.tog, tt.d)
+		}
+	}
+	for _, tt := range []struct{ eqs, want string }{
+		{"Q.TOG = EN;\nQ.D = UP;\n", `line 7: "Q" is a toggle register (Q.TOG on line 6), so it cannot also have a registered (.D) equation`},
+		{"Q = UP;\nQ.TOG = EN;\n", `line 6: "Q" is a toggle register (Q.TOG on line 7), so it cannot also have a combinatorial equation`},
+		{"Q.TOG = EN;\nQ.TOG = UP;\n", `line 7: TOG for "Q" already defined on line 6`},
+	} {
+		if msg := mustCompileError(t, header+tt.eqs); msg != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.eqs, msg, tt.want)
+		}
+	}
+}
+
+func TestCompileClockEnable(t *testing.T) {
+	// No supported device has a clock enable, so Q.CE = EN becomes a hold
+	// term on the register: the same fuses as writing the feedback out.
+	header := "Device g22v10;\nPin 1 = CLK;\nPin 2 = A;\nPin 3 = B;\nPin 4 = EN;\nPin 23 = Q;\nPin 22 = Y;\n"
+	compile := func(eqs string) *gal.GAL {
+		t.Helper()
+		content, err := Parse([]byte(header + eqs))
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		g, err := Compile(content)
+		if err != nil {
+			t.Fatalf("%q: compile: %v", eqs, err)
+		}
+		return g
+	}
+	for _, tc := range []struct{ ce, held string }{
+		{"Q.D = A;\nQ.CE = EN;\n", "Q.D = Q & !EN # A & EN;\n"},
+		{"Q.CE = EN;\nQ.D = A & B;\n", "Q.D = Q & !EN # A & B & EN;\n"},
+		{"Q.D = A;\nAPPEND Q.D = B;\nQ.CE = EN;\n", "Q.D = Q & !EN # (A # B) & EN;\n"},
+		{"!Q.D = A;\nQ.CE = EN;\n", "!Q.D = !Q & !EN # A & EN;\n"},
+		{"Q.D = A;\n!Q.CE = EN;\n", "Q.D = Q & EN # A & !EN;\n"},
+	} {
+		got, want := compile(tc.ce), compile(tc.held)
+		if !reflect.DeepEqual(got.Fuses, want.Fuses) || !reflect.DeepEqual(got.Xor, want.Xor) {
+			t.Errorf("%q differs from %q", tc.ce, tc.held)
+		}
+	}
+
+	for _, tc := range []struct{ eqs, want string }{
+		{"Q.CE = EN;\n", "line 8: Q.CE needs a Q.D equation to enable"},
+		{"Y = A;\nY.CE = EN;\n", `line 8: Y.CE on line 9 needs a registered output, but "Y" is combinatorial`},
+		{"Q.D = A;\nQ.CE = EN;\nQ.CE = B;\n", `line 10: CE for "Q" already defined on line 9`},
+	} {
+		if msg := mustCompileError(t, header+tc.eqs); msg != tc.want {
+			t.Errorf("%q: got %s, want %s", tc.eqs, msg, tc.want)
+		}
+	}
+}
+
+func TestCompileAppendOE(t *testing.T) {
+	header := "Device g22v10;\nPin 2 = A;\nPin 3 = EN;\nPin 4 = B;\nPin 23 = Y;\nY = B;\n"
+	content, err := Parse([]byte(header + "Y.OE = EN & A;\nAPPEND Y.OE = EN & !A;\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	g, err := Compile(content)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	// The appended conditions are ORed and minimize to the single OE row EN.
+	chip := gal.ChipGAL22V10
+	olmc, _ := chip.PinToOLMC(23)
+	row := chip.BoundsForOLMC(olmc).StartRow
+	cols := chip.NumCols()
+	var connected []int
+	for col := 0; col < cols; col++ {
+		if !g.Fuses[row*cols+col] {
+			connected = append(connected, col)
+		}
+	}
+	if want := []int{8}; !reflect.DeepEqual(connected, want) {
+		t.Errorf("OE row connects columns %v, want %v (EN)", connected, want)
+	}
+
+	// The OE is a single row, so conditions that stay two products do not fit.
+	if msg := mustCompileError(t, header+"Y.OE = EN;\nAPPEND Y.OE = A;\n"); !strings.Contains(msg, "more than one product term") {
+		t.Errorf("two-term OE: %s", msg)
+	}
+	if msg := mustCompileError(t, header+"Y.OE = EN;\nY.OE = A;\n"); msg != `line 8: OE for "Y" already defined` {
+		t.Errorf("redefined OE: %s", msg)
+	}
+
+	// An active-low OE complements the whole sum, so an APPEND of the other
+	// polarity cannot be ORed in: !Y.OE = A; APPEND Y.OE = B; means !A # B,
+	// not !(A # B).
+	for _, tc := range []struct{ eqs, want string }{
+		{"!Y.OE = A;\nAPPEND Y.OE = B;\n", "line 8: APPEND to Y.OE is active-high, but line 7 defines it active-low"},
+		{"Y.OE = A;\nAPPEND !Y.OE = B;\n", "line 8: APPEND to Y.OE is active-low, but line 7 defines it active-high"},
+	} {
+		if msg := mustCompileError(t, header+tc.eqs); msg != tc.want {
+			t.Errorf("%q: got %s, want %s", tc.eqs, msg, tc.want)
+		}
+	}
+	content, err = Parse([]byte(header + "!Y.OE = A;\nAPPEND !Y.OE = B;\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if _, err := Compile(content); err != nil {
+		t.Errorf("matching active-low APPEND: %v", err)
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	a, b := ExprIdent{Name: "A"}, ExprIdent{Name: "B"}
+	notA := ExprNot{X: a}
+	one, zero := ExprConst{Value: true}, ExprConst{Value: false}
+	tests := []struct {
+		name string
+		in   Expr
+		want Expr
+	}{
+		{"A & A", ExprAnd{A: a, B: a}, a},
+		{"A # A", ExprOr{A: a, B: a}, a},
+		{"A & B & A", ExprAnd{A: ExprAnd{A: a, B: b}, B: a}, ExprAnd{A: a, B: b}},
+		{"A & !A", ExprAnd{A: a, B: notA}, zero},
+		{"A # !A", ExprOr{A: notA, B: a}, one},
+		{"B & A & !A", ExprAnd{A: b, B: ExprAnd{A: a, B: notA}}, zero},
+		{"A & 1", ExprAnd{A: a, B: one}, a},
+		{"A & 0", ExprAnd{A: a, B: zero}, zero},
+		{"A # 1", ExprOr{A: a, B: one}, one},
+		{"A # 0", ExprOr{A: zero, B: a}, a},
+		{"A $ 0", ExprXor{A: a, B: zero}, a},
+		{"1 $ A", ExprXor{A: one, B: a}, notA},
+		{"A $ A", ExprXor{A: a, B: a}, zero},
+		{"A $ !A", ExprXor{A: a, B: notA}, one},
+		{"!1", ExprNot{X: one}, zero},
+		{"!!A", ExprNot{X: ExprNot{X: a}}, a},
+		{"!(A & !A)", ExprNot{X: ExprAnd{A: a, B: notA}}, one},
+		{"(A # A) & (B # 0)", ExprAnd{A: ExprOr{A: a, B: a}, B: ExprOr{A: b, B: zero}}, ExprAnd{A: a, B: b}},
+		{"A & B", ExprAnd{A: a, B: b}, ExprAnd{A: a, B: b}},
+	}
+	for _, tt := range tests {
+		if got := simplify(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+
+	// A contradiction folds to no terms instead of a term DNF has to drop.
+	terms, err := exprToTerms(ExprOr{A: ExprAnd{A: a, B: notA}, B: ExprAnd{A: b, B: b}}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Term{{Lits: []Literal{{Name: "B"}}}}; !reflect.DeepEqual(terms, want) {
+		t.Errorf("A & !A # B & B: got %v, want %v", terms, want)
+	}
+}
+
+func TestCompileLatchEnable(t *testing.T) {
+	if info, err := parseEquationLHS("q.le"); err != nil || info.Extension != "LE" || info.Name != "q" {
+		t.Fatalf("parseEquationLHS(q.le) = %+v, %v", info, err)
+	}
+
+	src := "Device %s;\nPin 2 = A;\nPin 3 = G;\nPin %d = Q;\nQ = A;\nQ.LE = G;\n"
+	content, err := Parse([]byte(fmt.Sprintf(src, "g22v10", 23)))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	res, err := compileDesign(content, QuineMcCluskey)
+	if err != nil {
+		t.Fatalf("compileDesign: %v", err)
+	}
+	olmc, _ := gal.ChipGAL22V10.PinToOLMC(23)
+	le := res.Blueprint.OLMC[olmc].LETerm
+	if le == nil || le.Line != 6 || !reflect.DeepEqual(le.Pins, [][]gal.Pin{{{Pin: 3}}}) {
+		t.Fatalf("LETerm = %+v, want G on line 6", le)
+	}
+
+	for _, dev := range []struct {
+		name, chip string
+		pin        int
+	}{{"g16v8", "GAL16V8", 19}, {"g20v8", "GAL20V8", 22}, {"g22v10", "GAL22V10", 23}} {
+		want := fmt.Sprintf("line 6: %s has no latched outputs; pin %d cannot use .LE", dev.chip, dev.pin)
+		if msg := mustCompileError(t, fmt.Sprintf(src, dev.name, dev.pin)); msg != want {
+			t.Errorf("%s: got %q, want %q", dev.name, msg, want)
+		}
+	}
+}
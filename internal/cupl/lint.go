@@ -0,0 +1,77 @@
+package cupl
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// polarityRule is a signal name conventionally used for an active-low strobe
+// or enable.
+type polarityRule struct {
+	Name string // the name as a word of a signal name, e.g. CS in ROM_CS1
+	What string
+}
+
+// polarityRules are the names LintPolarity checks.
+var polarityRules = []polarityRule{
+	{"CS", "chip select"},
+	{"CE", "chip enable"},
+	{"OE", "output enable"},
+	{"WE", "write enable"},
+	{"RD", "read strobe"},
+	{"WR", "write strobe"},
+}
+
+// LintPolarity warns about outputs named like an active-low strobe (CS, OE,
+// WE and so on; see polarityRules) that the design drives active-high,
+// which usually means a missing ! on the pin or the equation. It is a
+// heuristic: a name matches when one of its words, split at underscores and
+// with any trailing number and bar marker (n, b, _N, ...) removed, is a rule
+// name, so ROM_CS, CS1 and nWE match but CASE does not.
+func LintPolarity(res *CompileResult) []string {
+	var lint []string
+	for _, out := range res.Outputs {
+		rule, ok := matchPolarityRule(out.Name)
+		if !ok || activeLowOutput(res, out.Name) {
+			continue
+		}
+		lint = append(lint, fmt.Sprintf("line %d: output %s looks like an active-low %s but is active-high", out.Line, out.Name, rule.What))
+	}
+	return lint
+}
+
+func matchPolarityRule(name string) (polarityRule, bool) {
+	for _, word := range strings.Split(strings.ToUpper(name), "_") {
+		word = strings.TrimRightFunc(word, unicode.IsDigit)
+		for _, rule := range polarityRules {
+			switch word {
+			case rule.Name, "N" + rule.Name, rule.Name + "N", rule.Name + "B":
+				return rule, true
+			}
+		}
+	}
+	return polarityRule{}, false
+}
+
+// activeLowOutput reports whether the output is written as active-low: an
+// odd number of the pin declaration, the equation's left-hand side and its
+// whole right-hand side are inverted, as in CS = !(A15 & A14);.
+func activeLowOutput(res *CompileResult, name string) bool {
+	activeLow := res.Symbols[name].ActiveLow
+	for _, eq := range res.Equations {
+		info, err := parseEquationLHS(eq.LHS)
+		if err != nil || info.Name != name || !outputExtension(info.Extension) {
+			continue
+		}
+		_, inverted := eq.Expr.(ExprNot)
+		return activeLow != info.ActiveLow != inverted
+	}
+	return activeLow
+}
+
+// outputExtension reports whether an equation with the normalized extension
+// ext drives the output itself, rather than its enable, clock or resets.
+func outputExtension(ext string) bool {
+	return ext == "" || ext == "R" || ext == "T"
+}
@@ -1,12 +1,39 @@
 package cupl
 
-import "sort"
+import (
+	"math/bits"
+	"sort"
+	"strings"
+)
+
+// Minimizer reduces an output's sum of products for minimization levels 1
+// and up; level 0 keeps terms as written without calling it. dontCare lists
+// input combinations the result may cover or not.
+type Minimizer interface {
+	Minimize(terms, dontCare []Term) []Term
+}
+
+// MinimizerFunc adapts a function to the Minimizer interface.
+type MinimizerFunc func(terms, dontCare []Term) []Term
+
+func (f MinimizerFunc) Minimize(terms, dontCare []Term) []Term { return f(terms, dontCare) }
+
+// QuineMcCluskey is the default Minimizer.
+var QuineMcCluskey Minimizer = MinimizerFunc(minimizeTermsDC)
 
 // minimizeTerms applies Quine-McCluskey minimization to reduce the number
 // of product terms. This finds all prime implicants, then selects a minimum
-// cover using essential prime implicants followed by greedy selection.
+// cover using essential prime implicants followed by Petrick's method, or
+// greedy selection for large problems.
 func minimizeTerms(terms []Term) []Term {
-	if len(terms) <= 1 {
+	return minimizeTermsDC(terms, nil)
+}
+
+// minimizeTermsDC is minimizeTerms with a don't-care set: input combinations
+// matched by dontCare may be merged into product terms but need not be
+// covered. TABLE and CONDITION pass the inputs none of their rows match.
+func minimizeTermsDC(terms, dontCare []Term) []Term {
+	if len(terms) == 0 || len(terms) == 1 && len(dontCare) == 0 {
 		return terms
 	}
 	// Short-circuit if any term is TRUE (empty literals = always true)
@@ -17,7 +44,7 @@ func minimizeTerms(terms []Term) []Term {
 	}
 
 	// Convert terms to implicant representation for efficient comparison
-	vars, varIndex := collectVars(terms)
+	vars, varIndex := collectVars(append(terms[:len(terms):len(terms)], dontCare...))
 	if len(vars) == 0 {
 		return terms
 	}
@@ -38,6 +65,10 @@ func minimizeTerms(terms []Term) []Term {
 	if len(mintermSet) == 0 {
 		return terms
 	}
+	dcSet := make(map[uint64]bool)
+	for _, t := range dontCare {
+		expandMinterms(termToImplicant(t, varIndex), numVars, &dcSet)
+	}
 
 	// Convert to sorted minterm list
 	minterms := make([]uint64, 0, len(mintermSet))
@@ -46,13 +77,20 @@ func minimizeTerms(terms []Term) []Term {
 	}
 	sort.Slice(minterms, func(i, j int) bool { return minterms[i] < minterms[j] })
 
-	// Find all prime implicants via Quine-McCluskey
-	primes := findPrimeImplicants(minterms, numVars)
+	// Find all prime implicants via Quine-McCluskey; don't-cares take part
+	// in merging but are left out of the cover.
+	candidates := minterms
+	for m := range dcSet {
+		if !mintermSet[m] {
+			candidates = append(candidates, m)
+		}
+	}
+	primes := findPrimeImplicants(candidates, numVars)
 
 	// Select minimum cover
 	selected := minimumCover(primes, minterms, numVars)
 
-	if len(selected) < len(terms) {
+	if len(selected) < len(terms) || len(dcSet) > 0 && len(selected) == len(terms) && countLits(selected) < countLits(inputImps) {
 		// QM reduced term count — use QM result, sort descending
 		sort.Slice(selected, func(i, j int) bool {
 			if selected[i].value != selected[j].value {
@@ -73,6 +111,30 @@ func minimizeTerms(terms []Term) []Term {
 	return implicantsToTerms(inputImps, vars)
 }
 
+// dedupeTerms drops repeated product terms, keeping the first occurrence and
+// the original order. It is the only reduction applied at MIN level 0.
+func dedupeTerms(terms []Term) []Term {
+	seen := make(map[string]bool, len(terms))
+	out := make([]Term, 0, len(terms))
+	for _, t := range terms {
+		keys := make([]string, len(t.Lits))
+		for i, l := range t.Lits {
+			keys[i] = l.Name
+			if l.Neg {
+				keys[i] = "!" + l.Name
+			}
+		}
+		sort.Strings(keys)
+		key := strings.Join(keys, "&")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, t)
+	}
+	return out
+}
+
 // implicant represents a product term using bitmasks.
 // value holds the bit values for care positions; mask has 1=care, 0=don't-care.
 type implicant struct {
@@ -127,8 +189,9 @@ func expandMinterms(imp implicant, numVars int, out *map[uint64]bool) {
 }
 
 // findPrimeImplicants implements the QM merge phase.
-// Groups implicants by popcount and iteratively merges pairs that differ
-// in exactly one bit, collecting all unmerged implicants as prime implicants.
+// Groups implicants by mask and popcount and iteratively merges pairs from
+// adjacent groups that differ in exactly one bit, collecting all unmerged
+// implicants as prime implicants.
 func findPrimeImplicants(minterms []uint64, numVars int) []implicant {
 	fullMask := uint64((1 << numVars) - 1)
 
@@ -140,29 +203,38 @@ func findPrimeImplicants(minterms []uint64, numVars int) []implicant {
 
 	primeSet := make(map[implicant]bool)
 
+	// Two implicants can only merge if they share a mask and their values
+	// differ by one set bit, so each is compared with the group one popcount
+	// above it rather than with every other implicant.
+	type group struct {
+		mask uint64
+		ones int
+	}
 	for len(current) > 0 {
 		merged := make(map[implicant]bool)
 		used := make(map[implicant]bool)
 
-		// Convert to slice for iteration
-		impList := make([]implicant, 0, len(current))
+		groups := make(map[group][]implicant)
 		for imp := range current {
-			impList = append(impList, imp)
+			g := group{mask: imp.mask, ones: bits.OnesCount64(imp.value & imp.mask)}
+			groups[g] = append(groups[g], imp)
 		}
 
-		// Try all pairs
-		for i := 0; i < len(impList); i++ {
-			for j := i + 1; j < len(impList); j++ {
-				if m, ok := tryMerge(impList[i], impList[j]); ok {
-					merged[m] = true
-					used[impList[i]] = true
-					used[impList[j]] = true
+		for g, lower := range groups {
+			upper := groups[group{mask: g.mask, ones: g.ones + 1}]
+			for _, a := range lower {
+				for _, b := range upper {
+					if m, ok := tryMerge(a, b); ok {
+						merged[m] = true
+						used[a] = true
+						used[b] = true
+					}
 				}
 			}
 		}
 
 		// Unmerged implicants are prime
-		for _, imp := range impList {
+		for imp := range current {
 			if !used[imp] {
 				primeSet[imp] = true
 			}
@@ -204,7 +276,8 @@ func tryMerge(a, b implicant) (implicant, bool) {
 }
 
 // minimumCover selects a minimum set of prime implicants that cover all minterms.
-// Uses essential prime implicants first, then greedy selection.
+// Uses essential prime implicants first, then Petrick's method, falling back
+// to greedy selection when the remaining problem is too large.
 func minimumCover(primes []implicant, minterms []uint64, numVars int) []implicant {
 	if len(primes) == 0 {
 		return nil
@@ -279,7 +352,24 @@ func minimumCover(primes []implicant, minterms []uint64, numVars int) []implican
 		}
 	}
 
-	// Phase 2: Greedy cover for remaining minterms
+	// Phase 2: Petrick's method for an exact cover of what the essential
+	// primes leave, typically a cyclic core where greedy can overshoot.
+	if uncoveredCount > 0 {
+		remaining := make([]implicant, 0, len(pInfos))
+		covers := make([]map[int]bool, 0, len(pInfos))
+		for _, p := range pInfos {
+			if p.covers != nil {
+				remaining = append(remaining, p.imp)
+				covers = append(covers, p.covers)
+			}
+		}
+		if chosen, ok := petrickCover(remaining, covers, uncovered); ok {
+			return append(selected, chosen...)
+		}
+	}
+
+	// Phase 3: Greedy cover for remaining minterms when the problem is too
+	// large for Petrick's method
 	for uncoveredCount > 0 {
 		bestPI := -1
 		bestCount := 0
@@ -314,6 +404,112 @@ func minimumCover(primes []implicant, minterms []uint64, numVars int) []implican
 	return selected
 }
 
+// maxPetrickPrimes and maxPetrickProducts bound Petrick's method; larger
+// covering problems fall back to the greedy cover.
+const (
+	maxPetrickPrimes   = 64
+	maxPetrickProducts = 4096
+)
+
+// petrickCover returns a minimum set of primes covering every uncovered
+// minterm. covers[i] holds the minterm indices primes[i] covers. The cover
+// condition, a product of sums with one sum of primes per minterm, is
+// multiplied out into a sum of products, absorbing supersets as it goes.
+// Among the smallest products, fewer literals win, then the primes listed
+// first. It reports false if the problem is too large.
+func petrickCover(primes []implicant, covers []map[int]bool, uncovered []bool) ([]implicant, bool) {
+	if len(primes) > maxPetrickPrimes {
+		return nil, false
+	}
+	products := []uint64{0}
+	for mi, open := range uncovered {
+		if !open {
+			continue
+		}
+		var sum uint64
+		for pi, c := range covers {
+			if c[mi] {
+				sum |= 1 << pi
+			}
+		}
+		if sum == 0 {
+			return nil, false
+		}
+		var next []uint64
+		for _, p := range products {
+			if p&sum != 0 {
+				next = append(next, p) // already covered
+				continue
+			}
+			for s := sum; s != 0; s &= s - 1 {
+				next = append(next, p|s&-s)
+			}
+		}
+		if len(next) > maxPetrickProducts*len(primes) {
+			return nil, false // too many to absorb cheaply
+		}
+		products = absorbProducts(next)
+		if len(products) > maxPetrickProducts {
+			return nil, false
+		}
+	}
+
+	lits := func(p uint64) int {
+		n := 0
+		for s := p; s != 0; s &= s - 1 {
+			n += bits.OnesCount64(primes[bits.TrailingZeros64(s)].mask)
+		}
+		return n
+	}
+	best := products[0]
+	for _, p := range products[1:] {
+		pc, bc := bits.OnesCount64(p), bits.OnesCount64(best)
+		if pc < bc || pc == bc && (lits(p) < lits(best) || lits(p) == lits(best) && bits.Reverse64(p) > bits.Reverse64(best)) {
+			best = p
+		}
+	}
+	var out []implicant
+	for s := best; s != 0; s &= s - 1 {
+		out = append(out, primes[bits.TrailingZeros64(s)])
+	}
+	return out, true
+}
+
+// absorbProducts drops duplicate products and any product that is a
+// superset of another (X + XY = X). The result is sorted by size, then value.
+func absorbProducts(products []uint64) []uint64 {
+	sort.Slice(products, func(i, j int) bool {
+		ci, cj := bits.OnesCount64(products[i]), bits.OnesCount64(products[j])
+		if ci != cj {
+			return ci < cj
+		}
+		return products[i] < products[j]
+	})
+	var out []uint64
+	for _, p := range products {
+		absorbed := false
+		for _, q := range out {
+			if p&q == q {
+				absorbed = true
+				break
+			}
+		}
+		if !absorbed {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// countLits returns the number of literals across the implicants.
+func countLits(imps []implicant) int {
+	n := 0
+	for _, imp := range imps {
+		n += bits.OnesCount64(imp.mask)
+	}
+	return n
+}
+
 // collectVars gathers sorted unique variable names and builds an index map.
 func collectVars(terms []Term) ([]string, map[string]int) {
 	seen := make(map[string]bool)
@@ -1,6 +1,8 @@
 package cupl
 
 import (
+	"fmt"
+	"math/bits"
 	"reflect"
 	"sort"
 	"testing"
@@ -112,3 +114,187 @@ func TestMinimizeTerms_Subsumption(t *testing.T) {
 		t.Errorf("got %v, want %v", result, expected)
 	}
 }
+
+func TestMinimizeTermsDC_SingleTerm(t *testing.T) {
+	// A&B with don't-care A&!B → A
+	terms := []Term{
+		{Lits: []Literal{{Name: "A"}, {Name: "B"}}},
+	}
+	dontCare := []Term{
+		{Lits: []Literal{{Name: "A"}, {Name: "B", Neg: true}}},
+	}
+	result := minimizeTermsDC(terms, dontCare)
+	expected := []Term{
+		{Lits: []Literal{{Name: "A"}}},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("got %v, want %v", result, expected)
+	}
+}
+
+func TestMinimizeTermsDC_MergesTerms(t *testing.T) {
+	// !A&!B&C # A&B&C with don't-cares !A&B&C and A&!B → C, since every
+	// minterm with C set is either on or don't-care.
+	terms := []Term{
+		{Lits: []Literal{{Name: "A", Neg: true}, {Name: "B", Neg: true}, {Name: "C"}}},
+		{Lits: []Literal{{Name: "A"}, {Name: "B"}, {Name: "C"}}},
+	}
+	dontCare := []Term{
+		{Lits: []Literal{{Name: "A", Neg: true}, {Name: "B"}, {Name: "C"}}},
+		{Lits: []Literal{{Name: "A"}, {Name: "B", Neg: true}}},
+	}
+	result := minimizeTermsDC(terms, dontCare)
+	expected := []Term{
+		{Lits: []Literal{{Name: "C"}}},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("got %v, want %v", result, expected)
+	}
+}
+
+func TestMinimizeTerms_CyclicCover(t *testing.T) {
+	// Σm(0,1,2,5,6,7) over A,B,C has six two-minterm primes and no essential
+	// one. Greedy selection takes 4 of them; the minimum cover is 3.
+	var terms []Term
+	for _, m := range []int{0, 1, 2, 5, 6, 7} {
+		terms = append(terms, Term{Lits: []Literal{
+			{Name: "A", Neg: m&1 == 0},
+			{Name: "B", Neg: m&2 == 0},
+			{Name: "C", Neg: m&4 == 0},
+		}})
+	}
+	result := minimizeTerms(terms)
+	if len(result) != 3 {
+		t.Fatalf("got %d terms %v, want 3", len(result), result)
+	}
+	for m := 0; m < 8; m++ {
+		want := m != 3 && m != 4
+		got := false
+		for _, term := range result {
+			match := true
+			for _, l := range term.Lits {
+				bit := map[string]int{"A": 1, "B": 2, "C": 4}[l.Name]
+				if (m&bit != 0) == l.Neg {
+					match = false
+				}
+			}
+			got = got || match
+		}
+		if got != want {
+			t.Errorf("minterm %d: got %v, want %v", m, got, want)
+		}
+	}
+	if again := minimizeTerms(terms); !reflect.DeepEqual(again, result) {
+		t.Errorf("non-deterministic: %v then %v", result, again)
+	}
+}
+
+func TestFindPrimeImplicantsMatchesPairwise(t *testing.T) {
+	// pairwise is the plain QM merge: every implicant against every other.
+	pairwise := func(minterms []uint64, numVars int) map[implicant]bool {
+		fullMask := uint64(1)<<numVars - 1
+		current := make(map[implicant]bool)
+		for _, m := range minterms {
+			current[implicant{value: m, mask: fullMask}] = true
+		}
+		primes := make(map[implicant]bool)
+		for len(current) > 0 {
+			merged := make(map[implicant]bool)
+			used := make(map[implicant]bool)
+			for a := range current {
+				for b := range current {
+					if m, ok := tryMerge(a, b); ok {
+						merged[m] = true
+						used[a] = true
+					}
+				}
+			}
+			for imp := range current {
+				if !used[imp] {
+					primes[imp] = true
+				}
+			}
+			current = merged
+		}
+		return primes
+	}
+	for name, terms := range minimizeBenchInputs(t) {
+		if name == "addr12" {
+			continue // slow without grouping
+		}
+		vars, varIndex := collectVars(terms)
+		set := make(map[uint64]bool)
+		for _, term := range terms {
+			expandMinterms(termToImplicant(term, varIndex), len(vars), &set)
+		}
+		var minterms []uint64
+		for m := range set {
+			minterms = append(minterms, m)
+		}
+		got := make(map[implicant]bool)
+		for _, p := range findPrimeImplicants(minterms, len(vars)) {
+			got[p] = true
+		}
+		if want := pairwise(minterms, len(vars)); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: %d primes, want %d", name, len(got), len(want))
+		}
+	}
+}
+
+// minimizeBenchInputs are sums of products large enough for the QM merge
+// phase to dominate: address decodes, parity (nothing merges) and a dense
+// pseudo-random function.
+func minimizeBenchInputs(tb testing.TB) map[string][]Term {
+	addr := func(width int, lo, hi uint64) []Term {
+		field := Field{Name: "addr"}
+		for i := width - 1; i >= 0; i-- {
+			field.Bits = append(field.Bits, FieldBit{Name: fmt.Sprintf("A%d", i), BitNumber: i, HasNumber: true})
+		}
+		terms, err := fieldRangeTerms(ExprFieldRange{Field: "addr", Lo: lo, Hi: hi}, map[string]Field{"addr": field}, false)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		return terms
+	}
+	minterms := func(width int, keep func(v uint64) bool) []Term {
+		var terms []Term
+		for v := uint64(0); v < 1<<width; v++ {
+			if !keep(v) {
+				continue
+			}
+			var t Term
+			for i := 0; i < width; i++ {
+				t.Lits = append(t.Lits, Literal{Name: fmt.Sprintf("I%d", i), Neg: v>>i&1 == 0})
+			}
+			terms = append(terms, t)
+		}
+		return terms
+	}
+	seed := uint64(1)
+	return map[string][]Term{
+		"addr12":  addr(12, 0x123, 0xEDC),
+		"addr16":  addr(16, 0x0FF0, 0x1F0F),
+		"parity8": minterms(8, func(v uint64) bool { return bits.OnesCount64(v)%2 == 1 }),
+		"random10": minterms(10, func(uint64) bool {
+			seed = seed*6364136223846793005 + 1442695040888963407
+			return seed>>63 == 1
+		}),
+	}
+}
+
+func BenchmarkMinimize(b *testing.B) {
+	inputs := minimizeBenchInputs(b)
+	names := make([]string, 0, len(inputs))
+	for name := range inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		terms := inputs[name]
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				minimizeTerms(terms)
+			}
+		})
+	}
+}
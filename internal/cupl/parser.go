@@ -2,33 +2,182 @@ package cupl
 
 import (
 	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"unicode"
 )
 
 func Parse(src []byte) (Content, error) {
-	text := stripComments(string(src))
-	stmts := splitStatements(text)
+	return ParseWithOptions(src, ParseOptions{})
+}
+
+// ParseOptions configures ParseWithOptions.
+type ParseOptions struct {
+	// Defines are set before the first line, as if by $DEFINE. They take
+	// precedence over a $DEFINE of the same name in the source.
+	Defines map[string]string
+	// FS reads $INCLUDE files, which are resolved relative to the directory
+	// of File, the source's own path within FS. Without an FS, $INCLUDE is
+	// an error.
+	FS   fs.FS
+	File string
+}
+
+// ParseFile parses the CUPL source file at path, resolving $INCLUDE paths
+// relative to its directory.
+func ParseFile(path string) (Content, error) {
+	return ParseFileWithOptions(path, ParseOptions{})
+}
+
+// ParseFileWithOptions is ParseFile with initial defines.
+func ParseFileWithOptions(path string, opts ParseOptions) (Content, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Content{}, err
+	}
+	opts.FS, opts.File = IncludeFS(path)
+	return ParseWithOptions(src, opts)
+}
+
+// IncludeFS returns a file system for ParseOptions.FS and the path of the
+// source file at path within it. The file system is rooted at the volume
+// root, so $INCLUDE "../common/pins.inc" can leave the source's directory.
+func IncludeFS(path string) (fs.FS, string) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	root := filepath.VolumeName(abs) + string(filepath.Separator)
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		return os.DirFS(filepath.Dir(abs)), filepath.Base(abs)
+	}
+	return os.DirFS(root), filepath.ToSlash(rel)
+}
+
+// ParseWithOptions parses CUPL source like Parse, with initial defines and
+// a file system for $INCLUDE.
+func ParseWithOptions(src []byte, opts ParseOptions) (Content, error) {
+	for name := range opts.Defines {
+		if !isIdent(name) {
+			return Content{}, fmt.Errorf("invalid define name %q", name)
+		}
+	}
+	stripped, err := stripComments(string(src))
+	if err != nil {
+		return Content{}, err
+	}
+	text, lineMap, where, err := preprocess(stripped, opts)
+	if err != nil {
+		return Content{}, err
+	}
 	c := Content{
 		Meta:      make(map[string]string),
 		Pins:      make(map[int]PinDef),
+		Nodes:     make(map[int]PinDef),
 		Fields:    make(map[string]Field),
 		Equations: nil,
+		MinLevel:  DefaultMinLevel,
 	}
+	text, err = splitVectors(&c, text, lineMap)
+	if err != nil {
+		return c, err
+	}
+	stmts := splitStatements(text)
 	lineOffsets := lineOffsets(text)
 	for _, st := range stmts {
 		if strings.TrimSpace(st.text) == "" {
 			continue
 		}
-		line := lineOfOffset(lineOffsets, st.offset)
-		if err := parseStatement(&c, st.text, line); err != nil {
+		// Report the line of the statement's first token in the original source.
+		start := st.offset + len(st.text) - len(strings.TrimLeftFunc(st.text, unicode.IsSpace))
+		n := lineOfOffset(lineOffsets, start) - 1
+		err := checkTerminated(st, lineOffsets, lineMap)
+		if err == nil {
+			err = parseStatement(&c, st.text, lineMap[n])
+		}
+		if err != nil {
+			if pe, ok := err.(*ParseError); ok {
+				pe.locate(text, st, lineOffsets, lineMap)
+			}
+			if where[n] != "" {
+				// The statement came from an $INCLUDE file; its line is
+				// that of the directive.
+				err = fmt.Errorf("%w (in %s)", err, where[n])
+			}
 			return c, err
 		}
 	}
 	return c, nil
 }
 
+// checkTerminated reports a statement that runs into the next one because a
+// ';' is missing, such as Y = A followed by a PIN on the next line. Without
+// it the two would be parsed as one, with a confusing error or none at all.
+// Lines inside braces belong to a TABLE or CONDITION and are not checked.
+func checkTerminated(st statement, offsets []int, lineMap []int) error {
+	depth := 0
+	prev := -1 // offset in st.text of the last non-blank line so far
+	for off := 0; off < len(st.text); {
+		end := strings.IndexByte(st.text[off:], '\n')
+		if end < 0 {
+			end = len(st.text)
+		} else {
+			end += off
+		}
+		line := strings.TrimSpace(st.text[off:end])
+		if line != "" {
+			if prev >= 0 && depth == 0 && statementStart.MatchString(line+" ") {
+				prevLine := lineMap[lineOfOffset(offsets, st.offset+prev)-1]
+				return fmt.Errorf("line %d: missing ';' before line %d", prevLine, lineMap[lineOfOffset(offsets, st.offset+off)-1])
+			}
+			prev = off
+		}
+		depth += strings.Count(line, "{") - strings.Count(line, "}")
+		off = end + 1
+	}
+	return nil
+}
+
+// ParseError is a syntax error inside an expression.
+type ParseError struct {
+	Line   int    // 1-based source line
+	Column int    // 1-based byte column in Source, 0 if unknown
+	Token  string // offending token text, empty at end of input
+	Source string // the full source line containing the error
+	Msg    string
+
+	expr string // expression text that pos is relative to
+	pos  int
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// locate resolves the error position within statement st of the
+// preprocessed text into a line, column and source line.
+func (e *ParseError) locate(text string, st statement, offsets []int, lineMap []int) {
+	rel := strings.LastIndex(st.text, e.expr)
+	if rel < 0 {
+		return
+	}
+	off := st.offset + rel + e.pos
+	n := lineOfOffset(offsets, off)
+	e.Line = lineMap[n-1]
+	e.Column = off - offsets[n-1] + 1
+	end := len(text)
+	if n < len(offsets) {
+		end = offsets[n] - 1
+	}
+	e.Source = text[offsets[n-1]:end]
+}
+
 func parseStatement(c *Content, stmt string, line int) error {
 	s := strings.TrimSpace(stmt)
 	if s == "" {
@@ -37,18 +186,56 @@ func parseStatement(c *Content, stmt string, line int) error {
 	upper := strings.ToUpper(s)
 
 	// Header/meta directives
-	for _, key := range []string{"NAME", "PARTNO", "REVISION", "DATE", "DESIGNER", "COMPANY", "LOCATION", "ASSEMBLY", "DEVICE"} {
+	for _, key := range headerKeywords {
 		if strings.HasPrefix(upper, key+" ") || strings.EqualFold(s, key) {
 			val := strings.TrimSpace(s[len(key):])
 			if key == "DEVICE" {
 				c.Device = strings.TrimSpace(val)
 			} else {
-				c.Meta[strings.Title(strings.ToLower(key))] = strings.TrimSpace(val)
+				c.setMeta(strings.Title(strings.ToLower(key)), val)
 			}
 			return nil
 		}
 	}
 
+	if orderDirective.MatchString(s) {
+		return parseOrder(c, s, line)
+	}
+
+	if m := minDirective.FindStringSubmatch(s); m != nil {
+		level, err := strconv.Atoi(m[1])
+		if err != nil || level > MaxMinLevel {
+			return fmt.Errorf("line %d: MIN level must be 0-%d", line, MaxMinLevel)
+		}
+		c.MinLevel = level
+		return nil
+	}
+	if m := minOutputDirective.FindStringSubmatch(s); m != nil {
+		level, err := strconv.Atoi(m[2])
+		if err != nil || level > MaxMinLevel {
+			return fmt.Errorf("line %d: MIN level must be 0-%d", line, MaxMinLevel)
+		}
+		if c.MinLevels == nil {
+			c.MinLevels = make(map[string]int)
+		}
+		c.MinLevels[m[1]] = level
+		return nil
+	}
+	if m := rowDirective.FindStringSubmatch(s); m != nil {
+		row, err := strconv.Atoi(m[2])
+		if err != nil {
+			return fmt.Errorf("line %d: ROW %s: invalid row %q", line, m[1], m[2])
+		}
+		if c.Rows == nil {
+			c.Rows = make(map[string]int)
+		}
+		c.Rows[m[1]] = row
+		return nil
+	}
+
+	if strings.HasPrefix(upper, "PINNODE ") || strings.HasPrefix(upper, "PINNODE[") {
+		return parsePinNode(c, s, line)
+	}
 	if strings.HasPrefix(upper, "PIN ") {
 		return parsePin(c, s, line)
 	}
@@ -72,14 +259,158 @@ func parseStatement(c *Content, stmt string, line int) error {
 		return parseCondition(c, s, line)
 	}
 
+	// Any other "KEY value" statement ahead of the pins and equations is a
+	// custom header directive, kept for the JEDEC header.
+	if m := customHeader.FindStringSubmatch(s); m != nil && c.inHeader() {
+		if key, ok := nearHeaderKeyword(m[1]); ok {
+			return fmt.Errorf("line %d: unknown header %s; did you mean %s?", line, m[1], key)
+		}
+		c.setMeta(m[1], m[2])
+		return nil
+	}
+
 	// Equation
 	return parseEquation(c, s, line, false)
 }
 
+// headerKeywords are the header directives; any other KEY value statement in
+// the header is a custom header.
+var headerKeywords = []string{"NAME", "PARTNO", "REVISION", "DATE", "DESIGNER", "COMPANY", "LOCATION", "ASSEMBLY", "USERID", "DEVICE"}
+
+// nearHeaderKeyword returns the header keyword that name looks like a
+// misspelling of, such as DEVICE for Devcie or PARTNO for Partnum: a name of
+// five or more letters one edit away from a keyword, or sharing its first
+// five letters. Short names such as PART or DATA are left as custom headers.
+func nearHeaderKeyword(name string) (string, bool) {
+	upper := strings.ToUpper(name)
+	if len(upper) < 5 {
+		return "", false
+	}
+	for _, key := range headerKeywords {
+		if editDistance(upper, key) <= 1 || len(key) >= 5 && upper[:5] == key[:5] {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// editDistance returns the number of single-character insertions,
+// deletions, substitutions and adjacent transpositions that turn a into b.
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+// setMeta records a header directive, remembering the order keys first
+// appear in.
+func (c *Content) setMeta(key, val string) {
+	if _, ok := c.Meta[key]; !ok {
+		c.MetaOrder = append(c.MetaOrder, key)
+	}
+	c.Meta[key] = strings.TrimSpace(val)
+}
+
+// inHeader reports whether no pins, fields or equations have been parsed yet.
+func (c *Content) inHeader() bool {
+	return len(c.Pins) == 0 && len(c.Nodes) == 0 && len(c.Fields) == 0 && len(c.Equations) == 0
+}
+
+var (
+	orderDirective = regexp.MustCompile(`(?i)^ORDER\s*:`)
+	minDirective   = regexp.MustCompile(`(?i)^MIN\s+(\d+)$`)
+	// minOutputDirective is "MIN name[.ext] = level". The level applies to
+	// all of the output's equations, so the extension is accepted and ignored.
+	minOutputDirective = regexp.MustCompile(`(?i)^MIN\s+([A-Za-z_][A-Za-z0-9_]*)(?:\.[A-Za-z]+)?\s*=\s*(\d+)$`)
+	// rowDirective is "ROW name[.ext] = row", the output's first product
+	// term row counted after its OE row.
+	rowDirective     = regexp.MustCompile(`(?i)^ROW\s+([A-Za-z_][A-Za-z0-9_]*)(?:\.[A-Za-z]+)?\s*=\s*(\d+)$`)
+	vectorsDirective = regexp.MustCompile(`(?im)^[ \t]*VECTORS\s*:`)
+	customHeader     = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)\s+([^=]+)$`)
+	// statementStart matches a line that can only begin a statement: a
+	// keyword followed by its argument, or an assignment.
+	statementStart = regexp.MustCompile(`(?i)^((PIN|PINNODE|FIELD|APPEND|TABLE|CONDITION|NAME|PARTNO|REVISION|DATE|DESIGNER|COMPANY|LOCATION|ASSEMBLY|USERID|DEVICE|MIN|ROW)\s|(PIN|PINNODE)\[|!?([A-Za-z_][A-Za-z0-9_]*|\[[^\]]*\])(\.[A-Za-z]+)?\s*=[^>])`)
+)
+
+// parseOrder parses "ORDER: A, B, %2, Y". %n entries only pad the listing in
+// WinCUPL and are skipped.
+func parseOrder(c *Content, stmt string, line int) error {
+	s := strings.TrimSpace(stmt[strings.Index(stmt, ":")+1:])
+	c.Order = nil
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if strings.HasPrefix(name, "%") {
+			continue
+		}
+		if !isIdent(name) {
+			return fmt.Errorf("line %d: ORDER invalid signal %q", line, name)
+		}
+		c.Order = append(c.Order, name)
+	}
+	if len(c.Order) == 0 {
+		return fmt.Errorf("line %d: ORDER lists no signals", line)
+	}
+	return nil
+}
+
+// splitVectors removes a trailing VECTORS: section from text and parses it
+// into c.Vectors. Each following non-blank line is one vector; whitespace
+// between values is ignored.
+func splitVectors(c *Content, text string, lineMap []int) (string, error) {
+	loc := vectorsDirective.FindStringIndex(text)
+	if loc == nil {
+		return text, nil
+	}
+	first := strings.Count(text[:loc[0]], "\n")
+	for i, row := range strings.Split(text[loc[1]:], "\n") {
+		line := lineMap[first+i]
+		values := strings.Map(func(r rune) rune {
+			if unicode.IsSpace(r) {
+				return -1
+			}
+			return unicode.ToUpper(r)
+		}, row)
+		if values == "" {
+			continue
+		}
+		if i := strings.IndexFunc(values, func(r rune) bool { return !strings.ContainsRune("01CHLZX", r) }); i >= 0 {
+			return "", fmt.Errorf("line %d: invalid test vector value %q", line, values[i])
+		}
+		c.Vectors = append(c.Vectors, TestVector{Line: line, Values: values})
+	}
+	return text[:loc[0]], nil
+}
+
 func parsePin(c *Content, stmt string, line int) error {
+	return parsePinAssignment(c.Pins, "pin", strings.TrimSpace(stmt)[len("PIN"):], line)
+}
+
+// parsePinNode parses "PINNODE n = name" and "PINNODE [n..m] = [name..]",
+// which name buried OLMC nodes instead of package pins.
+func parsePinNode(c *Content, stmt string, line int) error {
+	return parsePinAssignment(c.Nodes, "node", strings.TrimSpace(stmt)[len("PINNODE"):], line)
+}
+
+func parsePinAssignment(dst map[int]PinDef, kind, stmt string, line int) error {
 	s := strings.TrimSpace(stmt)
-	s = strings.TrimPrefix(s, "Pin")
-	s = strings.TrimSpace(s)
 	if strings.HasPrefix(s, "[") {
 		parts := strings.SplitN(s, "=", 2)
 		if len(parts) != 2 {
@@ -99,8 +430,9 @@ func parsePin(c *Content, stmt string, line int) error {
 			return fmt.Errorf("line %d: pin list length %d != signal list length %d", line, len(pins), len(bits))
 		}
 		for i, pin := range pins {
-			name := bits[i]
-			c.Pins[pin] = PinDef{Name: name, ActiveLow: false}
+			if err := assignPin(dst, kind, pin, PinDef{Name: bits[i], Line: line}); err != nil {
+				return err
+			}
 		}
 		return nil
 	}
@@ -123,7 +455,16 @@ func parsePin(c *Content, stmt string, line int) error {
 	if val == "" {
 		return fmt.Errorf("line %d: invalid pin name", line)
 	}
-	c.Pins[pinNum] = PinDef{Name: val, ActiveLow: activeLow}
+	return assignPin(dst, kind, pinNum, PinDef{Name: val, ActiveLow: activeLow, Line: line})
+}
+
+// assignPin records def for pin, rejecting a pin number that an earlier
+// statement already assigned.
+func assignPin(dst map[int]PinDef, kind string, pin int, def PinDef) error {
+	if prev, ok := dst[pin]; ok {
+		return fmt.Errorf("line %d: %s %d is assigned to both %s (line %d) and %s", def.Line, kind, pin, prev.Name, prev.Line, def.Name)
+	}
+	dst[pin] = def
 	return nil
 }
 
@@ -133,13 +474,23 @@ func parseField(c *Content, stmt string, line int) error {
 		return fmt.Errorf("line %d: invalid field", line)
 	}
 	name := strings.TrimSpace(parts[0])
-	bits, err := parseIdentRange(parts[1])
+	spec := strings.TrimSpace(parts[1])
+	bits, err := parseIdentRange(strings.ReplaceAll(spec, "!", ""))
 	if err != nil {
 		return fmt.Errorf("line %d: %w", line, err)
 	}
+	// A member written !Name is complemented; a range takes the polarity of
+	// its first member ([!D7..!D0] or [!D7..0]).
+	inner := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(spec, "["), "]"))
+	members := strings.Split(inner, ",")
 	field := Field{Name: name}
-	for _, b := range bits {
+	for i, b := range bits {
 		bit := FieldBit{Name: b}
+		if strings.Contains(inner, "..") {
+			bit.Neg = strings.HasPrefix(inner, "!")
+		} else {
+			bit.Neg = strings.HasPrefix(strings.TrimSpace(members[i]), "!")
+		}
 		if prefix, num, ok := splitIdentNumber(b); ok {
 			_ = prefix
 			bit.BitNumber = num
@@ -147,6 +498,9 @@ func parseField(c *Content, stmt string, line int) error {
 		}
 		field.Bits = append(field.Bits, bit)
 	}
+	if err := checkFieldWidth(field); err != nil {
+		return fmt.Errorf("line %d: %w", line, err)
+	}
 	c.Fields[name] = field
 	return nil
 }
@@ -162,21 +516,34 @@ func parseEquation(c *Content, stmt string, line int, isAppend bool) error {
 		return fmt.Errorf("line %d: invalid equation", line)
 	}
 
-	// Handle bracket LHS: [Y0..3] = expr  →  expand to per-bit equations
-	if strings.HasPrefix(lhs, "[") {
-		lhsIdents, err := parseIdentRange(lhs)
+	// Handle bracket LHS: [Y0..3] = expr  →  expand to per-bit equations.
+	// ![Y0..3] = expr makes each bit's equation active-low.
+	if set := strings.TrimSpace(strings.TrimPrefix(lhs, "!")); strings.HasPrefix(set, "[") {
+		lhsIdents, err := parseIdentRange(set)
 		if err != nil {
 			return fmt.Errorf("line %d: %w", line, err)
 		}
+		if set != lhs {
+			for i := range lhsIdents {
+				lhsIdents[i] = "!" + lhsIdents[i]
+			}
+		}
 		// Parse RHS with bracket-set awareness
-		rhsIdents := parseBracketSetRHS(rhs)
-		if rhsIdents != nil && len(rhsIdents) == len(lhsIdents) {
-			// Simple case: [Y0..3] = [A0..3]  (direct assignment)
+		rhsExprs, isList, err := parseBracketSetRHS(rhs, line)
+		if err != nil {
+			return err
+		}
+		if isList && len(rhsExprs) != len(lhsIdents) {
+			return fmt.Errorf("line %d: set of %d expressions is assigned to %d bits", line, len(rhsExprs), len(lhsIdents))
+		}
+		if rhsExprs != nil && len(rhsExprs) == len(lhsIdents) {
+			// Simple case: [Y0..3] = [A0..3] or [Y0..1] = [a&b, c], one
+			// member per bit
 			for i, lhsName := range lhsIdents {
 				c.Equations = append(c.Equations, Equation{
 					Line:   line,
 					LHS:    lhsName,
-					Expr:   rhsIdents[i],
+					Expr:   rhsExprs[i],
 					Append: isAppend,
 				})
 			}
@@ -197,14 +564,9 @@ func parseEquation(c *Content, stmt string, line int, isAppend bool) error {
 			tmpField.Bits = append(tmpField.Bits, bit)
 		}
 
-		lex := newLexer(rhs)
-		p := exprParser{lex: lex}
-		expr, err := p.parseExpr()
+		expr, err := parseExprText(rhs, line)
 		if err != nil {
-			return fmt.Errorf("line %d: %w", line, err)
-		}
-		if tok := lex.peek(); tok.kind != tokEOF {
-			return fmt.Errorf("line %d: unexpected token %q", line, tok.text)
+			return err
 		}
 
 		// Expand to per-bit with the temporary field context
@@ -215,7 +577,10 @@ func parseEquation(c *Content, stmt string, line int, isAppend bool) error {
 		fieldsWithTmp[tmpFieldName] = tmpField
 
 		width := len(lhsIdents)
-		bitExprs := exprToBitExprs(expr, width, fieldsWithTmp)
+		bitExprs, err := exprToBitExprs(expr, width, fieldsWithTmp)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
 		for i, be := range bitExprs {
 			c.Equations = append(c.Equations, Equation{
 				Line:   line,
@@ -227,35 +592,99 @@ func parseEquation(c *Content, stmt string, line int, isAppend bool) error {
 		return nil
 	}
 
-	lex := newLexer(rhs)
-	p := exprParser{lex: lex}
-	expr, err := p.parseExpr()
+	if f, ok := c.Fields[strings.TrimSpace(strings.TrimPrefix(lhs, "!"))]; ok {
+		if err := checkFieldTarget(f); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	expr, err := parseExprText(rhs, line)
 	if err != nil {
-		return fmt.Errorf("line %d: %w", line, err)
+		return err
 	}
-	if tok := lex.peek(); tok.kind != tokEOF {
-		return fmt.Errorf("line %d: unexpected token %q", line, tok.text)
+	// NAME = <number>; also names the number for field:NAME comparisons.
+	if l := newLexer(rhs); isIdent(lhs) && l.next().kind == tokNumber && l.next().kind == tokEOF {
+		if v, m, err := parseNumberWithMask(rhs); err == nil {
+			if c.Constants == nil {
+				c.Constants = make(map[string]Constant)
+			}
+			c.Constants[lhs] = Constant{Value: v, Mask: m, Line: line}
+		}
 	}
 	c.Equations = append(c.Equations, Equation{Line: line, LHS: lhs, Expr: expr, Append: isAppend})
 	return nil
 }
 
-// parseBracketSetRHS tries to parse RHS as a simple bracket set [A0..3]
-// Returns nil if it's not a simple bracket set
-func parseBracketSetRHS(rhs string) []Expr {
+// checkFieldTarget rejects assigning to a field with complemented members,
+// which would need each member's equation inverted.
+func checkFieldTarget(f Field) error {
+	for _, b := range f.Bits {
+		if b.Neg {
+			return fmt.Errorf("field %s cannot be assigned: member !%s is complemented; declare its pin active-low instead", f.Name, b.Name)
+		}
+	}
+	return nil
+}
+
+// parseExprText parses a complete expression. Errors are *ParseError.
+func parseExprText(text string, line int) (Expr, error) {
+	p := exprParser{lex: newLexer(text)}
+	expr, err := p.parseExpr()
+	if err == nil {
+		err = p.expectEOF()
+	}
+	if err != nil {
+		err.(*ParseError).Line = line
+		return nil, err
+	}
+	return expr, nil
+}
+
+// parseBracketSetRHS tries to parse RHS as a whole bracket set: a range
+// [A0..3], or a list [a&b, c, !d] whose members are full expressions. isList
+// reports the latter, which must match the assigned set member for member.
+// It returns nil if rhs is not a bracket set on its own, such as a set
+// inside a larger expression, and an error only for a malformed member.
+func parseBracketSetRHS(rhs string, line int) (exprs []Expr, isList bool, err error) {
 	rhs = strings.TrimSpace(rhs)
 	if !strings.HasPrefix(rhs, "[") || !strings.HasSuffix(rhs, "]") {
-		return nil
+		return nil, false, nil
 	}
-	idents, err := parseIdentRange(rhs)
-	if err != nil {
-		return nil
+	p := exprParser{lex: newLexer(rhs)}
+	p.lex.next() // consume [
+	if tok := p.lex.peek(); tok.kind == tokIdent || tok.kind == tokNumber {
+		// [A0..3] is a range, not an expression.
+		p.lex.next()
+		if p.lex.peek().kind == tokDotDot {
+			idents, err := parseIdentRange(rhs)
+			if err != nil {
+				return nil, false, nil
+			}
+			exprs := make([]Expr, len(idents))
+			for i, name := range idents {
+				exprs[i] = ExprIdent{Name: name}
+			}
+			return exprs, false, nil
+		}
+		p.lex = newLexer(rhs)
+		p.lex.next()
 	}
-	exprs := make([]Expr, len(idents))
-	for i, name := range idents {
-		exprs[i] = ExprIdent{Name: name}
+	for {
+		e, err := p.parseExpr()
+		if err != nil {
+			err.(*ParseError).Line = line
+			return nil, false, err
+		}
+		exprs = append(exprs, e)
+		if p.lex.peek().kind != tokComma {
+			break
+		}
+		p.lex.next()
+	}
+	// [a, b] # [c, d] is an expression of sets; leave it to the caller.
+	if p.lex.next().kind != tokRBrack || p.lex.peek().kind != tokEOF {
+		return nil, false, nil
 	}
-	return exprs
+	return exprs, true, nil
 }
 
 func parseTable(c *Content, stmt string, line int) error {
@@ -284,6 +713,8 @@ func parseTable(c *Content, stmt string, line int) error {
 	rows := strings.Split(body, ";")
 	// Track which outputs have been seen for APPEND
 	seen := map[string]bool{}
+	start := len(c.Equations)
+	var listed []ExprFieldEquality
 
 	for _, row := range rows {
 		row = strings.TrimSpace(row)
@@ -309,6 +740,7 @@ func parseTable(c *Content, stmt string, line int) error {
 		// For each output bit that is set, append an equation:
 		// outputBit = inputField:inVal (with mask)
 		inputExpr := ExprFieldEquality{Field: inputFieldName, Value: inVal, Mask: inMask}
+		listed = append(listed, inputExpr)
 
 		// We need to know the output field's bits to figure out which output pins correspond to which bits
 		// Desugar: for each output bit position where outVal has a 1, emit an APPEND equation for that bit's pin name
@@ -330,12 +762,17 @@ func parseTable(c *Content, stmt string, line int) error {
 		if !ok {
 			return fmt.Errorf("line %d: TABLE unknown field %q", line, outputFieldName)
 		}
+		if err := checkFieldTarget(outField); err != nil {
+			return fmt.Errorf("line %d: TABLE %w", line, err)
+		}
 
 		width := len(outField.Bits)
+		outBits := fieldBitsByWeight(outField)
+		projOut := projectValue(outField, outVal)
 		for i := 0; i < width; i++ {
-			bit := outField.Bits[i]
+			bit := outBits[i]
 			bitPos := width - 1 - i // MSB first
-			if (outVal>>bitPos)&1 == 1 {
+			if (projOut>>bitPos)&1 == 1 {
 				isAppend := seen[bit.Name]
 				c.Equations = append(c.Equations, Equation{
 					Line:   line,
@@ -347,9 +784,65 @@ func parseTable(c *Content, stmt string, line int) error {
 			}
 		}
 	}
+	if dc := tableDontCare(c.Fields[inputFieldName], listed); dc != nil {
+		for i := start; i < len(c.Equations); i++ {
+			c.Equations[i].DontCare = dc
+		}
+	}
 	return nil
 }
 
+// maxDontCareBits bounds the TABLE input width whose unlisted values are
+// enumerated as don't-cares.
+const maxDontCareBits = 10
+
+// tableDontCare returns the input values no TABLE row lists, as a sum of
+// minterms over the field bits. It returns nil when every value is listed or
+// the field is too wide to enumerate.
+func tableDontCare(field Field, listed []ExprFieldEquality) Expr {
+	width := len(field.Bits)
+	if width == 0 || width > maxDontCareBits {
+		return nil
+	}
+	values := make([]uint64, len(listed))
+	masks := make([]uint64, len(listed))
+	for i, fe := range listed {
+		masks[i] = projectValue(field, fe.Mask)
+		values[i] = projectValue(field, fe.Value) & masks[i]
+	}
+	var dc Expr
+	for v := uint64(0); v < 1<<width; v++ {
+		covered := false
+		for i := range listed {
+			if v&masks[i] == values[i] {
+				covered = true
+				break
+			}
+		}
+		if covered {
+			continue
+		}
+		var term Expr
+		for i, b := range fieldBitsByWeight(field) {
+			var lit Expr = ExprIdent{Name: b.Name}
+			if ((v>>(width-1-i))&1 == 0) != b.Neg {
+				lit = ExprNot{X: lit}
+			}
+			if term == nil {
+				term = lit
+			} else {
+				term = ExprAnd{A: term, B: lit}
+			}
+		}
+		if dc == nil {
+			dc = term
+		} else {
+			dc = ExprOr{A: dc, B: term}
+		}
+	}
+	return dc
+}
+
 func parseCondition(c *Content, stmt string, line int) error {
 	// CONDITION { IF <expr> OUT <var>; ... DEFAULT OUT <var>; }
 	s := strings.TrimSpace(stmt)
@@ -405,11 +898,10 @@ func parseCondition(c *Content, stmt string, line int) error {
 			}
 			exprStr := strings.TrimSpace(rest[:outIdx])
 			varsStr := strings.TrimSpace(rest[outIdx+5:])
-			lex := newLexer(exprStr)
-			p := exprParser{lex: lex}
-			expr, err := p.parseExpr()
+			expr, err := parseExprText(exprStr, line)
 			if err != nil {
-				return fmt.Errorf("line %d: CONDITION expr: %w", line, err)
+				err.(*ParseError).Msg = "CONDITION expr: " + err.(*ParseError).Msg
+				return err
 			}
 			allConditions = append(allConditions, expr)
 			vars := strings.Split(varsStr, ",")
@@ -425,44 +917,49 @@ func parseCondition(c *Content, stmt string, line int) error {
 			return fmt.Errorf("line %d: CONDITION unexpected clause %q", line, clause)
 		}
 	}
+	// none holds when no IF condition does: the DEFAULT outputs, or
+	// don't-care inputs for the IF outputs when there is no DEFAULT.
+	var none Expr
+	for i, cond := range allConditions {
+		negCond := ExprNot{X: cond}
+		if i == 0 {
+			none = negCond
+		} else {
+			none = ExprAnd{A: none, B: negCond}
+		}
+	}
+	if none == nil {
+		none = ExprConst{Value: true}
+	}
+	var dontCare Expr
+	if len(defaults) == 0 && len(allConditions) > 0 {
+		dontCare = none
+	}
 	// Emit IF equations
 	for _, ic := range ifs {
 		for _, v := range ic.vars {
 			isAppend := seen[v]
 			c.Equations = append(c.Equations, Equation{
-				Line:   line,
-				LHS:    v,
-				Expr:   ic.expr,
-				Append: isAppend,
+				Line:     line,
+				LHS:      v,
+				Expr:     ic.expr,
+				Append:   isAppend,
+				DontCare: dontCare,
 			})
 			seen[v] = true
 		}
 	}
 	// Emit DEFAULT equations: DEFAULT = AND of NOT(each IF condition)
-	if len(defaults) > 0 {
-		var defaultExpr Expr
-		for i, cond := range allConditions {
-			negCond := ExprNot{X: cond}
-			if i == 0 {
-				defaultExpr = negCond
-			} else {
-				defaultExpr = ExprAnd{A: defaultExpr, B: negCond}
-			}
-		}
-		if defaultExpr == nil {
-			defaultExpr = ExprConst{Value: true}
-		}
-		for _, dc := range defaults {
-			for _, v := range dc.vars {
-				isAppend := seen[v]
-				c.Equations = append(c.Equations, Equation{
-					Line:   line,
-					LHS:    v,
-					Expr:   defaultExpr,
-					Append: isAppend,
-				})
-				seen[v] = true
-			}
+	for _, dc := range defaults {
+		for _, v := range dc.vars {
+			isAppend := seen[v]
+			c.Equations = append(c.Equations, Equation{
+				Line:   line,
+				LHS:    v,
+				Expr:   none,
+				Append: isAppend,
+			})
+			seen[v] = true
 		}
 	}
 	return nil
@@ -494,11 +991,11 @@ func parseIntList(s string) ([]int, error) {
 			if startStr == "" || endStr == "" {
 				return nil, fmt.Errorf("invalid integer %q", p)
 			}
-			start, err := strconv.Atoi(startStr)
+			start, err := parseListNumber(startStr)
 			if err != nil {
 				return nil, fmt.Errorf("invalid integer %q", p)
 			}
-			end, err := strconv.Atoi(endStr)
+			end, err := parseListNumber(endStr)
 			if err != nil {
 				return nil, fmt.Errorf("invalid integer %q", p)
 			}
@@ -513,7 +1010,7 @@ func parseIntList(s string) ([]int, error) {
 			}
 			continue
 		}
-		v, err := strconv.Atoi(p)
+		v, err := parseListNumber(p)
 		if err != nil {
 			return nil, fmt.Errorf("invalid integer %q", p)
 		}
@@ -522,6 +1019,23 @@ func parseIntList(s string) ([]int, error) {
 	return out, nil
 }
 
+// parseListNumber parses one pin number or range bound. Unlike expression
+// and TABLE numbers these default to decimal, but accept a 'b', 'o', 'd' or
+// 'h' base prefix; don't-care digits are not allowed.
+func parseListNumber(s string) (int, error) {
+	if len(s) >= 3 && s[0] == '\'' {
+		if strings.ContainsAny(s[strings.LastIndex(s, "'")+1:], "Xx") {
+			return 0, fmt.Errorf("invalid integer %q", s)
+		}
+		v, _, err := parseNumberWithMask(s)
+		if err != nil || v > 1<<31-1 {
+			return 0, fmt.Errorf("invalid integer %q", s)
+		}
+		return int(v), nil
+	}
+	return strconv.Atoi(s)
+}
+
 func parseIdentRange(s string) ([]string, error) {
 	s = strings.TrimSpace(s)
 	if !strings.HasPrefix(s, "[") || !strings.HasSuffix(s, "]") {
@@ -622,25 +1136,34 @@ const (
 	tokRBrack
 	tokDotDot
 	tokComma
-	tokArrow // =>
+	tokArrow     // =>
+	tokArrowImpl // ->
+	tokError     // a character or number the lexer cannot read; see msg
 )
 
 type token struct {
 	kind tokenKind
 	text string
+	pos  int // byte offset in the lexer input
+
+	// msg describes a tokError, and errPos is the offset of the offending
+	// character within text.
+	msg    string
+	errPos int
 }
 
 type lexer struct {
-	s string
-	i int
+	s    string
+	i    int
+	last token // most recently consumed token
 }
 
 func newLexer(s string) *lexer { return &lexer{s: s} }
 
 func (l *lexer) peek() token {
-	pos := l.i
+	pos, last := l.i, l.last
 	tok := l.next()
-	l.i = pos
+	l.i, l.last = pos, last
 	return tok
 }
 
@@ -648,6 +1171,14 @@ func (l *lexer) next() token {
 	for l.i < len(l.s) && unicode.IsSpace(rune(l.s[l.i])) {
 		l.i++
 	}
+	start := l.i
+	tok := l.scan()
+	tok.pos = start
+	l.last = tok
+	return tok
+}
+
+func (l *lexer) scan() token {
 	if l.i >= len(l.s) {
 		return token{kind: tokEOF}
 	}
@@ -696,23 +1227,15 @@ func (l *lexer) next() token {
 			l.i += 2
 			return token{kind: tokArrow, text: "=>"}
 		}
+	case '-':
+		if l.i+1 < len(l.s) && l.s[l.i+1] == '>' {
+			l.i += 2
+			return token{kind: tokArrowImpl, text: "->"}
+		}
 	}
 
 	if ch == '\'' {
-		// Parse '<base>'<digits> fully
-		if l.i+2 < len(l.s) {
-			base := l.s[l.i+1]
-			if l.i+2 < len(l.s) && l.s[l.i+2] == '\'' {
-				// '<base>'<digits...>
-				l.i += 3 // skip '<base>'
-				start := l.i
-				for l.i < len(l.s) && isBaseDigit(l.s[l.i], base) {
-					l.i++
-				}
-				digits := l.s[start:l.i]
-				return token{kind: tokNumber, text: fmt.Sprintf("'%c'%s", base, digits)}
-			}
-		}
+		return l.scanBasedNumber()
 	}
 
 	if isIdentStart(ch) {
@@ -721,6 +1244,7 @@ func (l *lexer) next() token {
 		for l.i < len(l.s) && isIdentPart(l.s[l.i]) {
 			l.i++
 		}
+		l.i += feedbackSuffixLen(l.s[l.i:])
 		return token{kind: tokIdent, text: l.s[start:l.i]}
 	}
 	if isNumberStart(ch) {
@@ -733,7 +1257,71 @@ func (l *lexer) next() token {
 	}
 
 	l.i++
-	return token{kind: tokEOF}
+	return token{kind: tokError, text: l.s[l.i-1 : l.i], msg: fmt.Sprintf("unexpected character %q", ch)}
+}
+
+// scanBasedNumber scans a number with a base prefix, such as 'b'10X1. The
+// digits run to the end of the word, so a digit the base does not allow is
+// an error at that digit rather than the start of another token.
+func (l *lexer) scanBasedNumber() token {
+	start := l.i
+	if l.i+2 >= len(l.s) || l.s[l.i+2] != '\'' {
+		l.i++
+		return token{kind: tokError, text: "'", msg: "malformed based number, want 'b', 'o', 'd' or 'h' before the digits"}
+	}
+	base := l.s[l.i+1]
+	l.i += 3
+	for l.i < len(l.s) && isIdentPart(l.s[l.i]) {
+		l.i++
+	}
+	tok := token{kind: tokNumber, text: l.s[start:l.i]}
+	digits := tok.text[3:]
+	switch {
+	case !isBaseDigit('0', base):
+		tok.kind, tok.msg, tok.errPos = tokError, fmt.Sprintf("unknown base %q", base), 1
+	case digits == "":
+		tok.kind, tok.msg = tokError, fmt.Sprintf("%s has no digits", tok.text)
+	default:
+		for i := 0; i < len(digits); i++ {
+			if !isBaseDigit(digits[i], base) {
+				tok.kind, tok.msg, tok.errPos = tokError, fmt.Sprintf("invalid digit %q in %s", digits[i], tok.text), 3+i
+				break
+			}
+		}
+	}
+	return tok
+}
+
+// feedbackSuffixLen returns the length of a .IO, .Q or .DQ feedback
+// extension at the start of s, or 0.
+func feedbackSuffixLen(s string) int {
+	if len(s) < 2 || s[0] != '.' {
+		return 0
+	}
+	n := 1
+	for n < len(s) && isIdentPart(s[n]) {
+		n++
+	}
+	switch strings.ToUpper(s[1:n]) {
+	case "IO", "Q", "DQ":
+		return n
+	}
+	return 0
+}
+
+// splitFeedback splits an identifier token into its name and normalized
+// feedback extension: "IO" for pin feedback, "Q" for register feedback.
+func splitFeedback(text string) (string, string) {
+	i := strings.LastIndexByte(text, '.')
+	if i < 0 {
+		return text, ""
+	}
+	switch ext := strings.ToUpper(text[i+1:]); ext {
+	case "DQ":
+		return text[:i], "Q"
+	default:
+		return text[:i], ext
+	}
 }
 
 func isBaseDigit(b byte, base byte) bool {
@@ -773,8 +1361,48 @@ type exprParser struct {
 	lex *lexer
 }
 
-// Precedence (lowest to highest): XOR < OR < AND < NOT
-func (p *exprParser) parseExpr() (Expr, error) { return p.parseXor() }
+// errorf reports an error at the most recently consumed token.
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return p.errorAt(p.lex.last, format, args...)
+}
+
+func (p *exprParser) errorAt(tok token, format string, args ...interface{}) error {
+	if tok.kind == tokError {
+		// The lexer's reason is closer to the mistake than the parser's.
+		return &ParseError{Msg: tok.msg, Token: tok.text, expr: p.lex.s, pos: tok.pos + tok.errPos}
+	}
+	return &ParseError{Msg: fmt.Sprintf(format, args...), Token: tok.text, expr: p.lex.s, pos: tok.pos}
+}
+
+// expectEOF reports any token left over after a complete expression.
+func (p *exprParser) expectEOF() error {
+	if tok := p.lex.peek(); tok.kind != tokEOF {
+		return p.errorAt(tok, "unexpected token %q", tok.text)
+	}
+	return nil
+}
+
+// Precedence (lowest to highest): -> < XOR < OR < AND < NOT
+func (p *exprParser) parseExpr() (Expr, error) { return p.parseImpl() }
+
+// parseImpl parses the implication extension a -> b, which is not WinCUPL
+// syntax. It is lowered to !a # b and groups to the right, so a -> b -> c
+// is a -> (b -> c).
+func (p *exprParser) parseImpl() (Expr, error) {
+	left, err := p.parseXor()
+	if err != nil {
+		return nil, err
+	}
+	if p.lex.peek().kind != tokArrowImpl {
+		return left, nil
+	}
+	p.lex.next()
+	right, err := p.parseImpl()
+	if err != nil {
+		return nil, err
+	}
+	return ExprOr{A: ExprNot{X: left}, B: right}, nil
+}
 
 func (p *exprParser) parseXor() (Expr, error) {
 	left, err := p.parseOr()
@@ -862,45 +1490,55 @@ func (p *exprParser) parsePrimary() (Expr, error) {
 				p.lex.next()
 				loTok := p.lex.next()
 				if loTok.kind != tokNumber && loTok.kind != tokIdent {
-					return nil, fmt.Errorf("expected number in range")
+					return nil, p.errorf("expected number in range")
 				}
 				if p.lex.next().kind != tokDotDot {
-					return nil, fmt.Errorf("expected .. in range")
+					return nil, p.errorf("expected .. in range")
 				}
 				hiTok := p.lex.next()
 				if hiTok.kind != tokNumber && hiTok.kind != tokIdent {
-					return nil, fmt.Errorf("expected number in range")
+					return nil, p.errorf("expected number in range")
 				}
 				if p.lex.next().kind != tokRBrack {
-					return nil, fmt.Errorf("expected ] in range")
+					return nil, p.errorf("expected ] in range")
 				}
-				lo, err := parseNumber(loTok.text)
-				if err != nil {
+				fr := ExprFieldRange{Field: tok.text}
+				var err error
+				if fr.Lo, fr.LoConst, err = p.fieldBound(loTok); err != nil {
 					return nil, err
 				}
-				hi, err := parseNumber(hiTok.text)
-				if err != nil {
+				if fr.Hi, fr.HiConst, err = p.fieldBound(hiTok); err != nil {
 					return nil, err
 				}
-				return ExprFieldRange{Field: tok.text, Lo: lo, Hi: hi}, nil
+				return fr, nil
 			}
-			if next.kind == tokNumber {
-				// field:value — field equality
+			if next.kind == tokNumber || next.kind == tokIdent {
+				// field:value — field equality. A name is a constant,
+				// resolved by Compile; one that also reads as a hex number
+				// keeps the name so Compile can reject the ambiguity.
 				valTok := p.lex.next()
+				var name string
+				if valTok.kind == tokIdent && isIdent(valTok.text) {
+					name = valTok.text
+				}
 				val, mask, err := parseNumberWithMask(valTok.text)
 				if err != nil {
-					return nil, err
+					if name != "" {
+						return ExprFieldEquality{Field: tok.text, Const: name}, nil
+					}
+					return nil, p.errorAt(valTok, "%v", err)
 				}
-				return ExprFieldEquality{Field: tok.text, Value: val, Mask: mask}, nil
+				return ExprFieldEquality{Field: tok.text, Value: val, Mask: mask, Const: name}, nil
 			}
-			return nil, fmt.Errorf("expected [ or number after :")
+			return nil, p.errorAt(next, "expected [, number or constant after :")
 		}
-		return ExprIdent{Name: tok.text}, nil
+		name, feedback := splitFeedback(tok.text)
+		return ExprIdent{Name: name, Feedback: feedback}, nil
 
 	case tokNumber:
 		v, _, err := parseNumberWithMask(tok.text)
 		if err != nil {
-			return nil, err
+			return nil, p.errorAt(tok, "%v", err)
 		}
 		return ExprConst{Value: v != 0}, nil
 
@@ -910,7 +1548,7 @@ func (p *exprParser) parsePrimary() (Expr, error) {
 			return nil, err
 		}
 		if p.lex.next().kind != tokRParen {
-			return nil, fmt.Errorf("expected )")
+			return nil, p.errorf("expected )")
 		}
 		return x, nil
 
@@ -918,9 +1556,27 @@ func (p *exprParser) parsePrimary() (Expr, error) {
 		// [ident..ident] set expression or reduction operator
 		return p.parseBracketExpr()
 
+	case tokEOF:
+		return nil, p.errorf("unexpected end of expression")
+
 	default:
-		return nil, fmt.Errorf("unexpected token %q", tok.text)
+		return nil, p.errorf("unexpected token %q", tok.text)
+	}
+}
+
+// fieldBound reads a field:[lo..hi] bound: a number, or the name of a
+// constant for Compile to resolve. A name that also reads as a hex number
+// returns both.
+func (p *exprParser) fieldBound(tok token) (uint64, string, error) {
+	var name string
+	if tok.kind == tokIdent && isIdent(tok.text) {
+		name = tok.text
+	}
+	v, err := parseNumber(tok.text)
+	if err != nil && name == "" {
+		return 0, "", p.errorAt(tok, "%v", err)
 	}
+	return v, name, nil
 }
 
 // parseBracketExpr parses [A3..0] or [a, b, c] with optional :op reduction
@@ -931,7 +1587,7 @@ func (p *exprParser) parseBracketExpr() (Expr, error) {
 
 	firstTok := p.lex.next()
 	if firstTok.kind != tokIdent && firstTok.kind != tokNumber {
-		return nil, fmt.Errorf("expected identifier in bracket expression")
+		return nil, p.errorf("expected identifier in bracket expression")
 	}
 
 	next := p.lex.peek()
@@ -940,10 +1596,10 @@ func (p *exprParser) parseBracketExpr() (Expr, error) {
 		p.lex.next() // consume ..
 		endTok := p.lex.next()
 		if endTok.kind != tokIdent && endTok.kind != tokNumber {
-			return nil, fmt.Errorf("expected identifier or number after ..")
+			return nil, p.errorf("expected identifier or number after ..")
 		}
 		if p.lex.next().kind != tokRBrack {
-			return nil, fmt.Errorf("expected ] in bracket expression")
+			return nil, p.errorf("expected ] in bracket expression")
 		}
 
 		// Build ident list from range
@@ -951,19 +1607,19 @@ func (p *exprParser) parseBracketExpr() (Expr, error) {
 		endStr := endTok.text
 		p1, n1, ok1 := splitIdentNumber(startStr)
 		if !ok1 {
-			return nil, fmt.Errorf("range start %q must have numeric suffix", startStr)
+			return nil, p.errorf("range start %q must have numeric suffix", startStr)
 		}
 		p2, n2, ok2 := splitIdentNumber(endStr)
 		if !ok2 || (ok2 && p2 == "") {
 			num, err := strconv.Atoi(endStr)
 			if err != nil {
-				return nil, fmt.Errorf("range end %q must have numeric suffix or be a number", endStr)
+				return nil, p.errorf("range end %q must have numeric suffix or be a number", endStr)
 			}
 			p2 = p1
 			n2 = num
 		}
 		if p1 != p2 {
-			return nil, fmt.Errorf("range must use same prefix")
+			return nil, p.errorf("range must use same prefix")
 		}
 		if n1 >= n2 {
 			for i := n1; i >= n2; i-- {
@@ -981,35 +1637,47 @@ func (p *exprParser) parseBracketExpr() (Expr, error) {
 			p.lex.next() // consume ,
 			idTok := p.lex.next()
 			if idTok.kind != tokIdent && idTok.kind != tokNumber {
-				return nil, fmt.Errorf("expected identifier in list")
+				return nil, p.errorf("expected identifier in list")
 			}
 			idents = append(idents, idTok.text)
 		}
 		if p.lex.next().kind != tokRBrack {
-			return nil, fmt.Errorf("expected ] in bracket expression")
+			return nil, p.errorf("expected ] in bracket expression")
 		}
 	} else if next.kind == tokRBrack {
 		// Single element [A]
 		p.lex.next()
 		idents = append(idents, firstTok.text)
 	} else {
-		return nil, fmt.Errorf("expected .., comma, or ] in bracket expression")
+		return nil, p.errorf("expected .., comma, or ] in bracket expression")
 	}
 
-	// Check for reduction operator :& :# :$
+	// Check for reduction operator :& :# :$, or its complement :!& :!# :!$
 	if p.lex.peek().kind == tokColon {
 		p.lex.next() // consume :
+		negate := false
+		if p.lex.peek().kind == tokNot {
+			p.lex.next()
+			negate = true
+		}
+		var reduced Expr
 		opTok := p.lex.next()
 		switch opTok.kind {
 		case tokAnd:
-			return reduceIdents(idents, func(a, b Expr) Expr { return ExprAnd{A: a, B: b} }), nil
+			reduced = reduceIdents(idents, func(a, b Expr) Expr { return ExprAnd{A: a, B: b} })
 		case tokOr:
-			return reduceIdents(idents, func(a, b Expr) Expr { return ExprOr{A: a, B: b} }), nil
+			reduced = reduceIdents(idents, func(a, b Expr) Expr { return ExprOr{A: a, B: b} })
 		case tokXor:
-			return reduceIdents(idents, func(a, b Expr) Expr { return ExprXor{A: a, B: b} }), nil
+			// Left-folded XOR is odd parity: true when an odd number of
+			// members are set. :!$ is even parity.
+			reduced = reduceIdents(idents, func(a, b Expr) Expr { return ExprXor{A: a, B: b} })
 		default:
-			return nil, fmt.Errorf("expected &, #, or $ after : for reduction")
+			return nil, p.errorf("expected &, #, or $ after : for reduction")
 		}
+		if negate {
+			reduced = ExprNot{X: reduced}
+		}
+		return reduced, nil
 	}
 
 	if len(idents) == 1 {
@@ -1131,21 +1799,28 @@ func parseBasedNumber(base string, digits string) (uint64, uint64, error) {
 
 // Helpers
 
-func stripComments(s string) string {
+// stripComments removes /* */ and // comments, keeping the newlines inside
+// block comments so line numbers stay put. A // comment ends at the newline
+// or the end of the file; a /* comment must be closed.
+func stripComments(s string) (string, error) {
 	var out strings.Builder
 	i := 0
+	line := 1
 	for i < len(s) {
 		if i+1 < len(s) && s[i] == '/' && s[i+1] == '*' {
+			start := line
 			i += 2
 			for i+1 < len(s) && !(s[i] == '*' && s[i+1] == '/') {
 				if s[i] == '\n' {
 					out.WriteByte('\n')
+					line++
 				}
 				i++
 			}
-			if i+1 < len(s) {
-				i += 2
+			if i+1 >= len(s) {
+				return "", fmt.Errorf("line %d: unterminated /* comment", start)
 			}
+			i += 2
 			continue
 		}
 		if i+1 < len(s) && s[i] == '/' && s[i+1] == '/' {
@@ -1155,10 +1830,13 @@ func stripComments(s string) string {
 			}
 			continue
 		}
+		if s[i] == '\n' {
+			line++
+		}
 		out.WriteByte(s[i])
 		i++
 	}
-	return out.String()
+	return out.String(), nil
 }
 
 type statement struct {
@@ -1180,6 +1858,13 @@ func splitStatements(s string) []statement {
 		if r == '}' {
 			depth--
 			buf.WriteRune(r)
+			// A TABLE or CONDITION block ends its statement; WinCUPL
+			// needs no ';' after the closing brace.
+			if depth == 0 {
+				stmts = append(stmts, statement{text: buf.String(), offset: start})
+				buf.Reset()
+				start = i + 1
+			}
 			continue
 		}
 		if r == ';' && depth <= 0 {
@@ -1206,8 +1891,9 @@ func lineOffsets(s string) []int {
 	return offs
 }
 
+// lineOfOffset returns the 1-based line containing byte offset off.
 func lineOfOffset(lines []int, off int) int {
-	line := 1
+	line := 0
 	for i := 0; i < len(lines); i++ {
 		if lines[i] > off {
 			return line
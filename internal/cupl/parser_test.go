@@ -0,0 +1,312 @@
+package cupl
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseErrorPosition(t *testing.T) {
+	src := "Device g16v8;\nPin 2 = A;\nY = A &\n\t(A # ]);\n"
+	_, err := Parse([]byte(src))
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("got %v, want *ParseError", err)
+	}
+	want := ParseError{Line: 4, Column: 7, Token: "]", Source: "\t(A # ]);", Msg: `unexpected token "]"`}
+	if pe.Line != want.Line || pe.Column != want.Column || pe.Token != want.Token || pe.Source != want.Source || pe.Msg != want.Msg {
+		t.Errorf("got %+v, want %+v", *pe, want)
+	}
+}
+
+func TestParseLexErrors(t *testing.T) {
+	// The lexer's error is reported at the offending character, not as an
+	// unexpected token or end of expression further on.
+	for _, tc := range []struct {
+		expr   string
+		msg    string
+		column int
+	}{
+		{"A @ B", `unexpected character '@'`, 7},
+		{"A $ 'b'102", `invalid digit '2' in 'b'102`, 14},
+		{"A & 'b'", `'b' has no digits`, 9},
+		{"A # 'z'12", `unknown base 'z'`, 10},
+		{"A & 'b", `malformed based number, want 'b', 'o', 'd' or 'h' before the digits`, 9},
+	} {
+		_, err := Parse([]byte("Device g16v8;\nPin 2 = A;\nPin 3 = B;\nPin 19 = Y;\nY = " + tc.expr + ";\n"))
+		var pe *ParseError
+		if !errors.As(err, &pe) {
+			t.Errorf("%s: got %v, want *ParseError", tc.expr, err)
+			continue
+		}
+		if pe.Line != 5 || pe.Msg != tc.msg || pe.Column != tc.column {
+			t.Errorf("%s: got line %d column %d %q, want line 5 column %d %q", tc.expr, pe.Line, pe.Column, pe.Msg, tc.column, tc.msg)
+		}
+	}
+}
+
+func TestParseMissingSemicolon(t *testing.T) {
+	for _, tc := range []struct {
+		src  string
+		want string
+	}{
+		{"Device g16v8\nPin 2 = A;\n", "line 1: missing ';' before line 2"},
+		{"Device g16v8;\nPin 2 = A\n\nPin 19 = Y;\n", "line 2: missing ';' before line 4"},
+		{"Device g16v8;\nPin 2 = A;\nPin 19 = Y;\nY = A &\n  !A\n!Y.OE = A;\n", "line 5: missing ';' before line 6"},
+		{"Device g16v8;\nPin [2..3] = [A0..1];\nPin [18..19] = [Y0..1];\n[Y0..1] = [A0..1]\n[Y0..1].OE = 'b'11;\n", "line 4: missing ';' before line 5"},
+	} {
+		_, err := Parse([]byte(tc.src))
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("%q: got %v, want %q", tc.src, err, tc.want)
+		}
+	}
+
+	// An expression may continue over lines, and a TABLE or CONDITION block
+	// needs no ';' after its closing brace.
+	c, err := Parse([]byte("Device g16v8;\nPin [2..3] = [A0..1];\nPin [18..19] = [Y0..1];\nField in = [A1..0];\nField out = [Y1..0];\n" +
+		"TABLE in => out {\n  0 => 1;\n  1 => 2;\n}\nY0 = A0\n  # A1\n  & !A0;\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lhs []string
+	for _, eq := range c.Equations {
+		lhs = append(lhs, eq.LHS)
+	}
+	if want := []string{"Y0", "Y1", "Y0"}; !reflect.DeepEqual(lhs, want) {
+		t.Errorf("equations for %v, want %v", lhs, want)
+	}
+}
+
+func TestParseCommentAtEOF(t *testing.T) {
+	// A // comment may end the file without a newline, after a statement or
+	// in place of its ';'; comments inside brackets are whitespace.
+	for _, src := range []string{
+		"Device g16v8;\nPin [2..3] = [A0 /* lsb */ ..1];\nPin 19 = Y;\nY = A0 # A1; // last",
+		"Device g16v8;\nPin [2..3] = [A0 /* lsb */ ..1];\nPin 19 = Y;\nY = A0 # A1 // last",
+		"Device g16v8;\r\nPin [2..3] = [A0..1];\r\nPin 19 = Y;\r\nY = A0 # A1;\r\n// last",
+	} {
+		c, err := Parse([]byte(src))
+		if err != nil {
+			t.Errorf("%q: %v", src, err)
+			continue
+		}
+		if len(c.Equations) != 1 || c.Equations[0].LHS != "Y" {
+			t.Errorf("%q: equations %+v, want Y's", src, c.Equations)
+		}
+	}
+
+	// An unclosed /* comment used to leak the file's last byte.
+	_, err := Parse([]byte("Device g16v8;\nPin 2 = A;\nPin 19 = Y;\nY = A; /* unclosed\nend"))
+	if want := "line 4: unterminated /* comment"; err == nil || err.Error() != want {
+		t.Errorf("got %v, want %q", err, want)
+	}
+}
+
+func TestParseCustomHeaderMisspelling(t *testing.T) {
+	// A custom header one edit from a keyword, or sharing its first five
+	// letters, is a typo, not a custom header that would leave the keyword
+	// unset.
+	for _, tt := range []struct{ src, want string }{
+		{"Devcie g22v10;\n", "line 1: unknown header Devcie; did you mean DEVICE?"},
+		{"Revison 01;\n", "line 1: unknown header Revison; did you mean REVISION?"},
+		{"Partnum 01;\n", "line 1: unknown header Partnum; did you mean PARTNO?"},
+	} {
+		_, err := Parse([]byte(tt.src + "Pin 2 = A;\n"))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%q: got %v, want %q", tt.src, err, tt.want)
+		}
+	}
+	// Short keys are too close to everything to guess at.
+	c, err := Parse([]byte("REV DATE 2026-10-01;\nBoard Rev B;\nPART 7400;\nDATA none;\nNmae Demo;\nDevice g22v10;\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"REV", "Board", "PART", "DATA", "Nmae"}; !reflect.DeepEqual(c.MetaOrder, want) {
+		t.Errorf("custom headers %q, want %q", c.MetaOrder, want)
+	}
+}
+
+func TestParseNumberBases(t *testing.T) {
+	tests := []struct {
+		in          string
+		value, mask uint64
+	}{
+		{"2A", 0x2A, 0xFF},
+		{"'d'42", 42, ^uint64(0)},
+		{"'h'2A", 0x2A, 0xFF},
+		{"'o'52", 052, 077},
+		{"'b'10XX", 0b1000, 0b1100},
+		{"'h'X", 0, 0},
+		{"'h'1X", 0x10, 0xF0},
+		{"'o'7X", 070, 070},
+	}
+	for _, tt := range tests {
+		v, m, err := parseNumberWithMask(tt.in)
+		if err != nil {
+			t.Errorf("%s: %v", tt.in, err)
+			continue
+		}
+		if v != tt.value || m != tt.mask {
+			t.Errorf("%s = %#x mask %#x, want %#x mask %#x", tt.in, v, m, tt.value, tt.mask)
+		}
+	}
+}
+
+func TestParsePinListBases(t *testing.T) {
+	c, err := Parse([]byte("Device g16v8;\nPin ['d'2..'o'4, 'h'A, 'b'1011] = [A0..4];\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for pin, name := range map[int]string{2: "A0", 3: "A1", 4: "A2", 10: "A3", 11: "A4"} {
+		if c.Pins[pin].Name != name {
+			t.Errorf("pin %d = %q, want %s", pin, c.Pins[pin].Name, name)
+		}
+	}
+	if _, err := Parse([]byte("Device g16v8;\nPin ['b'1X..3] = [A0..1];\n")); err == nil {
+		t.Error("don't-care digits in a pin list were accepted")
+	}
+}
+
+func TestParseImplication(t *testing.T) {
+	a, b, c := ExprIdent{Name: "A"}, ExprIdent{Name: "B"}, ExprIdent{Name: "C"}
+	for _, tt := range []struct {
+		src  string
+		want Expr
+	}{
+		{"A -> B", ExprOr{A: ExprNot{X: a}, B: b}},
+		{"A->B->C", ExprOr{A: ExprNot{X: a}, B: ExprOr{A: ExprNot{X: b}, B: c}}},
+		{"A & B -> C", ExprOr{A: ExprNot{X: ExprAnd{A: a, B: b}}, B: c}},
+		{"A -> B $ C", ExprOr{A: ExprNot{X: a}, B: ExprXor{A: b, B: c}}},
+		{"(A -> B) & C", ExprAnd{A: ExprOr{A: ExprNot{X: a}, B: b}, B: c}},
+	} {
+		got, err := parseExprText(tt.src, 1)
+		if err != nil {
+			t.Errorf("%s: %v", tt.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %#v, want %#v", tt.src, got, tt.want)
+		}
+	}
+	// A & B -> C is !A # !B # C, which needs no further minimization.
+	expr, err := parseExprText("A & B -> C", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	terms, err := exprToTerms(expr, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Term{
+		{Lits: []Literal{{Name: "A", Neg: true}}},
+		{Lits: []Literal{{Name: "B", Neg: true}}},
+		{Lits: []Literal{{Name: "C"}}},
+	}
+	if got := minimizeTerms(terms); !reflect.DeepEqual(got, want) {
+		t.Errorf("A & B -> C terms %v, want %v", got, want)
+	}
+	for _, src := range []string{"A ->", "A - B", "-> B"} {
+		if _, err := parseExprText(src, 1); err == nil {
+			t.Errorf("%s: accepted", src)
+		}
+	}
+}
+
+func TestExprString(t *testing.T) {
+	for _, tc := range []struct{ src, want string }{
+		{"(A & B) # C", "A & B # C"},
+		{"A & (B # C)", "A & (B # C)"},
+		{"A # (B # C)", "A # (B # C)"},
+		{"(A # B) # C", "A # B # C"},
+		{"A $ B # C & !D", "A $ B # C & !D"},
+		{"!(A & B) $ !!C", "!(A & B) $ !!C"},
+		{"(A $ B) & C", "(A $ B) & C"},
+		{"A.Q & !B.IO", "A.Q & !B.IO"},
+		{"A -> B", "!A # B"},
+		{"1 & !0", "'b'1 & !'b'0"},
+		{"addr:'h'F0 # addr:'b'1X0", "addr:'h'F0 # addr:'b'1X0"},
+		{"addr:[10..1F] & !addr:[LO..HI]", "addr:['h'10..'h'1F] & !addr:[LO..HI]"},
+		{"addr:ROM", "addr:ROM"},
+		{"[A0..2]:!#", "!(A0 # A1 # A2)"},
+		{"[A0..1] & EN", "[A0, A1] & EN"},
+	} {
+		e, err := parseExprText(tc.src, 1)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.src, err)
+		}
+		got := ExprString(e)
+		if got != tc.want {
+			t.Errorf("%q: got %q, want %q", tc.src, got, tc.want)
+		}
+		back, err := parseExprText(got, 1)
+		if err != nil {
+			t.Errorf("%q: reparse %q: %v", tc.src, got, err)
+			continue
+		}
+		if !reflect.DeepEqual(back, e) {
+			t.Errorf("%q: %q parses to %#v, want %#v", tc.src, got, back, e)
+		}
+	}
+
+	// Field values keep their don't-care bits through a round trip.
+	for _, src := range []string{"f:'h'X0", "f:'b'X", "f:'b'0101", "f:'o'17", "f:'d'9", "f:'h'0000FFFF0000FFFF"} {
+		e, err := parseExprText(src, 1)
+		if err != nil {
+			t.Fatalf("%q: %v", src, err)
+		}
+		back, err := parseExprText(ExprString(e), 1)
+		if err != nil || !reflect.DeepEqual(back, e) {
+			t.Errorf("%q: %q parses to %#v (%v), want %#v", src, ExprString(e), back, err, e)
+		}
+	}
+}
+
+func TestContentJSONRoundTrip(t *testing.T) {
+	src := `Name json; Device g22v10;
+Pin 1 = Clock;
+Pin [2..5] = [A12..15];
+Pin 14 = X;
+Pin 15 = Y;
+Pin 23 = Q;
+FIELD ADDR = [A12..15];
+X = ADDR:'b'10XX;
+Q.D = !(A12 & A13) # A14 $ Q.Q # ADDR:[2..5] & VCC;
+CONDITION { IF A12 & A13 OUT Y; }
+`
+	c, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, typ := range []string{"Ident", "Not", "And", "Or", "Xor", "FieldRange", "FieldEquality"} {
+		if !strings.Contains(string(data), `{"Type":"`+typ+`"`) {
+			t.Errorf("JSON has no %s node: %s", typ, data)
+		}
+	}
+	if !strings.Contains(string(data), `"DontCare":{"Type":`) {
+		t.Errorf("JSON has no CONDITION don't-care expression: %s", data)
+	}
+	var got Content
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, c) {
+		t.Errorf("round trip changed the content:\ngot  %+v\nwant %+v", got, c)
+	}
+
+	data, err = json.Marshal(ExprNot{X: ExprIdentList{Names: []string{"A", "B"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"Type":"Not","X":{"Type":"IdentList","Names":["A","B"]}}`; string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+	if err := json.Unmarshal([]byte(`{"Line":3,"Expr":{"Type":"Nand"}}`), &Equation{}); err == nil || err.Error() != `line 3: unknown expression type "Nand"` {
+		t.Errorf("got %v, want an unknown type error", err)
+	}
+}
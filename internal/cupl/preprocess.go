@@ -0,0 +1,601 @@
+package cupl
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// srcLine is a line of preprocessor output and the source line it came from.
+type srcLine struct {
+	text string
+	line int // 1-based line number in the original source
+	// inc is the $INCLUDE file the line was read from, or nil. Its line is
+	// then that of the original source's $INCLUDE directive, and incLine
+	// the line within inc.
+	inc     *includeFrame
+	incLine int
+}
+
+// includeFrame is a file read by $INCLUDE.
+type includeFrame struct {
+	name   string // path within ParseOptions.FS
+	parent *includeFrame
+}
+
+// maxIncludeDepth bounds nested $INCLUDEs.
+const maxIncludeDepth = 16
+
+// where describes the position of an included line, or is empty for a line
+// of the original source.
+func (sl srcLine) where() string {
+	if sl.inc == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s line %d", sl.inc.name, sl.incLine)
+}
+
+// wrap adds the included file position of sl to err.
+func (sl srcLine) wrap(err error) error {
+	if sl.inc == nil {
+		return err
+	}
+	return fmt.Errorf("%w (in %s)", err, sl.where())
+}
+
+// preprocess runs the $ directives over comment-stripped source. It returns
+// the expanded text and, for each output line, the source line it came from
+// so statement line numbers still point at the original file, and where an
+// $INCLUDEd line is in its own file (see srcLine.where). opts.Defines holds
+// the command-line defines, which a $DEFINE may not change.
+func preprocess(text string, opts ParseOptions) (string, []int, []string, error) {
+	fixed := opts.Defines
+	lines, err := expandRepeats(splitRepeatMarkers(text))
+	if err != nil {
+		return "", nil, nil, err
+	}
+	defines := make(map[string]string, len(fixed))
+	for name, value := range fixed {
+		defines[name] = value
+	}
+	macros := make(map[string]macro)
+	var conds []condFrame
+	for i := 0; i < len(lines); i++ {
+		sl := lines[i]
+		active := len(conds) == 0 || conds[len(conds)-1].taking
+		trimmed := strings.TrimSpace(sl.text)
+		if !strings.HasPrefix(trimmed, "$") {
+			if active {
+				text, err := expandMacroCalls(sl.text, macros, 0)
+				if err != nil {
+					return "", nil, nil, sl.wrap(fmt.Errorf("line %d: %w", sl.line, err))
+				}
+				lines[i].text = substituteDefines(text, defines)
+			} else {
+				lines[i].text = ""
+			}
+			continue
+		}
+		directive, rest := splitDirective(trimmed)
+		switch directive {
+		case "$IFDEF", "$IFNDEF":
+			name, _ := splitDirective(rest)
+			if !isIdent(name) {
+				return "", nil, nil, sl.wrap(fmt.Errorf("line %d: %s expects a name", sl.line, directive))
+			}
+			_, defined := defines[name]
+			conds = append(conds, condFrame{
+				directive: directive,
+				line:      sl.line,
+				outer:     active,
+				taking:    active && defined == (directive == "$IFDEF"),
+			})
+			lines[i].text = ""
+			continue
+		case "$ELSE":
+			if len(conds) == 0 {
+				return "", nil, nil, sl.wrap(fmt.Errorf("line %d: $ELSE without $IFDEF", sl.line))
+			}
+			top := &conds[len(conds)-1]
+			if top.inElse {
+				return "", nil, nil, sl.wrap(fmt.Errorf("line %d: second $ELSE for %s on line %d", sl.line, top.directive, top.line))
+			}
+			top.inElse = true
+			top.taking = top.outer && !top.taking
+			lines[i].text = ""
+			continue
+		case "$ENDIF":
+			if len(conds) == 0 {
+				return "", nil, nil, sl.wrap(fmt.Errorf("line %d: $ENDIF without $IFDEF", sl.line))
+			}
+			conds = conds[:len(conds)-1]
+			lines[i].text = ""
+			continue
+		}
+		if !active {
+			lines[i].text = ""
+			continue
+		}
+		switch directive {
+		case "$DEFINE":
+			name, value := splitDirective(rest)
+			if name == "" {
+				return "", nil, nil, sl.wrap(fmt.Errorf("line %d: $DEFINE missing name", sl.line))
+			}
+			if !isIdent(name) {
+				return "", nil, nil, sl.wrap(fmt.Errorf("line %d: $DEFINE invalid name %q", sl.line, name))
+			}
+			if v, ok := fixed[name]; ok {
+				if value != v {
+					return "", nil, nil, sl.wrap(fmt.Errorf("line %d: $DEFINE %s %s conflicts with command-line define %s=%s (command-line defines take precedence over $DEFINE)", sl.line, name, value, name, v))
+				}
+				lines[i].text = ""
+				continue
+			}
+			defines[name] = substituteDefines(value, defines)
+			lines[i].text = ""
+		case "$MACRO":
+			m, end, err := parseMacro(lines, i, rest)
+			if err != nil {
+				return "", nil, nil, sl.wrap(err)
+			}
+			if prev, ok := macros[m.name]; ok {
+				return "", nil, nil, sl.wrap(fmt.Errorf("line %d: $MACRO %s already defined on line %d", sl.line, m.name, prev.line))
+			}
+			macros[m.name] = m
+			for j := i; j <= end; j++ {
+				lines[j].text = ""
+			}
+			i = end
+		case "$INCLUDE":
+			inc, err := readInclude(opts, sl, rest)
+			if err != nil {
+				return "", nil, nil, sl.wrap(fmt.Errorf("line %d: %w", sl.line, err))
+			}
+			// Replace the directive with the file's lines and carry on
+			// from the first of them.
+			lines = append(lines[:i], append(inc, lines[i+1:]...)...)
+			i--
+		case "$MEND":
+			return "", nil, nil, sl.wrap(fmt.Errorf("line %d: $MEND without $MACRO", sl.line))
+		default:
+			lines[i].text = substituteDefines(sl.text, defines)
+		}
+	}
+	if len(conds) > 0 {
+		top := conds[len(conds)-1]
+		return "", nil, nil, fmt.Errorf("line %d: %s without $ENDIF", top.line, top.directive)
+	}
+	texts := make([]string, len(lines))
+	lineMap := make([]int, len(lines))
+	where := make([]string, len(lines))
+	for i, sl := range lines {
+		texts[i] = sl.text
+		lineMap[i] = sl.line
+		where[i] = sl.where()
+	}
+	return strings.Join(texts, "\n"), lineMap, where, nil
+}
+
+// readInclude reads the file named by an $INCLUDE directive at sl, relative
+// to the directory of the file containing it, and returns its lines with
+// $REPEAT blocks expanded. Each line is attributed to the directive's line
+// in the original source.
+func readInclude(opts ParseOptions, sl srcLine, arg string) ([]srcLine, error) {
+	name := strings.Trim(strings.TrimSpace(arg), `"`)
+	if name == "" {
+		return nil, fmt.Errorf("$INCLUDE expects a file name")
+	}
+	if opts.FS == nil {
+		return nil, fmt.Errorf("$INCLUDE %s: no file system to read it from (use ParseFile)", name)
+	}
+	dir := path.Dir(opts.File)
+	if sl.inc != nil {
+		dir = path.Dir(sl.inc.name)
+	}
+	p := path.Join(dir, filepath.ToSlash(name))
+	if !fs.ValidPath(p) {
+		return nil, fmt.Errorf("$INCLUDE %s: path is outside the include root", name)
+	}
+	depth := 0
+	for f := sl.inc; f != nil; f = f.parent {
+		if f.name == p {
+			return nil, fmt.Errorf("$INCLUDE %s: %s includes itself", name, p)
+		}
+		depth++
+	}
+	if opts.File != "" && p == path.Clean(opts.File) {
+		return nil, fmt.Errorf("$INCLUDE %s: %s includes itself", name, p)
+	}
+	if depth >= maxIncludeDepth {
+		return nil, fmt.Errorf("$INCLUDE %s: includes nested deeper than %d", name, maxIncludeDepth)
+	}
+	data, err := fs.ReadFile(opts.FS, p)
+	if err != nil {
+		return nil, fmt.Errorf("$INCLUDE %s: %w", name, err)
+	}
+	stripped, err := stripComments(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("$INCLUDE %s: %w", name, err)
+	}
+	lines, err := expandRepeats(splitRepeatMarkers(stripped))
+	if err != nil {
+		return nil, fmt.Errorf("$INCLUDE %s: %w", name, err)
+	}
+	frame := &includeFrame{name: p, parent: sl.inc}
+	for i := range lines {
+		lines[i].incLine = lines[i].line
+		lines[i].line = sl.line
+		lines[i].inc = frame
+	}
+	return lines, nil
+}
+
+// condFrame is an open $IFDEF/$IFNDEF block.
+type condFrame struct {
+	directive string
+	line      int
+	outer     bool // the enclosing text is compiled
+	taking    bool // the current branch is compiled
+	inElse    bool
+}
+
+// maxMacroDepth bounds nested macro expansion, catching recursive macros.
+const maxMacroDepth = 16
+
+// macro is a $MACRO definition. Its body lines are joined into one line so an
+// expansion keeps the call site's line number.
+type macro struct {
+	name   string
+	params []string
+	body   string
+	line   int
+}
+
+// parseMacro parses the "$MACRO name param..." header at lines[start] and
+// its body up to the matching $MEND, returning the macro and that $MEND's
+// index.
+func parseMacro(lines []srcLine, start int, header string) (macro, int, error) {
+	fields := strings.Fields(header)
+	if len(fields) == 0 || !isIdent(fields[0]) {
+		return macro{}, 0, fmt.Errorf("line %d: $MACRO expects a name", lines[start].line)
+	}
+	m := macro{name: fields[0], params: fields[1:], line: lines[start].line}
+	for _, p := range m.params {
+		if !isIdent(p) {
+			return macro{}, 0, fmt.Errorf("line %d: $MACRO %s invalid parameter %q", m.line, m.name, p)
+		}
+	}
+	var body []string
+	for i := start + 1; i < len(lines); i++ {
+		directive, _ := splitDirective(lines[i].text)
+		switch {
+		case directive == "$MEND":
+			m.body = strings.Join(body, " ")
+			return m, i, nil
+		case directives[directive]:
+			return macro{}, 0, fmt.Errorf("line %d: %s inside $MACRO %s", lines[i].line, directive, m.name)
+		}
+		body = append(body, strings.TrimSpace(lines[i].text))
+	}
+	return macro{}, 0, fmt.Errorf("line %d: $MACRO %s without $MEND", m.line, m.name)
+}
+
+// expandMacroCalls replaces each "name(arg, ...)" call of a defined macro in
+// s with the macro body, its parameters substituted as whole tokens by the
+// arguments. Calls inside the expansion are expanded in turn.
+func expandMacroCalls(s string, macros map[string]macro, depth int) (string, error) {
+	if len(macros) == 0 {
+		return s, nil
+	}
+	var out strings.Builder
+	i := 0
+	for i < len(s) {
+		ch := s[i]
+		switch {
+		case ch == '\'' && i+2 < len(s) && s[i+2] == '\'', isNumberStart(ch):
+			start := i
+			if ch == '\'' {
+				i += 3
+			}
+			for i < len(s) && isIdentPart(s[i]) {
+				i++
+			}
+			out.WriteString(s[start:i])
+		case isIdentStart(ch):
+			start := i
+			for i < len(s) && isIdentPart(s[i]) {
+				i++
+			}
+			word := s[start:i]
+			m, ok := macros[word]
+			open := i
+			for open < len(s) && (s[open] == ' ' || s[open] == '\t') {
+				open++
+			}
+			if !ok || open >= len(s) || s[open] != '(' {
+				out.WriteString(word)
+				continue
+			}
+			args, end, err := splitMacroArgs(s, open)
+			if err != nil {
+				return "", fmt.Errorf("macro %s: %w", word, err)
+			}
+			if len(args) != len(m.params) {
+				return "", fmt.Errorf("macro %s: got %d arguments, want %d", word, len(args), len(m.params))
+			}
+			if depth >= maxMacroDepth {
+				return "", fmt.Errorf("macro %s: expansion nested deeper than %d (recursive macro?)", word, maxMacroDepth)
+			}
+			bind := make(map[string]string, len(args))
+			for j, p := range m.params {
+				bind[p] = args[j]
+			}
+			body, err := expandMacroCalls(substituteDefines(m.body, bind), macros, depth+1)
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(body)
+			i = end
+		default:
+			out.WriteByte(ch)
+			i++
+		}
+	}
+	return out.String(), nil
+}
+
+// splitMacroArgs splits the parenthesized argument list starting at s[open]
+// on top-level commas, returning the trimmed arguments and the index just
+// past the closing parenthesis.
+func splitMacroArgs(s string, open int) ([]string, int, error) {
+	var args []string
+	depth := 0
+	start := open + 1
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+			if depth == 0 {
+				if arg := strings.TrimSpace(s[start:i]); arg != "" || len(args) > 0 {
+					args = append(args, arg)
+				}
+				return args, i + 1, nil
+			}
+		case ',':
+			if depth == 1 {
+				args = append(args, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return nil, 0, fmt.Errorf("missing )")
+}
+
+var repeatMarker = regexp.MustCompile(`(?i)\$REPEAT\s*[A-Za-z_][A-Za-z0-9_]*\s*=\s*\[[^\]]*\]|\$REPEND\b|\$MEND\b`)
+
+// splitRepeatMarkers splits text into lines, additionally breaking lines so
+// that every $REPEAT header, $REPEND and $MEND stands alone. This lets a loop
+// or macro be written on a single line.
+func splitRepeatMarkers(text string) []srcLine {
+	var out []srcLine
+	for i, line := range strings.Split(text, "\n") {
+		locs := repeatMarker.FindAllStringIndex(line, -1)
+		if len(locs) == 0 {
+			out = append(out, srcLine{text: line, line: i + 1})
+			continue
+		}
+		prev := 0
+		for _, loc := range locs {
+			if strings.TrimSpace(line[prev:loc[0]]) != "" {
+				out = append(out, srcLine{text: line[prev:loc[0]], line: i + 1})
+			}
+			out = append(out, srcLine{text: line[loc[0]:loc[1]], line: i + 1})
+			prev = loc[1]
+		}
+		if strings.TrimSpace(line[prev:]) != "" {
+			out = append(out, srcLine{text: line[prev:], line: i + 1})
+		}
+	}
+	return out
+}
+
+// expandRepeats unrolls $REPEAT var = [lo..hi] ... $REPEND blocks, replacing
+// {var} in the body with each index. Inner loops are expanded after the outer
+// index is substituted, so their ranges may use it.
+func expandRepeats(lines []srcLine) ([]srcLine, error) {
+	var out []srcLine
+	for i := 0; i < len(lines); i++ {
+		directive, rest := splitDirective(lines[i].text)
+		switch directive {
+		case "$REPEND":
+			return nil, fmt.Errorf("line %d: $REPEND without $REPEAT", lines[i].line)
+		case "$REPEAT":
+		default:
+			out = append(out, lines[i])
+			continue
+		}
+		header := lines[i]
+		name, values, err := parseRepeatHeader(rest)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", header.line, err)
+		}
+		end, err := findRepend(lines, i)
+		if err != nil {
+			return nil, err
+		}
+		body := lines[i+1 : end]
+		placeholder := regexp.MustCompile(`\{` + name + `(:[^{}]*)?\}`)
+		for _, v := range values {
+			iter := make([]srcLine, len(body))
+			for j, sl := range body {
+				text, err := substituteIndex(sl.text, placeholder, v)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", sl.line, err)
+				}
+				iter[j] = srcLine{text: text, line: sl.line}
+			}
+			expanded, err := expandRepeats(iter)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, expanded...)
+		}
+		i = end
+	}
+	return out, nil
+}
+
+// repeatFormat is the format of a {var:spec} placeholder: an optional 0 to
+// pad with zeros, a width, and d (decimal, the default), x or X (hex), o
+// (octal) or b (binary).
+var repeatFormat = regexp.MustCompile(`^(0?[1-9][0-9]?)?([dxXob]?)$`)
+
+// substituteIndex replaces each {var} or {var:spec} placeholder in text with
+// the index v, e.g. {i:02} as 07 and {i:X} as 1F.
+func substituteIndex(text string, placeholder *regexp.Regexp, v int) (string, error) {
+	var err error
+	text = placeholder.ReplaceAllStringFunc(text, func(m string) string {
+		spec := ""
+		if i := strings.IndexByte(m, ':'); i >= 0 {
+			spec = m[i+1 : len(m)-1]
+		}
+		f := repeatFormat.FindStringSubmatch(spec)
+		if f == nil {
+			err = fmt.Errorf("$REPEAT invalid format %q in %s", spec, m)
+			return m
+		}
+		verb := f[2]
+		if verb == "" {
+			verb = "d"
+		}
+		return fmt.Sprintf("%"+f[1]+verb, v)
+	})
+	return text, err
+}
+
+// findRepend returns the index of the $REPEND matching the $REPEAT at start.
+func findRepend(lines []srcLine, start int) (int, error) {
+	depth := 0
+	for i := start; i < len(lines); i++ {
+		switch directive, _ := splitDirective(lines[i].text); directive {
+		case "$REPEAT":
+			depth++
+		case "$REPEND":
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("line %d: $REPEAT without $REPEND", lines[start].line)
+}
+
+// parseRepeatHeader parses the "var = [lo..hi]" part of a $REPEAT directive.
+func parseRepeatHeader(s string) (string, []int, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 {
+		return "", nil, fmt.Errorf("$REPEAT expects var = [lo..hi]")
+	}
+	name := strings.TrimSpace(parts[0])
+	if !isIdent(name) {
+		return "", nil, fmt.Errorf("$REPEAT invalid index name %q", name)
+	}
+	values, err := parseIntList(parts[1])
+	if err != nil {
+		return "", nil, fmt.Errorf("$REPEAT range: %w", err)
+	}
+	return name, values, nil
+}
+
+// directives are the $ directive names. A line starting with any other $,
+// such as "$ B;" continuing an XOR, is source text.
+var directives = map[string]bool{
+	"$DEFINE": true, "$IFDEF": true, "$IFNDEF": true, "$ELSE": true, "$ENDIF": true,
+	"$INCLUDE": true, "$MACRO": true, "$MEND": true, "$REPEAT": true, "$REPEND": true,
+}
+
+// splitDirective splits s at the first run of whitespace, upper-casing the
+// first word if it is a $ directive. A $ directive may be followed directly
+// by its arguments (e.g. "$REPEAT i=[0..3]").
+func splitDirective(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	idx := strings.IndexAny(s, " \t\r")
+	if strings.HasPrefix(s, "$") {
+		end := 1
+		for end < len(s) && isIdentPart(s[end]) {
+			end++
+		}
+		idx = end
+	}
+	word, rest := s, ""
+	if idx >= 0 && idx < len(s) {
+		word, rest = s[:idx], strings.TrimSpace(s[idx:])
+	}
+	if strings.HasPrefix(word, "$") {
+		word = strings.ToUpper(word)
+	}
+	return word, rest
+}
+
+// substituteDefines replaces whole identifier tokens in s with their defined
+// values. Numbers, based constants ('b'101) and extensions (.D, .OE) are
+// copied through untouched.
+func substituteDefines(s string, defines map[string]string) string {
+	if len(defines) == 0 {
+		return s
+	}
+	var out strings.Builder
+	i := 0
+	for i < len(s) {
+		ch := s[i]
+		switch {
+		case ch == '\'' && i+2 < len(s) && s[i+2] == '\'':
+			start := i
+			i += 3
+			for i < len(s) && isIdentPart(s[i]) {
+				i++
+			}
+			out.WriteString(s[start:i])
+		case isNumberStart(ch):
+			start := i
+			for i < len(s) && isIdentPart(s[i]) {
+				i++
+			}
+			out.WriteString(s[start:i])
+		case isIdentStart(ch):
+			start := i
+			for i < len(s) && isIdentPart(s[i]) {
+				i++
+			}
+			word := s[start:i]
+			afterDot := start > 0 && s[start-1] == '.' && (start < 2 || s[start-2] != '.')
+			if v, ok := defines[word]; ok && !afterDot {
+				out.WriteString(v)
+			} else {
+				out.WriteString(word)
+			}
+		default:
+			out.WriteByte(ch)
+			i++
+		}
+	}
+	return out.String()
+}
+
+func isIdent(s string) bool {
+	if s == "" || !isIdentStart(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isIdentPart(s[i]) {
+			return false
+		}
+	}
+	return true
+}
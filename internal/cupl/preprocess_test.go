@@ -0,0 +1,281 @@
+package cupl
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRepeatExpansion(t *testing.T) {
+	src := `Device g16v8;
+$REPEAT i = [0..1]
+$REPEAT j = [2..3]
+Y{i}{j} = A{j};
+$REPEND
+$REPEND
+`
+	c, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, eq := range c.Equations {
+		if eq.Line != 4 {
+			t.Errorf("%s: line %d, want 4", eq.LHS, eq.Line)
+		}
+		got = append(got, eq.LHS)
+	}
+	if want := "Y02 Y03 Y12 Y13"; strings.Join(got, " ") != want {
+		t.Errorf("got %v, want %s", got, want)
+	}
+}
+
+func TestRepeatIndexFormat(t *testing.T) {
+	src := `Device g16v8;
+$REPEAT i = [9..11]
+addr{i:02}_{i}_{i:x}_{i:02X}_{i:o}_{i:4b} = A;
+bank{i:X} = 'h'{i:X};
+$REPEND
+`
+	c, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, eq := range c.Equations {
+		got = append(got, eq.LHS)
+	}
+	want := "addr09_9_9_09_11_1001 bank9 addr10_10_a_0A_12_1010 bankA addr11_11_b_0B_13_1011 bankB"
+	if strings.Join(got, " ") != want {
+		t.Errorf("got %v, want %s", got, want)
+	}
+	if k := c.Constants["bankB"]; k.Value != 11 {
+		t.Errorf("bankB = %d, want 11", k.Value)
+	}
+
+	for _, spec := range []string{"z", "02q", "0", "-2"} {
+		_, err := Parse([]byte("$REPEAT i = [0..1]\nY{i:" + spec + "} = A;\n$REPEND\n"))
+		if err == nil || !strings.HasPrefix(err.Error(), "line 2: $REPEAT invalid format") {
+			t.Errorf("{i:%s}: got %v, want invalid format on line 2", spec, err)
+		}
+	}
+}
+
+func TestRepeatErrorLine(t *testing.T) {
+	src := `Device g16v8;
+
+$REPEAT i = [0..3]
+Y{i} = A{i};
+Z{i} = A{i} &;
+$REPEND
+`
+	_, err := Parse([]byte(src))
+	if err == nil || !strings.HasPrefix(err.Error(), "line 5:") {
+		t.Fatalf("got %v, want error on line 5", err)
+	}
+}
+
+func TestRepeatUnterminated(t *testing.T) {
+	_, err := Parse([]byte("$REPEAT i = [0..3]\nY{i} = A{i};\n"))
+	if err == nil || !strings.Contains(err.Error(), "without $REPEND") {
+		t.Fatalf("got %v, want missing $REPEND error", err)
+	}
+}
+
+func TestConditionalBlocks(t *testing.T) {
+	src := `Device g16v8;
+$DEFINE REV2
+$IFDEF REV2
+Y0 = A;
+$IFNDEF LED
+Y1 = A;
+$ELSE
+Y2 = A;
+$ENDIF
+$ELSE
+$DEFINE LED
+Y3 = A;
+$ENDIF
+$IFDEF LED
+Y4 = A;
+$ENDIF
+Y5 = A;
+`
+	c, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, eq := range c.Equations {
+		got = append(got, fmt.Sprintf("%s@%d", eq.LHS, eq.Line))
+	}
+	if want := "Y0@4 Y1@6 Y5@17"; strings.Join(got, " ") != want {
+		t.Errorf("got %v, want %s", got, want)
+	}
+}
+
+func TestConditionalUnmatched(t *testing.T) {
+	for _, tc := range []struct{ src, want string }{
+		{"Device g16v8;\n$IFDEF X\nY = A;\n", "line 2: $IFDEF without $ENDIF"},
+		{"Device g16v8;\nY = A;\n$ENDIF\n", "line 3: $ENDIF without $IFDEF"},
+		{"Device g16v8;\n$ELSE\n", "line 2: $ELSE without $IFDEF"},
+		{"Device g16v8;\n$IFNDEF X\n$ELSE\n$ELSE\n$ENDIF\n", "line 4: second $ELSE for $IFNDEF on line 2"},
+	} {
+		_, err := Parse([]byte(tc.src))
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("got %v, want %q", err, tc.want)
+		}
+	}
+}
+
+func TestParseWithDefines(t *testing.T) {
+	src := `Device g16v8;
+$IFNDEF REV
+$DEFINE REV 1
+$ENDIF
+$DEFINE OUT Y
+$IFDEF FAST
+OUT = A;
+$ELSE
+OUT = A & B;
+$ENDIF
+Z = REV;
+`
+	c, err := ParseWithOptions([]byte(src), ParseOptions{Defines: map[string]string{"FAST": "", "REV": "0"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, eq := range c.Equations {
+		got = append(got, fmt.Sprintf("%s@%d", eq.LHS, eq.Line))
+	}
+	if want := "Y@7 Z@11"; strings.Join(got, " ") != want {
+		t.Errorf("got %v, want %s", got, want)
+	}
+	if z, ok := c.Equations[1].Expr.(ExprConst); !ok || z.Value {
+		t.Errorf("Z = %#v, want the command-line REV 0", c.Equations[1].Expr)
+	}
+
+	_, err = ParseWithOptions([]byte("$DEFINE REV 1\n"), ParseOptions{Defines: map[string]string{"REV": "2"}})
+	if err == nil || !strings.Contains(err.Error(), "line 1: $DEFINE REV 1 conflicts with command-line define REV=2") {
+		t.Errorf("got %v, want a conflicting redefinition error", err)
+	}
+	if _, err := ParseWithOptions([]byte("$DEFINE REV 2\n"), ParseOptions{Defines: map[string]string{"REV": "2"}}); err != nil {
+		t.Errorf("same value: %v", err)
+	}
+}
+
+func TestMacroExpansion(t *testing.T) {
+	src := `Device g16v8;
+FIELD ADDR = [A12..15];
+$MACRO decode sel val
+sel = ADDR:val;
+$MEND
+$MACRO both a b
+decode(a, 'h'F); b.D = a;
+$MEND
+decode(ROM, 'h'E);
+
+both(IO, Q);
+`
+	c, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, eq := range c.Equations {
+		got = append(got, fmt.Sprintf("%s@%d", eq.LHS, eq.Line))
+	}
+	if want := "ROM@9 IO@11 Q.D@11"; strings.Join(got, " ") != want {
+		t.Errorf("got %v, want %s", got, want)
+	}
+	if fe, ok := c.Equations[1].Expr.(ExprFieldEquality); !ok || fe.Field != "ADDR" || fe.Value != 0xF {
+		t.Errorf("IO = %#v, want ADDR:'h'F", c.Equations[1].Expr)
+	}
+}
+
+func TestMacroXorContinuation(t *testing.T) {
+	// A body line starting with the $ XOR operator is not a directive.
+	src := "Device g16v8;\n$MACRO parity y a b c\ny = a\n$ b\n$c;\n$MEND\nparity(Y, A, B, C);\n"
+	c, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Equations) != 1 {
+		t.Fatalf("got %d equations, want 1", len(c.Equations))
+	}
+	if got, want := ExprString(c.Equations[0].Expr), "A $ B $ C"; got != want {
+		t.Errorf("Y = %s, want %s", got, want)
+	}
+}
+
+func TestMacroErrors(t *testing.T) {
+	for _, tc := range []struct{ src, want string }{
+		{"$MACRO m a\nY = a;\n", "line 1: $MACRO m without $MEND"},
+		{"Y = A;\n$MEND\n", "line 2: $MEND without $MACRO"},
+		{"$MACRO m a\nY = a;\n$MEND\nm(A, B);\n", "line 4: macro m: got 2 arguments, want 1"},
+		{"$MACRO m a\nm(a);\n$MEND\n\nm(A);\n", "line 5: macro m: expansion nested deeper than 16 (recursive macro?)"},
+		{"$MACRO m\n$DEFINE X Y\n$MEND\n", "line 2: $DEFINE inside $MACRO m"},
+	} {
+		_, err := Parse([]byte(tc.src))
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("got %v, want %q", err, tc.want)
+		}
+	}
+}
+
+func TestInclude(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dir/main.pld":    {Data: []byte("Device g16v8;\n$INCLUDE \"pins.inc\"\nY = A & B;\n")},
+		"dir/pins.inc":    {Data: []byte("/* pins */\nPin 2 = A;\n$INCLUDE \"../common/b.inc\"\n")},
+		"common/b.inc":    {Data: []byte("Pin 3 = B;\nPin 19 = Y;\n")},
+		"dir/loop.pld":    {Data: []byte("$INCLUDE \"loop.inc\"\n")},
+		"dir/loop.inc":    {Data: []byte("$INCLUDE \"loop.pld\"\n")},
+		"dir/missing.pld": {Data: []byte("Device g16v8;\n$INCLUDE nope.inc\n")},
+		"dir/bad.pld":     {Data: []byte("Device g16v8;\n\n$INCLUDE \"bad.inc\"\n")},
+		"dir/bad.inc":     {Data: []byte("Pin 2 = A;\nY = A &;\n")},
+		"dir/escape.pld":  {Data: []byte("$INCLUDE \"../../x.inc\"\n")},
+		"dir/badcond.pld": {Data: []byte("$INCLUDE \"badcond.inc\"\n")},
+		"dir/badcond.inc": {Data: []byte("\n$ENDIF\n")},
+	}
+	parse := func(file string) (Content, error) {
+		return ParseWithOptions(fsys[file].Data, ParseOptions{FS: fsys, File: file})
+	}
+
+	c, err := parse("dir/main.pld")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, n := range []int{2, 3, 19} {
+		got = append(got, fmt.Sprintf("%s@%d", c.Pins[n].Name, c.Pins[n].Line))
+	}
+	if want := "A@2 B@2 Y@2"; strings.Join(got, " ") != want {
+		t.Errorf("pins %v, want %s", got, want)
+	}
+	if len(c.Equations) != 1 || c.Equations[0].Line != 3 {
+		t.Errorf("equations %+v, want Y on line 3", c.Equations)
+	}
+
+	for _, tc := range []struct{ file, want string }{
+		{"dir/loop.pld", "line 1: $INCLUDE loop.pld: dir/loop.pld includes itself (in dir/loop.inc line 1)"},
+		{"dir/missing.pld", "line 2: $INCLUDE nope.inc: open dir/nope.inc: file does not exist"},
+		{"dir/bad.pld", "(in dir/bad.inc line 2)"},
+		{"dir/escape.pld", "line 1: $INCLUDE ../../x.inc: path is outside the include root"},
+		{"dir/badcond.pld", "line 1: $ENDIF without $IFDEF (in dir/badcond.inc line 2)"},
+	} {
+		_, err := parse(tc.file)
+		if err == nil || !strings.HasSuffix(err.Error(), tc.want) {
+			t.Errorf("%s: got %v, want %q", tc.file, err, tc.want)
+		}
+	}
+	if _, err := parse("dir/bad.pld"); err == nil || !strings.HasPrefix(err.Error(), "line 3:") {
+		t.Errorf("got %v, want the $INCLUDE line", err)
+	}
+
+	_, err = Parse([]byte("$INCLUDE \"pins.inc\"\n"))
+	if err == nil || !strings.Contains(err.Error(), "no file system") {
+		t.Errorf("got %v, want an error without a file system", err)
+	}
+}
@@ -0,0 +1,200 @@
+package cupl
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SimOutput is the simulated state of one output pin.
+type SimOutput struct {
+	Name     string
+	Pin      int
+	Value    bool // logical value; an active-low output drives its pin low when true
+	Disabled bool // the output enable evaluated to 0, so the pin is Z
+	Skipped  string
+}
+
+// Simulate evaluates the combinatorial outputs of a compiled design for an
+// assignment of logical input values. Registered outputs are not clocked:
+// they are reported as skipped, and their current state may be given as an
+// input so that outputs fed back from them can be evaluated.
+func Simulate(c Content, res *CompileResult, inputs map[string]bool) ([]SimOutput, error) {
+	chip := res.Blueprint.Chip
+	registered := func(sym Symbol) bool {
+		olmc, ok := chip.PinToOLMC(sym.Pin)
+		return ok && res.Blueprint.OLMC[olmc].Registered
+	}
+	combinatorial := func(sym Symbol) bool {
+		olmc, ok := chip.PinToOLMC(sym.Pin)
+		return ok && res.Blueprint.OLMC[olmc].Output != nil && !res.Blueprint.OLMC[olmc].Registered
+	}
+
+	assign := make(map[string]bool)
+	for name, v := range inputs {
+		sym, ok := res.Symbols[name]
+		if !ok || name == "VCC" || name == "GND" {
+			return nil, fmt.Errorf("unknown input %q", name)
+		}
+		if combinatorial(sym) {
+			return nil, fmt.Errorf("%s is a combinatorial output; it is computed, not set", name)
+		}
+		assign[name] = v
+	}
+
+	// Collect each signal's equation, ORing APPENDs. An output is inverted
+	// when its LHS or its pin is active-low, as the OLMC XOR bit is.
+	type signal struct {
+		expr Expr
+		neg  bool
+	}
+	values := make(map[string]*signal)
+	enables := make(map[string]*signal)
+	var order []string
+	for _, eq := range res.Equations {
+		info, err := parseEquationLHS(eq.LHS)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", eq.Line, err)
+		}
+		sym, isPin := res.Symbols[info.Name]
+		isOE := info.Extension == "E"
+		switch {
+		case isOE:
+			// Evaluated once the outputs are known.
+		case info.Extension != "" && info.Extension != "T",
+			isGlobalSignal(info.Name), isPin && registered(sym):
+			continue // clocked, global reset/preset and clock equations
+		}
+		dst := values
+		if isOE {
+			dst = enables
+		}
+		if s, ok := dst[info.Name]; ok {
+			s.expr = ExprOr{A: s.expr, B: eq.Expr}
+			continue
+		}
+		s := &signal{expr: eq.Expr, neg: info.ActiveLow}
+		if isPin && !isOE {
+			// The pin level is inverted by either; the logical value then
+			// undoes the pin's own polarity.
+			s.neg = (info.ActiveLow || sym.ActiveLow) != sym.ActiveLow
+		}
+		dst[info.Name] = s
+		if !isOE {
+			order = append(order, info.Name)
+		}
+	}
+
+	// Aliases and outputs may feed one another, so evaluate whatever has
+	// all of its inputs until nothing changes.
+	sort.Strings(order)
+	for pending := order; len(pending) > 0; {
+		var next []string
+		var firstErr error
+		for _, name := range pending {
+			v, err := EvalExpr(values[name].expr, assign, c.Fields)
+			if err != nil {
+				next = append(next, name)
+				if firstErr == nil {
+					firstErr = fmt.Errorf("%s: %w", name, err)
+				}
+				continue
+			}
+			assign[name] = v != values[name].neg
+		}
+		if len(next) == len(pending) {
+			exprs := make(map[string]Expr, len(next))
+			for _, name := range next {
+				exprs[name] = values[name].expr
+			}
+			if missing := missingInputs(exprs, assign, c.Fields); len(missing) > 0 {
+				return nil, fmt.Errorf("missing input values: %s", strings.Join(missing, ", "))
+			}
+			return nil, firstErr
+		}
+		pending = next
+	}
+
+	var out []SimOutput
+	for i, olmc := range res.Blueprint.OLMC {
+		if olmc.Output == nil {
+			continue
+		}
+		pin := chip.MinOLMCPin() + i
+		name := outputName(res.Symbols, pin)
+		o := SimOutput{Name: name, Pin: pin}
+		if olmc.Registered {
+			o.Skipped = "registered output, needs a clock step"
+			out = append(out, o)
+			continue
+		}
+		o.Value = assign[name]
+		if oe, ok := enables[name]; ok {
+			v, err := EvalExpr(oe.expr, assign, c.Fields)
+			if err != nil {
+				return nil, fmt.Errorf("%s.OE: %w", name, err)
+			}
+			o.Disabled = v == oe.neg
+		}
+		out = append(out, o)
+	}
+	return out, nil
+}
+
+// missingInputs lists the signals pending expressions read that are neither
+// assigned nor computed by another pending expression.
+func missingInputs(pending map[string]Expr, assign map[string]bool, fields map[string]Field) []string {
+	seen := make(map[string]bool)
+	var missing []string
+	note := func(name string) {
+		if _, ok := assign[name]; ok || seen[name] {
+			return
+		}
+		if _, ok := pending[name]; ok {
+			return
+		}
+		seen[name] = true
+		missing = append(missing, name)
+	}
+	var walk func(Expr)
+	walk = func(expr Expr) {
+		switch e := expr.(type) {
+		case ExprIdent:
+			note(e.Name)
+		case ExprNot:
+			walk(e.X)
+		case ExprAnd:
+			walk(e.A)
+			walk(e.B)
+		case ExprOr:
+			walk(e.A)
+			walk(e.B)
+		case ExprXor:
+			walk(e.A)
+			walk(e.B)
+		case ExprFieldEquality:
+			for _, b := range fields[e.Field].Bits {
+				note(b.Name)
+			}
+		case ExprFieldRange:
+			for _, b := range fields[e.Field].Bits {
+				note(b.Name)
+			}
+		}
+	}
+	for _, expr := range pending {
+		walk(expr)
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// outputName returns the signal assigned to pin.
+func outputName(symbols map[string]Symbol, pin int) string {
+	for name, sym := range symbols {
+		if sym.Pin == pin && name != "VCC" && name != "GND" {
+			return name
+		}
+	}
+	return fmt.Sprintf("pin%d", pin)
+}
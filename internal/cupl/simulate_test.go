@@ -0,0 +1,72 @@
+package cupl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSimulate(t *testing.T) {
+	src := `Device g22v10;
+Pin 1 = CLK;
+Pin [2..5] = [A0..3];
+Pin 6 = EN;
+Pin 7 = !SEL;
+Pin 23 = Q;
+Pin 22 = !Y;
+Pin 21 = Z;
+Pin 20 = W;
+FIELD addr = [A3..0];
+tmp = addr:[4..7] & SEL;
+Q.D = A0;
+Y = tmp;
+Z = Y # Q;
+Z.OE = EN;
+!W = A0;
+`
+	content, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	res, err := CompileDetailed(content)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	inputs := map[string]bool{"A0": true, "A1": false, "A2": true, "A3": false, "EN": true, "SEL": true, "Q": false}
+	got, err := Simulate(content, res, inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SimOutput{
+		{Name: "W", Pin: 20, Value: false},
+		{Name: "Z", Pin: 21, Value: true},
+		{Name: "Y", Pin: 22, Value: true},
+		{Name: "Q", Pin: 23, Skipped: "registered output, needs a clock step"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+
+	inputs["EN"] = false
+	inputs["SEL"] = false
+	got, err = Simulate(content, res, inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if z := got[1]; z.Value || !z.Disabled {
+		t.Errorf("Z = %+v, want 0 and disabled", z)
+	}
+
+	for _, tt := range []struct {
+		inputs map[string]bool
+		want   string
+	}{
+		{map[string]bool{"A0": true}, "missing input values: A1, A2, A3, Q, SEL"},
+		{map[string]bool{"Y": true}, "Y is a combinatorial output"},
+		{map[string]bool{"NOPE": true}, `unknown input "NOPE"`},
+	} {
+		if _, err := Simulate(content, res, tt.inputs); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%v: got %v, want %q", tt.inputs, err, tt.want)
+		}
+	}
+}
@@ -13,7 +13,7 @@ const (
 	ActiveHigh
 )
 
-// Mode represents the operating mode for GAL16V8.
+// Mode represents the operating mode for GAL16V8/GAL20V8.
 type Mode int
 
 const (
@@ -23,22 +23,52 @@ const (
 	ModeRegistered             // SYN=0, AC0=1
 )
 
+func (m Mode) String() string {
+	switch m {
+	case ModeSimple:
+		return "simple"
+	case ModeComplex:
+		return "complex"
+	case ModeRegistered:
+		return "registered"
+	default:
+		return "auto"
+	}
+}
+
 type OLMC struct {
 	Active     Active
 	Output     *Term
 	Feedback   bool
 	Registered bool  // true if .R extension used
+	Tristate   bool  // true if .T extension used; needs an OE row
 	OETerm     *Term // output enable term (complex mode / 22V10 tristate)
+	CKTerm     *Term // clock term (.CK); must be the dedicated clock pin
+	LETerm     *Term // latch enable term (.LE); only on chips with latched outputs
+	// FirstRow places Output's first product term that many rows down,
+	// counted from the first row after the OE row. The rows it skips stay
+	// cleared.
+	FirstRow int
+}
+
+// PinDef names a device pin. Name is empty for unassigned pins.
+type PinDef struct {
+	Name      string
+	ActiveLow bool
 }
 
 type Blueprint struct {
 	Chip     Chip
-	Pins     []string
+	Pins     []PinDef // indexed by pin number - 1
 	Sig      []byte
 	OLMC     []OLMC
-	AR       *Term // global async reset (22V10 row 0)
-	SP       *Term // global sync preset (22V10 row 131)
-	ModeHint Mode  // forced mode from device mnemonic (ModeAuto = auto-detect)
+	AR       *Term    // global async reset (22V10 row 0)
+	SP       *Term    // global sync preset (22V10 row 131)
+	ModeHint Mode     // forced mode from device mnemonic (ModeAuto = auto-detect)
+	Vectors  []string // test vectors, one character per pin
+
+	Atmel     bool // emit the Atmel power-down/turbo fuse
+	PowerDown bool // enable Atmel power-down mode (Atmel only)
 }
 
 func NewBlueprint(chip Chip) Blueprint {
@@ -46,15 +76,11 @@ func NewBlueprint(chip Chip) Blueprint {
 	for i := range olmcs {
 		olmcs[i] = OLMC{Active: ActiveLow}
 	}
-	pins := make([]string, chip.NumPins())
-	for i := range pins {
-		pins[i] = fmt.Sprintf("PIN%d", i+1)
-	}
-	return Blueprint{Chip: chip, Pins: pins, OLMC: olmcs}
+	return Blueprint{Chip: chip, Pins: make([]PinDef, chip.NumPins()), OLMC: olmcs}
 }
 
-// detectMode determines the GAL16V8 operating mode from the blueprint.
-func detectMode(bp Blueprint) Mode {
+// DetectMode determines the GAL16V8/GAL20V8 operating mode from the blueprint.
+func DetectMode(bp Blueprint) Mode {
 	if bp.ModeHint != ModeAuto {
 		return bp.ModeHint
 	}
@@ -64,16 +90,17 @@ func detectMode(bp Blueprint) Mode {
 		}
 	}
 	for _, olmc := range bp.OLMC {
-		if olmc.OETerm != nil {
+		if olmc.OETerm != nil || olmc.Tristate {
 			return ModeComplex
 		}
 	}
-	// Check if pins 15 or 16 are used as inputs (forces complex mode).
+	// Check if the middle OLMC pins (15/16 on 16V8, 18/19 on 20V8) are used
+	// as inputs; they have no feedback path in simple mode (forces complex mode).
 	for _, olmc := range bp.OLMC {
 		if olmc.Output != nil {
 			for _, row := range olmc.Output.Pins {
 				for _, pin := range row {
-					if pin.Pin == 15 || pin.Pin == 16 {
+					if isMiddleOLMCPin(bp.Chip, pin.Pin) {
 						return ModeComplex
 					}
 				}
@@ -89,12 +116,80 @@ func detectMode(bp Blueprint) Mode {
 	return ModeSimple
 }
 
+// checkForcedMode rejects a blueprint that needs more than the mode its
+// device mnemonic forces, such as a registered output on a g16v8as, instead
+// of building a fuse map that silently drops the register. Auto-detected
+// modes always fit.
+func checkForcedMode(bp Blueprint) error {
+	if bp.ModeHint == ModeAuto || bp.ModeHint == ModeRegistered {
+		return nil
+	}
+	minPin := bp.Chip.MinOLMCPin()
+	for i, olmc := range bp.OLMC {
+		pin := minPin + i
+		if olmc.Registered {
+			return fmt.Errorf("line %d: registered output on pin %d needs registered mode, but the device forces %s mode", olmc.Output.Line, pin, bp.ModeHint)
+		}
+		if bp.ModeHint != ModeSimple {
+			continue
+		}
+		switch {
+		case olmc.Tristate:
+			return fmt.Errorf("line %d: tristate output on pin %d needs complex or registered mode", olmc.Output.Line, pin)
+		case olmc.OETerm != nil:
+			return fmt.Errorf("line %d: output enable on pin %d needs complex or registered mode, but the device forces simple mode", olmc.OETerm.Line, pin)
+		}
+		if olmc.Output == nil {
+			continue
+		}
+		// Simple mode feeds each outer OLMC's pin back to the array, so
+		// other outputs may read it, but the centre OLMCs have no feedback
+		// path at all.
+		for _, row := range olmc.Output.Pins {
+			for _, p := range row {
+				if isMiddleOLMCPin(bp.Chip, p.Pin) {
+					return fmt.Errorf("line %d: %s reads pin %d (%s), which has no feedback path in the simple mode the device forces", olmc.Output.Line, pinName(bp, pin), p.Pin, pinName(bp, p.Pin))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// pinName returns the signal assigned to pin, or "pin n" when it has none.
+func pinName(bp Blueprint, pin int) string {
+	if name := bp.Pins[pin-1].Name; name != "" {
+		return name
+	}
+	return fmt.Sprintf("pin %d", pin)
+}
+
+// isMiddleOLMCPin reports whether pin is one of the two centre OLMC pins,
+// which cannot be used as inputs in simple mode.
+func isMiddleOLMCPin(chip Chip, pin int) bool {
+	mid := chip.MinOLMCPin() + chip.NumOLMCs()/2
+	return pin == mid-1 || pin == mid
+}
+
 // BuildGAL constructs a fuse map from a blueprint.
 func BuildGAL(bp Blueprint) (*GAL, error) {
 	g := NewGAL(bp.Chip)
+	copy(g.Pins, bp.Pins)
+	g.Vectors = bp.Vectors
 
-	if bp.Chip == ChipGAL16V8 {
-		mode := detectMode(bp)
+	if bp.Atmel {
+		if !bp.Chip.HasAtmelVariant() {
+			return nil, fmt.Errorf("%s has no Atmel variant", bp.Chip.Name())
+		}
+		g.Atmel = true
+		g.PowerDown = bp.PowerDown
+	}
+
+	if bp.Chip.HasModes() {
+		mode := DetectMode(bp)
+		if err := checkForcedMode(bp); err != nil {
+			return nil, err
+		}
 		switch mode {
 		case ModeSimple:
 			g.SetSimpleMode()
@@ -105,6 +200,13 @@ func BuildGAL(bp Blueprint) (*GAL, error) {
 		}
 	}
 
+	if err := checkClocks(bp); err != nil {
+		return nil, err
+	}
+	if err := checkLatches(bp); err != nil {
+		return nil, err
+	}
+
 	setSig(g, bp.Sig)
 	setTristate(g, bp)
 	setXors(g, bp)
@@ -138,8 +240,10 @@ func setSig(gal *GAL, sig []byte) {
 }
 
 // setTristate configures AC1 bits for each OLMC.
-// In complex/registered modes (16V8) and for 22V10, combinatorial outputs
+// In complex/registered modes (16V8/20V8) and for 22V10, combinatorial outputs
 // are implemented as tristate with OE asserted. Registered outputs get AC1=0.
+// An output tied to a constant (e.g. GND, with no product terms) is still an
+// output; only OLMCs without an equation are configured as unused.
 func setTristate(g *GAL, bp Blueprint) {
 	olmcs := len(bp.OLMC)
 	for i, olmc := range bp.OLMC {
@@ -147,7 +251,7 @@ func setTristate(g *GAL, bp Blueprint) {
 		if bp.Chip == ChipGAL22V10 {
 			// 22V10: AC1=1 only for combinatorial outputs (not registered, not unused).
 			ac1 = olmc.Output != nil && !olmc.Registered
-		} else if bp.Chip == ChipGAL16V8 {
+		} else if bp.Chip.HasModes() {
 			if olmc.Output == nil {
 				// Unused OLMCs: always AC1=1.
 				ac1 = true
@@ -193,6 +297,42 @@ func setARSP(g *GAL, _ Blueprint) error {
 	return nil
 }
 
+// checkClocks validates .CK terms. The GAL16V8/20V8 and GAL22V10 have no
+// clock product term: every register is clocked from pin 1, so a clock
+// equation is only accepted when it names that pin.
+func checkClocks(bp Blueprint) error {
+	for i, olmc := range bp.OLMC {
+		if olmc.CKTerm == nil {
+			continue
+		}
+		pin := bp.Chip.MinOLMCPin() + i
+		if olmc.Output == nil || !olmc.Registered {
+			return fmt.Errorf("line %d: clock for pin %d requires a registered (.D) output", olmc.CKTerm.Line, pin)
+		}
+		t := olmc.CKTerm
+		if len(t.Pins) != 1 || len(t.Pins[0]) != 1 || t.Pins[0][0] != (Pin{Pin: 1}) {
+			return fmt.Errorf("line %d: %s registers are clocked by pin 1 only", t.Line, bp.Chip.Name())
+		}
+	}
+	return nil
+}
+
+// checkLatches validates .LE terms. A latch enable needs an OLMC that can
+// be configured as a transparent latch; none of the supported chips has one,
+// so any latch enable is rejected naming the device.
+func checkLatches(bp Blueprint) error {
+	for i, olmc := range bp.OLMC {
+		if olmc.LETerm == nil {
+			continue
+		}
+		pin := bp.Chip.MinOLMCPin() + i
+		if !bp.Chip.HasLatches() {
+			return fmt.Errorf("line %d: %s has no latched outputs; pin %d cannot use .LE", olmc.LETerm.Line, bp.Chip.Name(), pin)
+		}
+	}
+	return nil
+}
+
 // sortProductTerms sorts the product terms (rows) in a Term to match
 // WinCUPL's output ordering: fewer pins first, then ascending by the
 // highest fuse column position in the term.
@@ -228,7 +368,7 @@ func highestCol(g *GAL, row []Pin) int {
 }
 
 func setCoreEqns(g *GAL, bp Blueprint) error {
-	isComplex := bp.Chip == ChipGAL16V8 && g.Syn && g.AC0
+	isComplex := bp.Chip.HasModes() && g.Syn && g.AC0
 	hasOERow := bp.Chip == ChipGAL22V10 || isComplex
 
 	for i, olmc := range bp.OLMC {
@@ -246,6 +386,14 @@ func setCoreEqns(g *GAL, bp Blueprint) error {
 			bounds.RowOffset = 1
 		}
 
+		if olmc.Output != nil && olmc.FirstRow != 0 {
+			free := bounds.MaxRows - bounds.RowOffset
+			if olmc.FirstRow < 0 || olmc.FirstRow+len(olmc.Output.Pins) > free {
+				return fmt.Errorf("line %d: pin %d: product terms from row %d need %d rows, it has %d", olmc.Output.Line, bp.Chip.MinOLMCPin()+i, olmc.FirstRow, olmc.FirstRow+len(olmc.Output.Pins), free)
+			}
+			g.clearRows(Bounds{StartRow: bounds.StartRow, MaxRows: bounds.RowOffset + olmc.FirstRow, RowOffset: bounds.RowOffset})
+			bounds.RowOffset += olmc.FirstRow
+		}
 		if err := g.AddTermOpt(olmc.Output, bounds); err != nil {
 			return err
 		}
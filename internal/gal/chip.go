@@ -10,6 +10,7 @@ type Chip int
 const (
 	ChipUnknown Chip = iota
 	ChipGAL16V8
+	ChipGAL20V8
 	ChipGAL22V10
 )
 
@@ -35,6 +36,16 @@ var (
 		maxOLMC:   19,
 		olmcMap:   []int{56, 48, 40, 32, 24, 16, 8, 0},
 	}
+	chip20v8 = chipData{
+		name:      "GAL20V8",
+		numPins:   24,
+		numRows:   64,
+		numCols:   40,
+		totalSize: 2706,
+		minOLMC:   15,
+		maxOLMC:   22,
+		olmcMap:   []int{56, 48, 40, 32, 24, 16, 8, 0},
+	}
 	chip22v10 = chipData{
 		name:      "GAL22V10",
 		numPins:   24,
@@ -54,6 +65,8 @@ func ParseChip(name string) (Chip, error) {
 	switch {
 	case strings.Contains(n, "16V8"):
 		return ChipGAL16V8, nil
+	case strings.Contains(n, "20V8"):
+		return ChipGAL20V8, nil
 	case strings.Contains(n, "22V10"):
 		return ChipGAL22V10, nil
 	default:
@@ -61,11 +74,42 @@ func ParseChip(name string) (Chip, error) {
 	}
 }
 
-// ParseModeHint extracts a mode hint from device mnemonics like g16v8as, g16v8ma, g16v8ms.
+// ChipForFuseCount identifies a chip from the *QF fuse count of a JEDEC file.
+// Atmel parts count one more fuse than their Lattice equivalent.
+func ChipForFuseCount(n int) (Chip, error) {
+	for _, c := range []Chip{ChipGAL16V8, ChipGAL20V8, ChipGAL22V10} {
+		if c.TotalSize() == n || (c.HasAtmelVariant() && c.TotalSize()+1 == n) {
+			return c, nil
+		}
+	}
+	return ChipUnknown, fmt.Errorf("no supported device has %d fuses", n)
+}
+
+// ParseAtmel reports whether a device mnemonic names an Atmel part (atf16v8,
+// atf22v10c, ...) and whether its power-down mode is enabled with a "PD"
+// suffix (e.g. atf22v10cpd).
+func ParseAtmel(name string) (atmel, powerDown bool) {
+	n := normalizeDevice(name)
+	if !strings.HasPrefix(n, "ATF") {
+		return false, false
+	}
+	return true, strings.HasSuffix(n, "PD")
+}
+
+// ParseModeHint extracts a mode hint from the WinCUPL device mnemonics:
+// g16v8as forces simple mode, g16v8ma complex and g16v8ms registered. The
+// same suffixes apply to the GAL20V8 (g20v8as, g20v8ma, g20v8ms). g16v8,
+// g16v8a, the GAL22V10 and any other suffix return ModeAuto.
 func ParseModeHint(name string) Mode {
 	n := strings.ToUpper(strings.TrimSpace(name))
-	if strings.Contains(n, "16V8") {
-		suffix := n[strings.Index(n, "16V8")+4:]
+	if strings.HasPrefix(n, "ATF") {
+		n = strings.TrimSuffix(n, "PD")
+	}
+	for _, family := range []string{"16V8", "20V8"} {
+		if !strings.Contains(n, family) {
+			continue
+		}
+		suffix := n[strings.Index(n, family)+len(family):]
 		switch suffix {
 		case "AS":
 			return ModeSimple
@@ -106,6 +150,8 @@ func (c Chip) data() chipData {
 	switch c {
 	case ChipGAL16V8:
 		return chip16v8
+	case ChipGAL20V8:
+		return chip20v8
 	case ChipGAL22V10:
 		return chip22v10
 	default:
@@ -121,6 +167,26 @@ func (c Chip) TotalSize() int  { return c.data().totalSize }
 func (c Chip) MinOLMCPin() int { return c.data().minOLMC }
 func (c Chip) MaxOLMCPin() int { return c.data().maxOLMC }
 func (c Chip) NumOLMCs() int   { return c.data().maxOLMC - c.data().minOLMC + 1 }
+
+// ShortName returns the lower-case device name without the GAL prefix, as
+// used in JEDEC headers (e.g. "16v8").
+func (c Chip) ShortName() string {
+	return strings.ToLower(strings.TrimPrefix(c.Name(), "GAL"))
+}
+
+// HasAtmelVariant reports whether the chip has an Atmel ATF equivalent with a
+// power-down/turbo fuse after the Lattice fuse map, at index TotalSize().
+func (c Chip) HasAtmelVariant() bool { return c == ChipGAL16V8 || c == ChipGAL22V10 }
+
+// HasModes reports whether the chip has the SYN/AC0 mode fuses shared by the
+// GAL16V8 and GAL20V8 (simple, complex and registered modes).
+func (c Chip) HasModes() bool { return c == ChipGAL16V8 || c == ChipGAL20V8 }
+
+// HasLatches reports whether the chip's OLMCs can be transparent latches
+// with a latch enable product term. The GAL16V8, GAL20V8 and GAL22V10 only
+// have D flip-flops.
+func (c Chip) HasLatches() bool { return false }
+
 func (c Chip) PinToOLMC(pin int) (int, bool) {
 	d := c.data()
 	if pin < d.minOLMC || pin > d.maxOLMC {
@@ -129,6 +195,23 @@ func (c Chip) PinToOLMC(pin int) (int, bool) {
 	return pin - d.minOLMC, true
 }
 
+// firstNode22v10 is the PINNODE number of the buried feedback of OLMC 0
+// (pin 14); OLMC i is node firstNode22v10+i.
+const firstNode22v10 = 25
+
+// NodeToOLMC maps a PINNODE number to the OLMC whose feedback it names. Only
+// the GAL22V10 has nodes (25..34 for pins 14..23).
+func (c Chip) NodeToOLMC(node int) (int, bool) {
+	if c != ChipGAL22V10 {
+		return 0, false
+	}
+	olmc := node - firstNode22v10
+	if olmc < 0 || olmc >= c.NumOLMCs() {
+		return 0, false
+	}
+	return olmc, true
+}
+
 func (c Chip) NumRowsForOLMC(olmc int) int {
 	if c == ChipGAL22V10 {
 		return olmcSize22v10[olmc]
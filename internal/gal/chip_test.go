@@ -0,0 +1,96 @@
+package gal_test
+
+import (
+	"testing"
+
+	"github.com/pborges/cupl/internal/gal"
+)
+
+func TestParseModeHint(t *testing.T) {
+	tests := []struct {
+		device string
+		want   gal.Mode
+	}{
+		{"g16v8", gal.ModeAuto},
+		{"g16v8a", gal.ModeAuto},
+		{"g16v8as", gal.ModeSimple},
+		{"g16v8ma", gal.ModeComplex},
+		{"g16v8ms", gal.ModeRegistered},
+		{"G16V8MS", gal.ModeRegistered},
+		{" g16v8as ", gal.ModeSimple},
+		{"gal16v8ma", gal.ModeComplex},
+		{"g16v8xx", gal.ModeAuto},
+		{"g20v8", gal.ModeAuto},
+		{"g20v8as", gal.ModeSimple},
+		{"g20v8ma", gal.ModeComplex},
+		{"g20v8ms", gal.ModeRegistered},
+		{"atf16v8", gal.ModeAuto},
+		{"atf16v8pd", gal.ModeAuto},
+		{"g22v10", gal.ModeAuto},
+		{"", gal.ModeAuto},
+	}
+	for _, tt := range tests {
+		if got := gal.ParseModeHint(tt.device); got != tt.want {
+			t.Errorf("ParseModeHint(%q) = %s, want %s", tt.device, got, tt.want)
+		}
+	}
+}
+
+func TestColumnToPin(t *testing.T) {
+	tests := []struct {
+		chip gal.Chip
+		mode gal.Mode
+	}{
+		{gal.ChipGAL16V8, gal.ModeSimple},
+		{gal.ChipGAL16V8, gal.ModeComplex},
+		{gal.ChipGAL16V8, gal.ModeRegistered},
+		{gal.ChipGAL20V8, gal.ModeSimple},
+		{gal.ChipGAL20V8, gal.ModeComplex},
+		{gal.ChipGAL20V8, gal.ModeRegistered},
+		{gal.ChipGAL22V10, gal.ModeAuto},
+	}
+	for _, tt := range tests {
+		// Wire each pin literal into row 0 and find the one intact fuse:
+		// that is the column the forward table chose.
+		mapped := 0
+		for pin := 1; pin <= tt.chip.NumPins(); pin++ {
+			for _, neg := range []bool{false, true} {
+				g := gal.NewGAL(tt.chip)
+				switch tt.mode {
+				case gal.ModeSimple:
+					g.SetSimpleMode()
+				case gal.ModeComplex:
+					g.SetComplexMode()
+				case gal.ModeRegistered:
+					g.SetRegisteredMode()
+				}
+				term := gal.Term{Pins: [][]gal.Pin{{{Pin: pin, Neg: neg}}}}
+				if err := g.AddTerm(term, gal.Bounds{MaxRows: 1}); err != nil {
+					continue // not an AND array input in this mode
+				}
+				col := -1
+				for i := 0; i < tt.chip.NumCols(); i++ {
+					if !g.Fuses[i] {
+						col = i
+					}
+				}
+				gotPin, gotNeg, ok := tt.chip.ColumnToPin(tt.mode, col)
+				if !ok || gotPin != pin || gotNeg != neg {
+					t.Errorf("%s %s: ColumnToPin(%d) = %d, %v, %v; want %d, %v, true",
+						tt.chip.Name(), tt.mode, col, gotPin, gotNeg, ok, pin, neg)
+				}
+				mapped++
+			}
+		}
+		// Every column is fed by exactly one pin literal.
+		if mapped != tt.chip.NumCols() {
+			t.Errorf("%s %s: %d pin literals map to columns, want %d", tt.chip.Name(), tt.mode, mapped, tt.chip.NumCols())
+		}
+		if _, _, ok := tt.chip.ColumnToPin(tt.mode, tt.chip.NumCols()); ok {
+			t.Errorf("%s %s: column %d past the array resolved to a pin", tt.chip.Name(), tt.mode, tt.chip.NumCols())
+		}
+	}
+	if _, _, ok := gal.ChipGAL16V8.ColumnToPin(gal.ModeAuto, 0); ok {
+		t.Error("GAL16V8 column resolved without an operating mode")
+	}
+}
@@ -0,0 +1,205 @@
+package gal
+
+import "fmt"
+
+// DisassembleGAL reconstructs a blueprint from a complete fuse array laid out
+// in JEDEC order. The recovered terms are logically equivalent to the
+// programmed device, not necessarily identical to the original source.
+// Like the blueprints built by the compiler, terms describe the AND array
+// directly: GAL22V10 feedback from registered active-high OLMCs is not
+// un-inverted (see NeedsFeedbackFlip).
+func DisassembleGAL(chip Chip, fuses []bool) (*Blueprint, error) {
+	if chip == ChipUnknown {
+		return nil, fmt.Errorf("unsupported chip")
+	}
+	atmel := chip.HasAtmelVariant() && len(fuses) == chip.TotalSize()+1
+	if len(fuses) != chip.TotalSize() && !atmel {
+		return nil, fmt.Errorf("%s expects %d fuses, got %d", chip.Name(), chip.TotalSize(), len(fuses))
+	}
+	g := unpackFuses(chip, fuses)
+
+	colPin := make(map[int]int)
+	for col := 0; col < chip.NumCols(); col += 2 {
+		if pin, _, ok := chip.ColumnToPin(g.Mode(), col); ok {
+			colPin[col] = pin
+		}
+	}
+
+	bp := NewBlueprint(chip)
+	bp.Sig = unpackSig(g.Sig)
+	if atmel {
+		bp.Atmel = true
+		bp.PowerDown = !fuses[chip.TotalSize()]
+	}
+	if chip.HasModes() {
+		switch {
+		case g.Syn && !g.AC0:
+			bp.ModeHint = ModeSimple
+		case g.Syn && g.AC0:
+			bp.ModeHint = ModeComplex
+		default:
+			bp.ModeHint = ModeRegistered
+		}
+	}
+
+	olmcs := chip.NumOLMCs()
+	for i := range bp.OLMC {
+		ac1 := g.AC1[olmcs-1-i]
+		bounds := chip.BoundsForOLMC(i)
+		hasOERow := chip == ChipGAL22V10 || (g.AC0 && ac1)
+		if chip.HasModes() && !g.AC0 && ac1 {
+			// Simple mode with AC1 set: the OLMC is a dedicated input.
+			continue
+		}
+
+		var oe *Term
+		if hasOERow {
+			t, err := g.decodeRows(bounds.StartRow, 1, colPin)
+			if err != nil {
+				return nil, err
+			}
+			oe = t
+			bounds.RowOffset = 1
+		}
+		out, err := g.decodeRows(bounds.StartRow+bounds.RowOffset, bounds.MaxRows-bounds.RowOffset, colPin)
+		if err != nil {
+			return nil, err
+		}
+		xor := g.Xor[olmcs-1-i]
+		simpleOutput := chip.HasModes() && !g.AC0
+		if !simpleOutput && !xor && len(out.Pins) == 0 && (oe == nil || len(oe.Pins) == 0) {
+			// Every row is FALSE: the OLMC is unused.
+			continue
+		}
+
+		olmc := &bp.OLMC[i]
+		olmc.Output = out
+		if oe != nil && !isTrueTerm(oe) {
+			olmc.OETerm = oe
+		}
+		if xor {
+			olmc.Active = ActiveHigh
+		}
+		if chip == ChipGAL22V10 {
+			olmc.Registered = !ac1
+		} else {
+			olmc.Registered = !g.Syn && g.AC0 && !ac1
+		}
+	}
+
+	if chip == ChipGAL22V10 {
+		ar, err := g.decodeRows(0, 1, colPin)
+		if err != nil {
+			return nil, err
+		}
+		sp, err := g.decodeRows(131, 1, colPin)
+		if err != nil {
+			return nil, err
+		}
+		if len(ar.Pins) > 0 {
+			bp.AR = ar
+		}
+		if len(sp.Pins) > 0 {
+			bp.SP = sp
+		}
+	}
+	return &bp, nil
+}
+
+// unpackFuses splits a JEDEC-ordered fuse array into a GAL, mirroring the
+// section order written by the jed package.
+func unpackFuses(chip Chip, fuses []bool) *GAL {
+	g := NewGAL(chip)
+	i := copy(g.Fuses, fuses)
+	if chip == ChipGAL22V10 {
+		for j := range g.Xor {
+			g.Xor[j] = fuses[i]
+			g.AC1[j] = fuses[i+1]
+			i += 2
+		}
+		copy(g.Sig, fuses[i:])
+		return g
+	}
+	i += copy(g.Xor, fuses[i:])
+	i += copy(g.Sig, fuses[i:])
+	i += copy(g.AC1, fuses[i:])
+	i += copy(g.PT, fuses[i:])
+	g.Syn = fuses[i]
+	g.AC0 = fuses[i+1]
+	return g
+}
+
+func unpackSig(bits []bool) []byte {
+	var sig []byte
+	for i := 0; i+8 <= len(bits); i += 8 {
+		var c byte
+		for j := 0; j < 8; j++ {
+			if bits[i+j] {
+				c |= 0x80 >> j
+			}
+		}
+		sig = append(sig, c)
+	}
+	for len(sig) > 0 && sig[len(sig)-1] == 0 {
+		sig = sig[:len(sig)-1]
+	}
+	return sig
+}
+
+// decodeRows reads n product-term rows starting at start. A false fuse
+// connects that input to the row. Rows that can never be true (a pin ANDed
+// with its complement, as in a cleared row) are dropped; a row with no inputs
+// connected is an empty (TRUE) product.
+func (g *GAL) decodeRows(start, n int, colPin map[int]int) (*Term, error) {
+	cols := g.Chip.NumCols()
+	term := &Term{}
+	for row := start; row < start+n; row++ {
+		fuses := g.Fuses[row*cols : (row+1)*cols]
+		var pins []Pin
+		impossible := false
+		for col := 0; col < cols; col += 2 {
+			pos, neg := !fuses[col], !fuses[col+1]
+			if !pos && !neg {
+				continue
+			}
+			if pos && neg {
+				impossible = true
+				break
+			}
+			pin, ok := colPin[col]
+			if !ok {
+				return nil, fmt.Errorf("row %d: column %d has no input in this mode", row, col)
+			}
+			pins = append(pins, Pin{Pin: pin, Neg: neg})
+		}
+		if impossible {
+			continue
+		}
+		term.Pins = append(term.Pins, pins)
+	}
+	return term, nil
+}
+
+func isTrueTerm(t *Term) bool {
+	for _, row := range t.Pins {
+		if len(row) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// NeedsFeedbackFlip reports whether AND-array references to pin are the
+// complement of the pin value. On the GAL22V10, registered active-high outputs
+// feed back from the register ahead of the XOR gate.
+func (bp *Blueprint) NeedsFeedbackFlip(pin int) bool {
+	if bp.Chip != ChipGAL22V10 {
+		return false
+	}
+	olmc, ok := bp.Chip.PinToOLMC(pin)
+	if !ok {
+		return false
+	}
+	o := bp.OLMC[olmc]
+	return o.Output != nil && o.Registered && o.Active == ActiveHigh
+}
@@ -0,0 +1,61 @@
+package gal_test
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/pborges/cupl/examples"
+	"github.com/pborges/cupl/internal/gal"
+	"github.com/pborges/cupl/internal/jed"
+)
+
+// TestDisassembleRoundTrip rebuilds every example fuse map from its
+// disassembled blueprint and expects identical fuses. Only fixtures produced
+// by this compiler (those with a .pld source) are checked, since BuildGAL
+// reorders product terms.
+func TestDisassembleRoundTrip(t *testing.T) {
+	jedFiles, err := fs.Glob(examples.FS, "*.jed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range jedFiles {
+		base := strings.TrimSuffix(path, ".jed")
+		if _, err := fs.Stat(examples.FS, base+".pld"); err != nil {
+			if _, err := fs.Stat(examples.FS, base+".PLD"); err != nil {
+				continue
+			}
+		}
+		t.Run(path, func(t *testing.T) {
+			data, err := examples.FS.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := jed.Parse(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chip, err := gal.ChipForFuseCount(want.QF)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bp, err := gal.DisassembleGAL(chip, want.Fuses)
+			if err != nil {
+				t.Fatalf("disassemble: %v", err)
+			}
+			g, err := gal.BuildGAL(*bp)
+			if err != nil {
+				t.Fatalf("build: %v", err)
+			}
+			got, err := jed.Parse([]byte(jed.MakeJEDEC(jed.Config{}, g)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range want.Fuses {
+				if got.Fuses[i] != want.Fuses[i] {
+					t.Fatalf("fuse %d: got %v want %v", i, got.Fuses[i], want.Fuses[i])
+				}
+			}
+		})
+	}
+}
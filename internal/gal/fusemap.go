@@ -0,0 +1,116 @@
+package gal
+
+import "fmt"
+
+// FuseSectionName returns the section name of a fuse index in JEDEC order,
+// e.g. "Logic OLMC7(pin19) row0 col2" or "XOR[3]".
+func (c Chip) FuseSectionName(idx int) string {
+	switch c {
+	case ChipGAL16V8:
+		return FuseSectionName16V8(idx)
+	case ChipGAL20V8:
+		return FuseSectionName20V8(idx)
+	case ChipGAL22V10:
+		return FuseSectionName22V10(idx)
+	default:
+		return fmt.Sprintf("fuse[%d]", idx)
+	}
+}
+
+// FuseSectionName16V8 returns the section name for a given fuse index on a GAL16V8.
+// JED layout: Logic(2048) + XOR(8) + SIG(64) + AC1(8) + PT(64) + SYN(1) + AC0(1) = 2194
+func FuseSectionName16V8(idx int) string {
+	switch {
+	case idx < 2048:
+		row := idx / 32
+		col := idx % 32
+		olmcNames := []string{"OLMC7(pin19)", "OLMC6(pin18)", "OLMC5(pin17)", "OLMC4(pin16)", "OLMC3(pin15)", "OLMC2(pin14)", "OLMC1(pin13)", "OLMC0(pin12)"}
+		olmcIdx := row / 8
+		olmcRow := row % 8
+		name := "?"
+		if olmcIdx < len(olmcNames) {
+			name = olmcNames[olmcIdx]
+		}
+		return fmt.Sprintf("Logic %s row%d col%d", name, olmcRow, col)
+	case idx < 2056:
+		return fmt.Sprintf("XOR[%d]", idx-2048)
+	case idx < 2120:
+		return fmt.Sprintf("SIG[%d]", idx-2056)
+	case idx < 2128:
+		return fmt.Sprintf("AC1[%d]", idx-2120)
+	case idx < 2192:
+		return fmt.Sprintf("PT[%d]", idx-2128)
+	case idx == 2192:
+		return "SYN"
+	case idx == 2193:
+		return "AC0"
+	case idx == 2194:
+		return "PD" // Atmel only
+	default:
+		return fmt.Sprintf("unknown(%d)", idx)
+	}
+}
+
+// FuseSectionName20V8 returns the section name for a given fuse index on a GAL20V8.
+// JED layout: Logic(2560) + XOR(8) + SIG(64) + AC1(8) + PT(64) + SYN(1) + AC0(1) = 2706
+func FuseSectionName20V8(idx int) string {
+	switch {
+	case idx < 2560:
+		row := idx / 40
+		col := idx % 40
+		olmcNames := []string{"OLMC7(pin22)", "OLMC6(pin21)", "OLMC5(pin20)", "OLMC4(pin19)", "OLMC3(pin18)", "OLMC2(pin17)", "OLMC1(pin16)", "OLMC0(pin15)"}
+		olmcIdx := row / 8
+		olmcRow := row % 8
+		name := "?"
+		if olmcIdx < len(olmcNames) {
+			name = olmcNames[olmcIdx]
+		}
+		return fmt.Sprintf("Logic %s row%d col%d", name, olmcRow, col)
+	case idx < 2568:
+		return fmt.Sprintf("XOR[%d]", idx-2560)
+	case idx < 2632:
+		return fmt.Sprintf("SIG[%d]", idx-2568)
+	case idx < 2640:
+		return fmt.Sprintf("AC1[%d]", idx-2632)
+	case idx < 2704:
+		return fmt.Sprintf("PT[%d]", idx-2640)
+	case idx == 2704:
+		return "SYN"
+	case idx == 2705:
+		return "AC0"
+	default:
+		return fmt.Sprintf("unknown(%d)", idx)
+	}
+}
+
+// FuseSectionName22V10 returns the section name for a given fuse index on a GAL22V10.
+// JED layout: Logic(5808) + XOR/AC1 interleaved per OLMC(20) + SIG(64) = 5892
+func FuseSectionName22V10(idx int) string {
+	switch {
+	case idx < 5808:
+		row := idx / 44
+		col := idx % 44
+		// Row 0 is AR and row 131 is SP; the OLMCs sit in between.
+		olmcStarts := []int{0, 1, 10, 21, 34, 49, 66, 83, 98, 111, 122, 131}
+		olmcSizes := []int{1, 9, 11, 13, 15, 17, 17, 15, 13, 11, 9, 1}
+		olmcPins := []string{"AR", "OLMC(pin23)", "OLMC(pin22)", "OLMC(pin21)", "OLMC(pin20)", "OLMC(pin19)", "OLMC(pin18)", "OLMC(pin17)", "OLMC(pin16)", "OLMC(pin15)", "OLMC(pin14)", "SP"}
+		for i := len(olmcStarts) - 1; i >= 0; i-- {
+			if row >= olmcStarts[i] {
+				localRow := row - olmcStarts[i]
+				return fmt.Sprintf("Logic %s row%d/%d col%d", olmcPins[i], localRow, olmcSizes[i], col)
+			}
+		}
+		return fmt.Sprintf("Logic row%d col%d", row, col)
+	case idx < 5828:
+		if (idx-5808)%2 == 0 {
+			return fmt.Sprintf("XOR[%d]", (idx-5808)/2)
+		}
+		return fmt.Sprintf("AC1[%d]", (idx-5808)/2)
+	case idx < 5892:
+		return fmt.Sprintf("SIG[%d]", idx-5828)
+	case idx == 5892:
+		return "PD" // Atmel only
+	default:
+		return fmt.Sprintf("unknown(%d)", idx)
+	}
+}
@@ -0,0 +1,30 @@
+package gal_test
+
+import (
+	"testing"
+
+	"github.com/pborges/cupl/internal/gal"
+)
+
+func TestFuseSectionName(t *testing.T) {
+	tests := []struct {
+		chip gal.Chip
+		idx  int
+		want string
+	}{
+		{gal.ChipGAL16V8, 34, "Logic OLMC7(pin19) row1 col2"},
+		{gal.ChipGAL16V8, 2193, "AC0"},
+		{gal.ChipGAL20V8, 2632, "AC1[0]"},
+		{gal.ChipGAL22V10, 3, "Logic AR row0/1 col3"},
+		{gal.ChipGAL22V10, 44, "Logic OLMC(pin23) row0/9 col0"},
+		{gal.ChipGAL22V10, 131*44 + 5, "Logic SP row0/1 col5"},
+		{gal.ChipGAL22V10, 5810, "XOR[1]"},
+		{gal.ChipGAL22V10, 5811, "AC1[1]"},
+		{gal.ChipGAL22V10, 5828, "SIG[0]"},
+	}
+	for _, tt := range tests {
+		if got := tt.chip.FuseSectionName(tt.idx); got != tt.want {
+			t.Errorf("%s fuse %d = %q, want %q", tt.chip.Name(), tt.idx, got, tt.want)
+		}
+	}
+}
@@ -15,7 +15,9 @@ type Term struct {
 }
 
 type GAL struct {
-	Chip Chip
+	Chip    Chip
+	Pins    []PinDef // pin names from the blueprint, indexed by pin number - 1
+	Vectors []string // JEDEC *V test vectors, one character per pin
 
 	Fuses []bool
 	Xor   []bool
@@ -24,6 +26,89 @@ type GAL struct {
 	PT    []bool
 	Syn   bool
 	AC0   bool
+
+	// Atmel parts append one fuse after the Lattice map; it is 0 when
+	// power-down mode is enabled and 1 (turbo, always on) otherwise.
+	Atmel     bool
+	PowerDown bool
+}
+
+// FuseCount is the number of fuses in the JEDEC file for this GAL.
+func (g *GAL) FuseCount() int {
+	if g.Atmel {
+		return g.Chip.TotalSize() + 1
+	}
+	return g.Chip.TotalSize()
+}
+
+// FuseAt returns the AND array fuse at row, col; false connects that input
+// to the row, as a JEDEC 0 does. ok is false outside the array.
+func (g *GAL) FuseAt(row, col int) (fuse, ok bool) {
+	cols := g.Chip.NumCols()
+	if row < 0 || row >= g.Chip.NumRows() || col < 0 || col >= cols {
+		return false, false
+	}
+	return g.Fuses[row*cols+col], true
+}
+
+// Row returns a copy of product term localRow of olmc's rows, one fuse per
+// column, or nil if either is out of range. Row 0 of a block is the OE term
+// when the OLMC has one.
+func (g *GAL) Row(olmc, localRow int) []bool {
+	if olmc < 0 || olmc >= g.Chip.NumOLMCs() || localRow < 0 || localRow >= g.Chip.NumRowsForOLMC(olmc) {
+		return nil
+	}
+	cols := g.Chip.NumCols()
+	start := (g.Chip.BoundsForOLMC(olmc).StartRow + localRow) * cols
+	return append([]bool(nil), g.Fuses[start:start+cols]...)
+}
+
+// XorFuse returns olmc's XOR (output polarity) fuse.
+func (g *GAL) XorFuse(olmc int) (bool, bool) {
+	return fuseIn(g.Xor, olmc)
+}
+
+// AC1Fuse returns olmc's AC1 fuse, which is S1 on the GAL22V10.
+func (g *GAL) AC1Fuse(olmc int) (bool, bool) {
+	return fuseIn(g.AC1, olmc)
+}
+
+// PTFuse returns the product term disable fuse of row. Only the GAL16V8 and
+// GAL20V8 have them.
+func (g *GAL) PTFuse(row int) (bool, bool) {
+	if !g.Chip.HasModes() {
+		return false, false
+	}
+	return fuseIn(g.PT, row)
+}
+
+// SynFuse returns the SYN mode fuse of a GAL16V8 or GAL20V8.
+func (g *GAL) SynFuse() (bool, bool) {
+	return g.Syn, g.Chip.HasModes()
+}
+
+// AC0Fuse returns the AC0 mode fuse of a GAL16V8 or GAL20V8.
+func (g *GAL) AC0Fuse() (bool, bool) {
+	return g.AC0, g.Chip.HasModes()
+}
+
+// Signature returns the 64 user signature fuses as 8 bytes, most
+// significant bit first.
+func (g *GAL) Signature() []byte {
+	sig := make([]byte, len(g.Sig)/8)
+	for i, bit := range g.Sig[:len(sig)*8] {
+		if bit {
+			sig[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return sig
+}
+
+func fuseIn(fuses []bool, i int) (bool, bool) {
+	if i < 0 || i >= len(fuses) {
+		return false, false
+	}
+	return fuses[i], true
 }
 
 func NewGAL(chip Chip) *GAL {
@@ -31,6 +116,7 @@ func NewGAL(chip Chip) *GAL {
 	olmcs := chip.NumOLMCs()
 	g := &GAL{
 		Chip:  chip,
+		Pins:  make([]PinDef, chip.NumPins()),
 		Fuses: make([]bool, logicSize),
 		Xor:   make([]bool, olmcs),
 		Sig:   make([]bool, 64),
@@ -60,6 +146,21 @@ func (g *GAL) SetRegisteredMode() {
 	g.AC0 = true
 }
 
+// Mode returns the GAL16V8/GAL20V8 operating mode the SYN and AC0 fuses
+// select, or ModeAuto for a chip without modes.
+func (g *GAL) Mode() Mode {
+	switch {
+	case !g.Chip.HasModes():
+		return ModeAuto
+	case g.Syn && !g.AC0:
+		return ModeSimple
+	case g.Syn && g.AC0:
+		return ModeComplex
+	default:
+		return ModeRegistered
+	}
+}
+
 func (g *GAL) AddTerm(term Term, bounds Bounds) error {
 	b := bounds
 	singleRow := b.MaxRows == b.RowOffset+1
@@ -128,12 +229,50 @@ func (g *GAL) pinToColumn(pin int) (int, error) {
 		}
 		return pinToCol16Simple(pin)
 	}
+	if g.Chip == ChipGAL20V8 {
+		if !g.Syn && g.AC0 {
+			return pinToCol20Registered(pin)
+		}
+		if g.Syn && g.AC0 {
+			return pinToCol20Complex(pin)
+		}
+		return pinToCol20Simple(pin)
+	}
 	if g.Chip == ChipGAL22V10 {
 		return pinToCol22v10(pin)
 	}
 	return 0, fmt.Errorf("unsupported chip")
 }
 
+// ColumnToPin returns the pin that feeds AND array column col, and whether
+// the column carries its complement; it inverts the tables behind setAnd.
+// The GAL16V8 and GAL20V8 tables depend on the operating mode, which must be
+// ModeSimple, ModeComplex or ModeRegistered; the GAL22V10 ignores mode.
+func (c Chip) ColumnToPin(mode Mode, col int) (pin int, neg bool, ok bool) {
+	if c == ChipUnknown || col < 0 || col >= c.NumCols() {
+		return 0, false, false
+	}
+	g := &GAL{Chip: c}
+	if c.HasModes() {
+		switch mode {
+		case ModeSimple:
+			g.SetSimpleMode()
+		case ModeComplex:
+			g.SetComplexMode()
+		case ModeRegistered:
+			g.SetRegisteredMode()
+		default:
+			return 0, false, false
+		}
+	}
+	for pin := 1; pin <= c.NumPins(); pin++ {
+		if base, err := g.pinToColumn(pin); err == nil && base == col&^1 {
+			return pin, col&1 == 1, true
+		}
+	}
+	return 0, false, false
+}
+
 func pinToCol16Simple(pin int) (int, error) {
 	// 1-based pin index into table.
 	// Table adapted from galette (GAL16V8 simple mode).
@@ -277,6 +416,172 @@ func pinToCol16Complex(pin int) (int, error) {
 	}
 }
 
+func pinToCol20Simple(pin int) (int, error) {
+	// Table adapted from galette (GAL20V8 simple mode).
+	switch pin {
+	case 1:
+		return 2, nil
+	case 2:
+		return 0, nil
+	case 3:
+		return 4, nil
+	case 4:
+		return 8, nil
+	case 5:
+		return 12, nil
+	case 6:
+		return 16, nil
+	case 7:
+		return 20, nil
+	case 8:
+		return 24, nil
+	case 9:
+		return 28, nil
+	case 10:
+		return 32, nil
+	case 11:
+		return 36, nil
+	case 12:
+		return 0, fmt.Errorf("pin %d is power", pin)
+	case 13:
+		return 38, nil
+	case 14:
+		return 34, nil
+	case 15:
+		return 30, nil
+	case 16:
+		return 26, nil
+	case 17:
+		return 22, nil
+	case 18:
+		return 0, fmt.Errorf("pin %d is not an input in simple mode", pin)
+	case 19:
+		return 0, fmt.Errorf("pin %d is not an input in simple mode", pin)
+	case 20:
+		return 18, nil
+	case 21:
+		return 14, nil
+	case 22:
+		return 10, nil
+	case 23:
+		return 6, nil
+	case 24:
+		return 0, fmt.Errorf("pin %d is power", pin)
+	default:
+		return 0, fmt.Errorf("invalid pin %d", pin)
+	}
+}
+
+func pinToCol20Registered(pin int) (int, error) {
+	switch pin {
+	case 1:
+		return 0, fmt.Errorf("pin 1 is clock in registered mode")
+	case 2:
+		return 0, nil
+	case 3:
+		return 4, nil
+	case 4:
+		return 8, nil
+	case 5:
+		return 12, nil
+	case 6:
+		return 16, nil
+	case 7:
+		return 20, nil
+	case 8:
+		return 24, nil
+	case 9:
+		return 28, nil
+	case 10:
+		return 32, nil
+	case 11:
+		return 36, nil
+	case 12:
+		return 0, fmt.Errorf("pin %d is power", pin)
+	case 13:
+		return 0, fmt.Errorf("pin 13 is /OE in registered mode")
+	case 14:
+		return 38, nil
+	case 15:
+		return 34, nil
+	case 16:
+		return 30, nil
+	case 17:
+		return 26, nil
+	case 18:
+		return 22, nil
+	case 19:
+		return 18, nil
+	case 20:
+		return 14, nil
+	case 21:
+		return 10, nil
+	case 22:
+		return 6, nil
+	case 23:
+		return 2, nil
+	case 24:
+		return 0, fmt.Errorf("pin %d is power", pin)
+	default:
+		return 0, fmt.Errorf("invalid pin %d", pin)
+	}
+}
+
+func pinToCol20Complex(pin int) (int, error) {
+	switch pin {
+	case 1:
+		return 2, nil
+	case 2:
+		return 0, nil
+	case 3:
+		return 4, nil
+	case 4:
+		return 8, nil
+	case 5:
+		return 12, nil
+	case 6:
+		return 16, nil
+	case 7:
+		return 20, nil
+	case 8:
+		return 24, nil
+	case 9:
+		return 28, nil
+	case 10:
+		return 32, nil
+	case 11:
+		return 36, nil
+	case 12:
+		return 0, fmt.Errorf("pin %d is power", pin)
+	case 13:
+		return 38, nil
+	case 14:
+		return 34, nil
+	case 15:
+		return 0, fmt.Errorf("pin 15 is not an input in complex mode")
+	case 16:
+		return 30, nil
+	case 17:
+		return 26, nil
+	case 18:
+		return 22, nil
+	case 19:
+		return 18, nil
+	case 20:
+		return 14, nil
+	case 21:
+		return 10, nil
+	case 22:
+		return 0, fmt.Errorf("pin 22 is not an input in complex mode")
+	case 23:
+		return 6, nil
+	case 24:
+		return 0, fmt.Errorf("pin %d is power", pin)
+	default:
+		return 0, fmt.Errorf("invalid pin %d", pin)
+	}
+}
+
 func pinToCol22v10(pin int) (int, error) {
 	switch pin {
 	case 1:
@@ -0,0 +1,104 @@
+package gal_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pborges/cupl/internal/gal"
+)
+
+func TestFuseAccessors(t *testing.T) {
+	for _, chip := range []gal.Chip{gal.ChipGAL16V8, gal.ChipGAL20V8, gal.ChipGAL22V10} {
+		g := gal.NewGAL(chip)
+		for i := range g.Fuses {
+			g.Fuses[i] = i%3 == 0
+		}
+		cols := chip.NumCols()
+
+		// Each OLMC's rows are its own: Row agrees with FuseAt and with the
+		// flat fuse slice, and no two OLMCs share a row.
+		owner := make(map[int]int)
+		for olmc := 0; olmc < chip.NumOLMCs(); olmc++ {
+			start := chip.BoundsForOLMC(olmc).StartRow
+			for local := 0; local < chip.NumRowsForOLMC(olmc); local++ {
+				row := start + local
+				if prev, ok := owner[row]; ok {
+					t.Errorf("%s: row %d is in OLMC %d and %d", chip.Name(), row, prev, olmc)
+				}
+				owner[row] = olmc
+				fuses := g.Row(olmc, local)
+				if len(fuses) != cols {
+					t.Fatalf("%s: Row(%d, %d) has %d fuses, want %d", chip.Name(), olmc, local, len(fuses), cols)
+				}
+				for col, f := range fuses {
+					at, ok := g.FuseAt(row, col)
+					if !ok || at != f || f != g.Fuses[row*cols+col] {
+						t.Errorf("%s: Row(%d, %d)[%d] = %v, FuseAt(%d, %d) = %v, %v", chip.Name(), olmc, local, col, f, row, col, at, ok)
+					}
+				}
+			}
+			if g.Row(olmc, chip.NumRowsForOLMC(olmc)) != nil || g.Row(olmc, -1) != nil {
+				t.Errorf("%s: OLMC %d row out of range returned fuses", chip.Name(), olmc)
+			}
+		}
+		if g.Row(chip.NumOLMCs(), 0) != nil || g.Row(-1, 0) != nil {
+			t.Errorf("%s: OLMC out of range returned fuses", chip.Name())
+		}
+		for _, rc := range [][2]int{{-1, 0}, {0, -1}, {chip.NumRows(), 0}, {0, cols}} {
+			if _, ok := g.FuseAt(rc[0], rc[1]); ok {
+				t.Errorf("%s: FuseAt(%d, %d) is in range", chip.Name(), rc[0], rc[1])
+			}
+		}
+
+		// Row is a copy.
+		first := chip.BoundsForOLMC(0).StartRow
+		before, _ := g.FuseAt(first, 0)
+		g.Row(0, 0)[0] = !before
+		if after, _ := g.FuseAt(first, 0); after != before {
+			t.Errorf("%s: writing to Row changed the fuse map", chip.Name())
+		}
+
+		g.Xor[chip.NumOLMCs()-1] = true
+		if f, ok := g.XorFuse(chip.NumOLMCs() - 1); !f || !ok {
+			t.Errorf("%s: XorFuse = %v, %v", chip.Name(), f, ok)
+		}
+		if _, ok := g.XorFuse(chip.NumOLMCs()); ok {
+			t.Errorf("%s: XorFuse past the last OLMC is in range", chip.Name())
+		}
+		if _, ok := g.AC1Fuse(0); !ok {
+			t.Errorf("%s: AC1Fuse(0) out of range", chip.Name())
+		}
+		_, ptOK := g.PTFuse(0)
+		_, synOK := g.SynFuse()
+		_, ac0OK := g.AC0Fuse()
+		if want := chip.HasModes(); ptOK != want || synOK != want || ac0OK != want {
+			t.Errorf("%s: PT/SYN/AC0 present %v/%v/%v, want %v", chip.Name(), ptOK, synOK, ac0OK, want)
+		}
+	}
+
+	// A term placed in an OLMC's bounds shows up in that OLMC's rows.
+	g := gal.NewGAL(gal.ChipGAL22V10)
+	olmc, _ := gal.ChipGAL22V10.PinToOLMC(23)
+	b := gal.ChipGAL22V10.BoundsForOLMC(olmc)
+	b.RowOffset = 1
+	if err := g.AddTerm(gal.Term{Pins: [][]gal.Pin{{{Pin: 2}}}}, b); err != nil {
+		t.Fatal(err)
+	}
+	var connected []int
+	for col, f := range g.Row(olmc, 1) {
+		if !f {
+			connected = append(connected, col)
+		}
+	}
+	if want := []int{4}; !reflect.DeepEqual(connected, want) {
+		t.Errorf("pin 23 row 1 connects columns %v, want %v (pin 2)", connected, want)
+	}
+	if f, _ := g.FuseAt(1+1, 4); f {
+		t.Error("pin 23 row 1 is not array row 2")
+	}
+
+	copy(g.Sig, []bool{false, true, false, false, false, false, false, true})
+	if got, want := g.Signature(), []byte{'A', 0, 0, 0, 0, 0, 0, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Signature = %q, want %q", got, want)
+	}
+}
@@ -8,8 +8,59 @@ import (
 )
 
 type Config struct {
-	SecurityBit bool
-	Header      []string
+	SecurityBit  bool
+	Header       []string
+	EmitPinNotes bool // emit a "*N PIN <num> <name>" note for each assigned pin
+
+	// EmitDeviceFields writes a "*D" device field and always writes the
+	// "*QP" pin count, which is otherwise only written with test vectors.
+	EmitDeviceFields bool
+
+	// EmitAllFuses writes an *L line for every row, including fully intact
+	// rows that are otherwise left to the *F0 default, for programmers that
+	// ignore the default.
+	EmitAllFuses bool
+
+	// UserSignature is written as a "*UH" user data field in hex. It should
+	// match the GAL's SIG fuses, which hold the same electronic signature.
+	UserSignature []byte
+
+	// LineEnding ends every line; "" means "\n". "\r\n" suits Windows
+	// programmers that reject bare line feeds. The transmission checksum
+	// covers the line endings as written.
+	LineEnding string
+
+	// FuseLineWidth writes *L lines of that many fuses regardless of the
+	// chip geometry, e.g. 32 for tools that expect fixed-width lines. 0
+	// writes one line per AND array row and per configuration section.
+	FuseLineWidth int
+}
+
+// headerKeys lists the design meta fields written to the JEDEC header, in
+// order, when the source order is not known.
+var headerKeys = []string{"Name", "Partno", "Revision", "Date", "Designer", "Company", "Assembly", "Location"}
+
+// HeaderLines returns the free-form header written ahead of the first JEDEC
+// field: the compiler version, the device and any non-empty meta fields.
+// Fields are written in the given order, which may include custom keys; a
+// nil order writes the standard keys. Userid is written as *U instead.
+func HeaderLines(version string, chip gal.Chip, meta map[string]string, order []string) []string {
+	lines := []string{
+		fmt.Sprintf("CUPlang        %s", version),
+		fmt.Sprintf("Device          %s", chip.ShortName()),
+	}
+	if order == nil {
+		order = headerKeys
+	}
+	for _, k := range order {
+		if k == "Userid" {
+			continue
+		}
+		if v := strings.TrimSpace(meta[k]); v != "" {
+			lines = append(lines, fmt.Sprintf("%-15s %s", k, v))
+		}
+	}
+	return lines
 }
 
 // MakeJEDEC generates a JEDEC string for the given GAL.
@@ -23,50 +74,111 @@ func MakeJEDEC(cfg Config, g *gal.GAL) string {
 			buf.WriteByte('\n')
 		}
 	}
+	if cfg.EmitPinNotes {
+		writePinNotes(&buf, g)
+	}
+	if cfg.EmitDeviceFields {
+		fmt.Fprintf(&buf, "*D%s\n", g.Chip.Name())
+	}
 	buf.WriteString("*F0\n")
 	if cfg.SecurityBit {
 		buf.WriteString("*G1\n")
 	} else {
 		buf.WriteString("*G0\n")
 	}
-	fmt.Fprintf(&buf, "*QF%d\n", g.Chip.TotalSize())
+	fmt.Fprintf(&buf, "*QF%d\n", g.FuseCount())
+	if len(g.Vectors) > 0 || cfg.EmitDeviceFields {
+		fmt.Fprintf(&buf, "*QP%d\n", g.Chip.NumPins())
+	}
+	if len(g.Vectors) > 0 {
+		fmt.Fprintf(&buf, "*QV%d\n", len(g.Vectors))
+	}
+	if len(cfg.UserSignature) > 0 {
+		fmt.Fprintf(&buf, "*UH%X\n", cfg.UserSignature)
+	}
 
 	fb := newFuseBuilder(&buf)
+	rows, config := fuseSections(g)
+	if w := cfg.FuseLineWidth; w > 0 {
+		var all []bool
+		for _, sec := range append(rows, config...) {
+			all = append(all, sec...)
+		}
+		for i := 0; i < len(all); i += w {
+			chunk := all[i:min(i+w, len(all))]
+			if cfg.EmitAllFuses || anyTrue(chunk) {
+				fb.add(chunk)
+			} else {
+				fb.skip(chunk)
+			}
+		}
+	} else {
+		for _, chunk := range rows {
+			if cfg.EmitAllFuses || anyTrue(chunk) {
+				fb.add(chunk)
+			} else {
+				fb.skip(chunk)
+			}
+		}
+		for _, sec := range config {
+			fb.add(sec)
+		}
+	}
+	fb.checksum()
+	for i, v := range g.Vectors {
+		fmt.Fprintf(&buf, "*V%04d %s\n", i+1, v)
+	}
+	buf.WriteString("*\n")
+	eol := cfg.LineEnding
+	if eol == "" {
+		eol = "\n"
+	}
+	out := strings.ReplaceAll(buf.String(), "\n", eol) + "\x03"
+	return out + fmt.Sprintf("%04x", fileChecksum([]byte(out))) + eol
+}
+
+// fuseSections splits g's fuse map, in JEDEC order, into the AND array rows
+// and the configuration fuses after them: the XOR bits (interleaved with
+// AC1 on the GAL22V10), the signature, the mode fuses and the Atmel
+// power-down fuse.
+func fuseSections(g *gal.GAL) (rows, config [][]bool) {
 	rowLen := g.Chip.NumCols()
 	for row := 0; row < len(g.Fuses); row += rowLen {
-		chunk := g.Fuses[row : row+rowLen]
-		if anyTrue(chunk) {
-			fb.add(chunk)
-		} else {
-			fb.skip(chunk)
-		}
+		rows = append(rows, g.Fuses[row:row+rowLen])
 	}
 
 	if g.Chip != gal.ChipGAL22V10 {
-		fb.add(g.Xor)
+		config = append(config, g.Xor)
 	} else {
-		// interleave XOR and AC1
+		var xorAC1 []bool
 		for i := 0; i < len(g.Xor) && i < len(g.AC1); i++ {
-			fb.addBit(g.Xor[i])
-			fb.addBit(g.AC1[i])
+			xorAC1 = append(xorAC1, g.Xor[i], g.AC1[i])
 		}
-		fb.endLine()
+		config = append(config, xorAC1)
 	}
-
-	fb.add(g.Sig)
-
-	if g.Chip == gal.ChipGAL16V8 {
-		fb.add(g.AC1)
-		fb.add(g.PT)
-		fb.add([]bool{g.Syn})
-		fb.add([]bool{g.AC0})
+	config = append(config, g.Sig)
+	if g.Chip.HasModes() {
+		config = append(config, g.AC1, g.PT, []bool{g.Syn}, []bool{g.AC0})
 	}
+	if g.Atmel {
+		config = append(config, []bool{!g.PowerDown})
+	}
+	return rows, config
+}
 
-	fb.checksum()
-	buf.WriteString("*\n")
-	buf.WriteByte(0x03)
-	fmt.Fprintf(&buf, "%04x\n", fileChecksum([]byte(buf.String())))
-	return buf.String()
+// writePinNotes emits a note line per assigned pin. Notes are outside the fuse
+// data, so they only contribute to the file checksum.
+func writePinNotes(buf *strings.Builder, g *gal.GAL) {
+	for i, p := range g.Pins {
+		if p.Name == "" {
+			continue
+		}
+		name := p.Name
+		if p.ActiveLow {
+			name = "!" + name
+		}
+		fmt.Fprintf(buf, "*N PIN %d %s\n", i+1, name)
+	}
 }
 
 func anyTrue(bits []bool) bool {
@@ -153,6 +265,16 @@ func (c *checkSummer) get() uint16 {
 	return c.sum + uint16(c.byte)
 }
 
+// FuseChecksum returns the JEDEC *C fuse checksum: the 16-bit sum of the
+// fuses packed into bytes, least significant bit first.
+func FuseChecksum(fuses []bool) uint16 {
+	var c checkSummer
+	for _, f := range fuses {
+		c.add(f)
+	}
+	return c.get()
+}
+
 func boolToInt(b bool) byte {
 	if b {
 		return 1
@@ -160,6 +282,8 @@ func boolToInt(b bool) byte {
 	return 0
 }
 
+// fileChecksum returns the JEDEC transmission checksum: the 16-bit sum of
+// every byte from STX through ETX inclusive.
 func fileChecksum(data []byte) uint16 {
 	var sum uint16
 	for _, b := range data {
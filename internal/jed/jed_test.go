@@ -0,0 +1,488 @@
+package jed_test
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pborges/cupl/examples"
+	"github.com/pborges/cupl/internal/cupl"
+	"github.com/pborges/cupl/internal/gal"
+	"github.com/pborges/cupl/internal/jed"
+	"github.com/pborges/cupl/internal/testutil"
+)
+
+func mustCompile(t *testing.T, src string) *gal.GAL {
+	t.Helper()
+	content, err := cupl.Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	g, err := cupl.Compile(content)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	return g
+}
+
+// fuseChecksum returns the *C field of a JEDEC file.
+func fuseChecksum(s string) string {
+	return s[strings.Index(s, "*C"):][:6]
+}
+
+func TestMakeJEDECPinNotes(t *testing.T) {
+	g := mustCompile(t, "Device g16v8;\nPin 2 = A;\nPin 3 = !B;\nPin 19 = Y;\nY = A & B;\n")
+	plain := jed.MakeJEDEC(jed.Config{}, g)
+	noted := jed.MakeJEDEC(jed.Config{EmitPinNotes: true}, g)
+
+	// One note per named pin, in pin order, ahead of the first fuse field.
+	var notes []string
+	for _, line := range strings.Split(noted, "\n") {
+		if strings.HasPrefix(line, "*N") {
+			notes = append(notes, line)
+		}
+	}
+	want := []string{"*N PIN 2 A", "*N PIN 3 !B", "*N PIN 19 Y"}
+	if !reflect.DeepEqual(notes, want) {
+		t.Errorf("notes %q, want %q", notes, want)
+	}
+	if strings.Index(noted, "*N") > strings.Index(noted, "*F0") {
+		t.Errorf("notes follow *F0:\n%s", noted)
+	}
+	if strings.Contains(plain, "*N") {
+		t.Errorf("default output has notes:\n%s", plain)
+	}
+
+	// Notes are outside the fuse data: the fuse checksum is unchanged and
+	// the file still parses to the same fuses.
+	if fuseChecksum(noted) != fuseChecksum(plain) {
+		t.Errorf("fuse checksum %s, want %s", fuseChecksum(noted), fuseChecksum(plain))
+	}
+	p, err := jed.Parse([]byte(plain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := jed.Parse([]byte(noted))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := jed.Diff(n, p); diff != "" {
+		t.Errorf("fuses differ: %s", diff)
+	}
+}
+
+func TestMakeJEDECDeviceFields(t *testing.T) {
+	g := mustCompile(t, "Device g22v10;\nPin 2 = A;\nPin 23 = Y;\nY = A;\n")
+	plain := jed.MakeJEDEC(jed.Config{}, g)
+	withDev := jed.MakeJEDEC(jed.Config{EmitDeviceFields: true}, g)
+	if strings.Contains(plain, "*D") || strings.Contains(plain, "*QP") {
+		t.Errorf("default output has device fields:\n%s", plain)
+	}
+
+	var fields []string
+	for _, line := range strings.Split(withDev, "\n") {
+		if strings.HasPrefix(line, "*") && !strings.HasPrefix(line, "*L") {
+			fields = append(fields, line)
+		}
+	}
+	want := []string{"*DGAL22V10", "*F0", "*G0", "*QF5892", "*QP24"}
+	if !reflect.DeepEqual(fields[:len(want)], want) {
+		t.Errorf("got fields %v, want %v first", fields, want)
+	}
+	// The fuse checksum covers fuses only.
+	if fuseChecksum(plain) != fuseChecksum(withDev) {
+		t.Errorf("fuse checksum changed: %s vs %s", fuseChecksum(plain), fuseChecksum(withDev))
+	}
+}
+
+func TestMakeJEDECAllFuses(t *testing.T) {
+	g := mustCompile(t, "Device g16v8;\nPin 2 = A;\nPin 19 = Y;\nY = A;\n")
+	sparse := jed.MakeJEDEC(jed.Config{}, g)
+	dense := jed.MakeJEDEC(jed.Config{EmitAllFuses: true}, g)
+
+	// Every row of the array is written, starting at fuse 0, and intact rows
+	// are all zeros.
+	chip := gal.ChipGAL16V8
+	var rows []string
+	for _, line := range strings.Split(dense, "\n") {
+		if strings.HasPrefix(line, "*L") && len(line) > 8 && len(line[8:]) == chip.NumCols() {
+			rows = append(rows, line)
+		}
+	}
+	if len(rows) != chip.NumRows() {
+		t.Fatalf("dense output has %d array rows, want %d", len(rows), chip.NumRows())
+	}
+	if !strings.HasPrefix(rows[0], "*L00000 ") {
+		t.Errorf("first row %q, want fuse 0", rows[0])
+	}
+	last := fmt.Sprintf("*L%05d %s", (chip.NumRows()-1)*chip.NumCols(), strings.Repeat("0", chip.NumCols()))
+	if rows[len(rows)-1] != last {
+		t.Errorf("last row %q, want the intact row %q", rows[len(rows)-1], last)
+	}
+
+	s, err := jed.Parse([]byte(sparse))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := jed.Parse([]byte(dense))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := jed.Diff(d, s); diff != "" {
+		t.Errorf("dense fuses differ: %s", diff)
+	}
+	if d.Csum != s.Csum {
+		t.Errorf("fuse checksum %04X, want %04X", d.Csum, s.Csum)
+	}
+}
+
+// galasmComplexIn is c_16v8_complex_in.jed laid out as GALasm writes a
+// JEDEC file: every row of the array on its own *L line, intact rows
+// included, with four-digit fuse addresses.
+const galasmComplexIn = "\x02" + `
+Used Program:   GALasm 2.1
+GAL-Assembler:  GALasm 2.1
+Device:         GAL16V8
+
+*F0
+*G0
+*QF2194
+*L0000 00000000000000000000000000000000
+*L0032 00000000000000000000000000000000
+*L0064 00000000000000000000000000000000
+*L0096 00000000000000000000000000000000
+*L0128 00000000000000000000000000000000
+*L0160 00000000000000000000000000000000
+*L0192 00000000000000000000000000000000
+*L0224 00000000000000000000000000000000
+*L0256 00000000000000000000000000000000
+*L0288 00000000000000000000000000000000
+*L0320 00000000000000000000000000000000
+*L0352 00000000000000000000000000000000
+*L0384 00000000000000000000000000000000
+*L0416 00000000000000000000000000000000
+*L0448 00000000000000000000000000000000
+*L0480 00000000000000000000000000000000
+*L0512 00000000000000000000000000000000
+*L0544 00000000000000000000000000000000
+*L0576 00000000000000000000000000000000
+*L0608 00000000000000000000000000000000
+*L0640 00000000000000000000000000000000
+*L0672 00000000000000000000000000000000
+*L0704 00000000000000000000000000000000
+*L0736 00000000000000000000000000000000
+*L0768 11111111111111111111111111111111
+*L0800 01111111111111111111111111111111
+*L0832 11110111111111111111111111111111
+*L0864 11111111011111111111111111111111
+*L0896 11111111111101111111111111111111
+*L0928 11111111111111110111111111111111
+*L0960 11111111111111111111011111111111
+*L0992 00000000000000000000000000000000
+*L1024 00000000000000000000000000000000
+*L1056 00000000000000000000000000000000
+*L1088 00000000000000000000000000000000
+*L1120 00000000000000000000000000000000
+*L1152 00000000000000000000000000000000
+*L1184 00000000000000000000000000000000
+*L1216 00000000000000000000000000000000
+*L1248 00000000000000000000000000000000
+*L1280 11111111111111111111111111111111
+*L1312 11111111111111111011011111111111
+*L1344 11111111111111110111101111111111
+*L1376 00000000000000000000000000000000
+*L1408 00000000000000000000000000000000
+*L1440 00000000000000000000000000000000
+*L1472 00000000000000000000000000000000
+*L1504 00000000000000000000000000000000
+*L1536 11111111111111111111111111111111
+*L1568 11111111011111111111111111111111
+*L1600 11111111111101111111111111111111
+*L1632 00000000000000000000000000000000
+*L1664 00000000000000000000000000000000
+*L1696 00000000000000000000000000000000
+*L1728 00000000000000000000000000000000
+*L1760 00000000000000000000000000000000
+*L1792 11111111111111111111111111111111
+*L1824 11111111111111111101111111111111
+*L1856 01110111111111111111111111111111
+*L1888 00000000000000000000000000000000
+*L1920 00000000000000000000000000000000
+*L1952 00000000000000000000000000000000
+*L1984 00000000000000000000000000000000
+*L2016 00000000000000000000000000000000
+*L2048 00000111
+*L2056 0100001101101111011011010111000001101100011001010111100000000000
+*L2120 11111111
+*L2128 1111111111111111111111111111111111111111111111111111111111111111
+*L2192 1
+*L2193 1
+*C4c84
+*
+` + "\x031bac\n"
+
+// TestMakeJEDECAllFusesGolden checks EmitAllFuses against a dense fuse map
+// from another assembler: the same *L lines and the same *C checksum.
+func TestMakeJEDECAllFusesGolden(t *testing.T) {
+	src, err := examples.FS.ReadFile("c_16v8_complex_in.pld")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ours := jed.MakeJEDEC(jed.Config{EmitAllFuses: true}, mustCompile(t, string(src)))
+	lines := func(s string) map[int]string {
+		m := make(map[int]string)
+		for _, line := range strings.Split(s, "\n") {
+			var off int
+			var bits string
+			if _, err := fmt.Sscanf(line, "*L%d %s", &off, &bits); err == nil {
+				m[off] = bits
+			}
+		}
+		return m
+	}
+	if got, want := lines(ours), lines(galasmComplexIn); !reflect.DeepEqual(got, want) {
+		t.Errorf("*L lines differ:\n%v\nwant\n%v", got, want)
+	}
+
+	golden, err := jed.Parse([]byte(galasmComplexIn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := jed.Parse([]byte(ours))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := jed.Diff(j, golden); diff != "" {
+		t.Errorf("fuses differ: %s", diff)
+	}
+	if j.Csum != golden.Csum {
+		t.Errorf("fuse checksum %04X, want %04X", j.Csum, golden.Csum)
+	}
+}
+
+func TestMakeJEDECFuseLineWidth(t *testing.T) {
+	for _, name := range []string{"r_22v10_reg", "c_16v8_complex_feedback"} {
+		src, err := examples.FS.ReadFile(name + ".pld")
+		if err != nil {
+			t.Fatal(err)
+		}
+		g := mustCompile(t, string(src))
+		perRow := jed.MakeJEDEC(jed.Config{}, g)
+		for _, cfg := range []jed.Config{{FuseLineWidth: 32}, {FuseLineWidth: 32, EmitAllFuses: true}} {
+			fixed := jed.MakeJEDEC(cfg, g)
+			// Each *L line starts on a multiple of 32 and holds at most 32
+			// fuses; with EmitAllFuses they tile the whole map.
+			next := 0
+			for _, line := range strings.Split(fixed, "\n") {
+				if !strings.HasPrefix(line, "*L") {
+					continue
+				}
+				var off int
+				var bits string
+				if _, err := fmt.Sscanf(line, "*L%d %s", &off, &bits); err != nil {
+					t.Fatalf("%s: %q: %v", name, line, err)
+				}
+				if off%32 != 0 || len(bits) > 32 || off+len(bits) > g.FuseCount() {
+					t.Errorf("%s: line %q is not a 32-fuse group", name, line)
+				}
+				if cfg.EmitAllFuses && off != next {
+					t.Errorf("%s: line at %d, want %d", name, off, next)
+				}
+				next = off + len(bits)
+			}
+			if cfg.EmitAllFuses && next != g.FuseCount() {
+				t.Errorf("%s: lines end at fuse %d, want %d", name, next, g.FuseCount())
+			}
+
+			// The fuses and their *C checksum are the same as per-row output.
+			if diff, err := testutil.DiffJEDEC([]byte(fixed), []byte(perRow)); err != nil || diff != "" {
+				t.Errorf("%s: %+v differs from per-row output: %v %s", name, cfg, err, diff)
+			}
+			if fuseChecksum(fixed) != fuseChecksum(perRow) {
+				t.Errorf("%s: %s, want %s", name, fuseChecksum(fixed), fuseChecksum(perRow))
+			}
+		}
+	}
+}
+
+func TestChecksums(t *testing.T) {
+	// A WinCUPL reference file parses with its *C fuse checksum intact.
+	ref, err := examples.FS.ReadFile("r_22v10_reg.jed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := jed.Parse(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.Csum != 0x865B || jed.FuseChecksum(j.Fuses) != j.Csum {
+		t.Errorf("*C%04X, fuses sum to %04X, want 865B", j.Csum, jed.FuseChecksum(j.Fuses))
+	}
+	bad := strings.Replace(string(ref), "*C865B", "*C865C", 1)
+	if _, err := jed.Parse([]byte(bad)); err == nil || !strings.Contains(err.Error(), "fuse checksum mismatch") {
+		t.Errorf("corrupted *C: got %v, want a fuse checksum mismatch", err)
+	}
+
+	// The transmission checksum after ETX sums STX through ETX inclusive.
+	g := mustCompile(t, "Device g16v8;\nPin 2 = A;\nPin 19 = Y;\nY = A;\n")
+	// With CRLF line endings the checksum covers the extra CRs, one per line
+	// before ETX.
+	lf := jed.MakeJEDEC(jed.Config{}, g)
+	crlf := jed.MakeJEDEC(jed.Config{LineEnding: "\r\n"}, g)
+	var sums [2]uint16
+	var bodies [2]string
+	for i, out := range []string{lf, crlf} {
+		etx := strings.IndexByte(out, 0x03)
+		if !strings.HasPrefix(out, "\x02") || etx < 0 {
+			t.Fatalf("output is not framed by STX/ETX: %q", out)
+		}
+		bodies[i] = out[:etx]
+		for _, b := range []byte(out[:etx+1]) {
+			sums[i] += uint16(b)
+		}
+		if got, want := strings.TrimSpace(out[etx+1:]), fmt.Sprintf("%04x", sums[i]); got != want {
+			t.Errorf("transmission checksum %s, want %s", got, want)
+		}
+		if _, err := jed.Parse([]byte(out)); err != nil {
+			t.Errorf("own output: %v", err)
+		}
+	}
+	if strings.ReplaceAll(bodies[1], "\r\n", "\n") != bodies[0] {
+		t.Errorf("CRLF output differs from LF output in more than line endings:\n%q\n%q", crlf, lf)
+	}
+	if lines := uint16(strings.Count(bodies[0], "\n")); sums[1] != sums[0]+'\r'*lines {
+		t.Errorf("CRLF checksum %04x, want %04x plus a CR for each of %d lines", sums[1], sums[0], lines)
+	}
+	if !strings.HasSuffix(crlf, "\r\n") {
+		t.Errorf("CRLF output does not end in CRLF: %q", crlf[len(crlf)-8:])
+	}
+}
+
+func TestParseDefaultFuse(t *testing.T) {
+	// Fuses no *L field lists take the *F default; *A and *X are recorded
+	// and leave the fuses alone.
+	const body = "*QF8*%s*A25*X0*L0002 01*L0006 1*\n"
+	for _, tt := range []struct {
+		def  string
+		want string
+	}{
+		{"F0", "00010010"},
+		{"F1", "11011111"},
+	} {
+		j, err := jed.Parse([]byte("header\n" + fmt.Sprintf(body, tt.def)))
+		if err != nil {
+			t.Fatalf("*%s: %v", tt.def, err)
+		}
+		var got strings.Builder
+		for _, f := range j.Fuses {
+			if f {
+				got.WriteByte('1')
+			} else {
+				got.WriteByte('0')
+			}
+		}
+		if got.String() != tt.want {
+			t.Errorf("*%s: fuses %s, want %s", tt.def, got.String(), tt.want)
+		}
+		if j.Access != "25" || j.TestDefault != "0" {
+			t.Errorf("*%s: *A %q *X %q, want 25 and 0", tt.def, j.Access, j.TestDefault)
+		}
+	}
+	if _, err := jed.Parse([]byte("header\n*QF8*F2*\n")); err == nil || !strings.Contains(err.Error(), "invalid F field") {
+		t.Errorf("*F2: got %v, want an invalid F field error", err)
+	}
+}
+
+func TestParseExtraFields(t *testing.T) {
+	// Fields Parse does not interpret survive a parse/normalize cycle in
+	// file order.
+	const src = "header\n*QF8*N PIN 2 A*P 1 2 3 4*G0*QP24*L0000 10100101*\n"
+	want := []string{"N PIN 2 A", "P 1 2 3 4", "QP24"}
+	j, err := jed.Parse([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(j.Extras, want) {
+		t.Errorf("extras %q, want %q", j.Extras, want)
+	}
+	norm, err := testutil.NormalizeJEDEC([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := testutil.NormalizeJEDEC(norm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, norm) {
+		t.Errorf("normalizing twice changed the file:\n%s\n%s", norm, again)
+	}
+	j, err = jed.Parse(norm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(j.Extras, want) {
+		t.Errorf("after normalizing: extras %q, want %q", j.Extras, want)
+	}
+}
+
+func TestDiffFieldTerminated(t *testing.T) {
+	g := mustCompile(t, "Device g16v8;\nPin 2 = A;\nPin 3 = B;\nPin 19 = Y;\nY = A & B;\n")
+	ours, err := jed.Parse([]byte(jed.MakeJEDEC(jed.Config{}, g)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Other toolchains end each field with '*', wrap *L fields across lines
+	// and may default unlisted fuses with *F.
+	var b strings.Builder
+	b.WriteString("\x02design header*\nQF2194*\nF1*\nG0*\n")
+	for i := 0; i < len(ours.Fuses); i += 32 {
+		end := i + 32
+		if end == 2048 {
+			end-- // the last array fuse is left to the *F1 default
+		}
+		b.WriteString(fmt.Sprintf("L%d ", i))
+		for j := i; j < end && j < len(ours.Fuses); j++ {
+			if j == i+16 {
+				b.WriteString("\n")
+			}
+			if ours.Fuses[j] {
+				b.WriteByte('1')
+			} else {
+				b.WriteByte('0')
+			}
+		}
+		b.WriteString("*\n")
+	}
+	b.WriteString("\x030000")
+	theirs, err := jed.Parse([]byte(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffs, err := jed.DiffFuses(ours, theirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ours.Fuses[2047] {
+		t.Fatal("fuse 2047 is already blown")
+	}
+	want := []jed.FuseDiff{{Fuse: 2047, Section: "Logic OLMC0(pin12) row7 col31", Got: false, Want: true}}
+	if !reflect.DeepEqual(diffs, want) {
+		t.Errorf("diffs = %+v, want %+v", diffs, want)
+	}
+
+	// A GAL16V8 file compares against its Atmel equivalent.
+	atmel := jed.File{QF: ours.QF + 1, Fuses: append(append([]bool(nil), ours.Fuses...), true)}
+	diffs, err = jed.DiffFuses(ours, atmel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 || diffs[0].Fuse != ours.QF {
+		t.Errorf("atmel diffs = %+v, want only fuse %d", diffs, ours.QF)
+	}
+	if _, err := jed.DiffFuses(ours, jed.File{QF: 5892}); err == nil {
+		t.Error("expected a QF mismatch between a GAL16V8 and a GAL22V10")
+	}
+}
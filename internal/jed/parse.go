@@ -0,0 +1,193 @@
+package jed
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pborges/cupl/internal/gal"
+)
+
+// File holds the fuse data read from a JEDEC file.
+type File struct {
+	QF    int
+	G     int
+	Fuses []bool
+	Csum  uint16
+
+	// Access and TestDefault hold the *A access time and *X default test
+	// condition fields as written, or "". They do not affect the fuses.
+	Access      string
+	TestDefault string
+
+	// Extras holds the other fields, such as *N notes, *P pin lists and *V
+	// test vectors, in file order and without the leading '*', so tools can
+	// write them back.
+	Extras []string
+}
+
+// Parse reads the *QF, *G, *F, *C and *L fields of a JEDEC file, and records
+// *A and *X. Fields end at the next '*', so an *L field may wrap across lines
+// as other toolchains write them. Fuses not listed in an *L field take the
+// *F default (*F1 leaves them blown), or 0 without one. A *C fuse checksum
+// that does not match the fuses is an error. Other fields are kept in Extras.
+func Parse(data []byte) (File, error) {
+	var j File
+	s := string(data)
+	// remove STX/ETX if present
+	if idx := strings.Index(s, "\x02"); idx >= 0 {
+		s = s[idx+1:]
+	}
+	if idx := strings.Index(s, "\x03"); idx >= 0 {
+		s = s[:idx]
+	}
+	fields := strings.Split(s, "*")
+	fuses := map[int]bool{}
+	maxIndex := 0
+	def := false
+	hasCsum := false
+	// The first field is the free-form design header.
+	for _, field := range fields[1:] {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(field, "QF"):
+			qf, err := strconv.Atoi(strings.TrimSpace(field[2:]))
+			if err != nil {
+				return j, err
+			}
+			j.QF = qf
+		case field[0] == 'G':
+			g, err := strconv.Atoi(strings.TrimSpace(field[1:]))
+			if err != nil {
+				return j, err
+			}
+			j.G = g
+		case field[0] == 'F':
+			switch strings.TrimSpace(field[1:]) {
+			case "0":
+				def = false
+			case "1":
+				def = true
+			default:
+				return j, fmt.Errorf("invalid F field: %q, want *F0 or *F1", "*"+field)
+			}
+		case field[0] == 'A':
+			j.Access = strings.TrimSpace(field[1:])
+		case field[0] == 'X':
+			j.TestDefault = strings.TrimSpace(field[1:])
+		case field[0] == 'C':
+			cs, err := strconv.ParseUint(strings.TrimSpace(field[1:]), 16, 16)
+			if err != nil {
+				return j, err
+			}
+			j.Csum = uint16(cs)
+			hasCsum = true
+		case field[0] == 'L':
+			parts := strings.Fields(field[1:])
+			if len(parts) < 2 {
+				return j, fmt.Errorf("invalid L field: %q", "*"+field)
+			}
+			off, err := strconv.Atoi(parts[0])
+			if err != nil {
+				return j, err
+			}
+			for i, ch := range strings.Join(parts[1:], "") {
+				idx := off + i
+				if ch == '1' {
+					fuses[idx] = true
+				} else if ch == '0' {
+					fuses[idx] = false
+				} else {
+					return j, fmt.Errorf("invalid bit %q", ch)
+				}
+				if idx > maxIndex {
+					maxIndex = idx
+				}
+			}
+		default:
+			j.Extras = append(j.Extras, field)
+		}
+	}
+	if j.QF == 0 {
+		j.QF = maxIndex + 1
+	}
+	j.Fuses = make([]bool, j.QF)
+	for i := 0; i < j.QF; i++ {
+		if v, ok := fuses[i]; ok {
+			j.Fuses[i] = v
+		} else {
+			j.Fuses[i] = def
+		}
+	}
+	if sum := FuseChecksum(j.Fuses); hasCsum && sum != j.Csum {
+		return j, fmt.Errorf("fuse checksum mismatch: *C%04X, fuses sum to %04X", j.Csum, sum)
+	}
+	return j, nil
+}
+
+// FuseDiff is a fuse whose state differs between two JEDEC files.
+type FuseDiff struct {
+	Fuse    int
+	Section string
+	Got     bool
+	Want    bool
+}
+
+// DiffFuses lists every fuse that differs between two parsed JEDEC files,
+// annotated with its section name. Files of the same device whose fuse
+// counts differ, such as a GAL and its Atmel equivalent with the extra
+// power-down fuse, are compared with the missing fuses taken as intact.
+func DiffFuses(got, want File) ([]FuseDiff, error) {
+	chip, err := gal.ChipForFuseCount(got.QF)
+	if got.QF != want.QF {
+		wantChip, wantErr := gal.ChipForFuseCount(want.QF)
+		if err != nil || wantErr != nil || chip != wantChip {
+			return nil, fmt.Errorf("QF mismatch: got %d want %d", got.QF, want.QF)
+		}
+	}
+	n := len(got.Fuses)
+	if len(want.Fuses) > n {
+		n = len(want.Fuses)
+	}
+	var diffs []FuseDiff
+	for i := 0; i < n; i++ {
+		g := i < len(got.Fuses) && got.Fuses[i]
+		w := i < len(want.Fuses) && want.Fuses[i]
+		if g != w {
+			diffs = append(diffs, FuseDiff{Fuse: i, Section: chip.FuseSectionName(i), Got: g, Want: w})
+		}
+	}
+	return diffs, nil
+}
+
+// Diff compares the fuse arrays of two parsed JEDEC files and returns a
+// human-readable list of mismatches annotated with fuse section names, or ""
+// if they match. Formatting, headers and *L field layout are not compared.
+func Diff(got, want File) string {
+	if got.QF != want.QF {
+		return fmt.Sprintf("QF mismatch: got %d want %d", got.QF, want.QF)
+	}
+	if len(got.Fuses) != len(want.Fuses) {
+		return fmt.Sprintf("fuse length mismatch: got %d want %d", len(got.Fuses), len(want.Fuses))
+	}
+	diffs, err := DiffFuses(got, want)
+	if err != nil {
+		return err.Error()
+	}
+	if len(diffs) == 0 {
+		return ""
+	}
+	var buf bytes.Buffer
+	for i, d := range diffs {
+		if i == 40 {
+			fmt.Fprintf(&buf, "  ... (%d more, truncated)\n", len(diffs)-i)
+			break
+		}
+		fmt.Fprintf(&buf, "  fuse[%d] %s: got=%c want=%c\n", d.Fuse, d.Section, '0'+boolToInt(d.Got), '0'+boolToInt(d.Want))
+	}
+	return fmt.Sprintf("%d fuse mismatches:\n%s", len(diffs), buf.String())
+}